@@ -0,0 +1,339 @@
+// Package aitest はエージェントの振る舞いをテストするための台本付きの偽モデルを提供する
+//
+// Model はResponses APIを模した http.RoundTripper で、あらかじめ与えた台本（Step）に従って
+// ツール呼び出しや最終回答を返す。OpenAIClient のツール実行経路をそのまま通るため、
+// 実行されたツール、セッションの内容、ファイルシステムの状態を検証できる
+//
+//	model := aitest.NewModel(
+//		aitest.CallTool("read_file", map[string]any{"path": "main.go"}),
+//		aitest.Reply("main.go を確認しました"),
+//	)
+//	client := ai.NewOpenAIClient("test", store, ai.WithRequestOptions(model.RequestOptions()...))
+//
+// Model は http.Handler も実装しているため、httptest.NewServer で起動して
+// OpenAI互換のローカルサーバーとして使うこともできる
+package aitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/openai/openai-go/v3/option"
+)
+
+// Step はAPI呼び出し1回分の台本
+// ToolCalls があればツール呼び出しを、なければ Text を最終回答として返す
+type Step struct {
+	ToolCalls []ToolCall
+	Text      string
+	Usage     Usage
+}
+
+// ToolCall はモデルが要求するツール呼び出し
+type ToolCall struct {
+	Name      string
+	Arguments any // JSONに変換して送る（string の場合はそのまま送る）
+}
+
+// Usage はレスポンスに含めるトークン使用量
+type Usage struct {
+	InputTokens     int64
+	CachedTokens    int64
+	OutputTokens    int64
+	ReasoningTokens int64
+}
+
+// defaultUsage は Step.Usage を指定しなかった場合の使用量
+var defaultUsage = Usage{InputTokens: 100, OutputTokens: 10}
+
+// CallTool は1つのツールを呼び出す Step を返す
+func CallTool(name string, args any) Step {
+	return Step{ToolCalls: []ToolCall{{Name: name, Arguments: args}}}
+}
+
+// CallTools は複数のツールを並列に呼び出す Step を返す
+func CallTools(calls ...ToolCall) Step {
+	return Step{ToolCalls: calls}
+}
+
+// Reply は最終回答を返す Step を返す
+func Reply(text string) Step {
+	return Step{Text: text}
+}
+
+// Request は偽モデルが受け取ったレスポンス作成リクエスト
+type Request struct {
+	Model              string
+	Instructions       string
+	PreviousResponseID string
+	Input              []InputItem
+}
+
+// InputItem はリクエストの入力項目
+type InputItem struct {
+	Type   string // "message" または "function_call_output"
+	Role   string // メッセージの場合のロール
+	Text   string // メッセージの場合の本文
+	CallID string // ツール実行結果の場合の呼び出しID
+	Output string // ツール実行結果の場合の結果
+}
+
+// Model は台本どおりに応答する偽のResponses API
+type Model struct {
+	mu        sync.Mutex
+	steps     []Step
+	next      int
+	requests  []Request
+	responses map[string][]byte
+	callSeq   int
+}
+
+// NewModel は台本を持つ偽モデルを作成する
+func NewModel(steps ...Step) *Model {
+	return &Model{
+		steps:     steps,
+		responses: make(map[string][]byte),
+	}
+}
+
+// RequestOptions は OpenAIClient をこの偽モデルに接続するためのリクエストオプションを返す
+func (m *Model) RequestOptions() []option.RequestOption {
+	return []option.RequestOption{
+		option.WithHTTPClient(&http.Client{Transport: m}),
+		option.WithMaxRetries(0),
+	}
+}
+
+// Requests は受け取ったレスポンス作成リクエストを受信順に返す
+func (m *Model) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Request(nil), m.requests...)
+}
+
+// ToolOutputs は受け取ったツールの実行結果を受信順に返す
+func (m *Model) ToolOutputs() []InputItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var outputs []InputItem
+	for _, req := range m.requests {
+		for _, item := range req.Input {
+			if item.Type == "function_call_output" {
+				outputs = append(outputs, item)
+			}
+		}
+	}
+	return outputs
+}
+
+// Remaining はまだ使われていない Step の数を返す
+func (m *Model) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.steps) - m.next
+}
+
+// RoundTrip implements http.RoundTripper.
+func (m *Model) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/responses"):
+		return m.createResponse(req)
+	case req.Method == http.MethodGet && strings.Contains(req.URL.Path, "/responses/"):
+		id := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		body, ok := m.responses[id]
+		if !ok {
+			return newResponse(req, http.StatusNotFound, []byte(`{"error":{"message":"response not found","type":"invalid_request_error"}}`)), nil
+		}
+		return newResponse(req, http.StatusOK, body), nil
+	default:
+		return nil, fmt.Errorf("aitest: unexpected request %s %s", req.Method, req.URL.Path)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (m *Model) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	resp, err := m.RoundTrip(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (m *Model) createResponse(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("aitest: failed to read request body: %w", err)
+	}
+
+	parsed, err := parseRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	m.requests = append(m.requests, parsed)
+
+	if m.next >= len(m.steps) {
+		return nil, fmt.Errorf("aitest: script exhausted (received request #%d)", len(m.requests))
+	}
+	step := m.steps[m.next]
+	m.next++
+
+	id := fmt.Sprintf("resp_%d", m.next)
+	respBody, err := m.renderResponse(id, parsed.Model, step)
+	if err != nil {
+		return nil, err
+	}
+	m.responses[id] = respBody
+
+	return newResponse(req, http.StatusOK, respBody), nil
+}
+
+// renderResponse は Step をResponses APIのレスポンスJSONに変換する
+func (m *Model) renderResponse(id, model string, step Step) ([]byte, error) {
+	output := make([]map[string]any, 0, len(step.ToolCalls)+1)
+	for _, call := range step.ToolCalls {
+		m.callSeq++
+
+		args, ok := call.Arguments.(string)
+		if !ok {
+			data, err := json.Marshal(call.Arguments)
+			if err != nil {
+				return nil, fmt.Errorf("aitest: failed to marshal arguments for %s: %w", call.Name, err)
+			}
+			args = string(data)
+		}
+
+		output = append(output, map[string]any{
+			"type":      "function_call",
+			"id":        fmt.Sprintf("fc_%d", m.callSeq),
+			"call_id":   fmt.Sprintf("call_%d", m.callSeq),
+			"name":      call.Name,
+			"arguments": args,
+			"status":    "completed",
+		})
+	}
+	if len(step.ToolCalls) == 0 {
+		output = append(output, map[string]any{
+			"type":   "message",
+			"id":     "msg_" + id,
+			"role":   "assistant",
+			"status": "completed",
+			"content": []map[string]any{
+				{"type": "output_text", "text": step.Text, "annotations": []any{}},
+			},
+		})
+	}
+
+	usage := step.Usage
+	if usage == (Usage{}) {
+		usage = defaultUsage
+	}
+
+	return json.Marshal(map[string]any{
+		"id":                  id,
+		"object":              "response",
+		"created_at":          0,
+		"status":              "completed",
+		"model":               model,
+		"output":              output,
+		"parallel_tool_calls": true,
+		"tool_choice":         "auto",
+		"tools":               []any{},
+		"usage": map[string]any{
+			"input_tokens":          usage.InputTokens,
+			"input_tokens_details":  map[string]any{"cached_tokens": usage.CachedTokens},
+			"output_tokens":         usage.OutputTokens,
+			"output_tokens_details": map[string]any{"reasoning_tokens": usage.ReasoningTokens},
+			"total_tokens":          usage.InputTokens + usage.OutputTokens,
+		},
+	})
+}
+
+// parseRequest はレスポンス作成リクエストのうち検証に使う項目を取り出す
+func parseRequest(body []byte) (Request, error) {
+	var raw struct {
+		Model              string `json:"model"`
+		Instructions       string `json:"instructions"`
+		PreviousResponseID string `json:"previous_response_id"`
+		Input              []struct {
+			Type    string          `json:"type"`
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+			CallID  string          `json:"call_id"`
+			Output  string          `json:"output"`
+		} `json:"input"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Request{}, fmt.Errorf("aitest: failed to parse request: %w", err)
+	}
+
+	req := Request{
+		Model:              raw.Model,
+		Instructions:       raw.Instructions,
+		PreviousResponseID: raw.PreviousResponseID,
+	}
+	for _, item := range raw.Input {
+		in := InputItem{
+			Type:   item.Type,
+			Role:   item.Role,
+			CallID: item.CallID,
+			Output: item.Output,
+		}
+		if in.Type == "" && in.Role != "" {
+			in.Type = "message"
+		}
+		// content は文字列または入力パーツの配列
+		if len(item.Content) > 0 {
+			var text string
+			if err := json.Unmarshal(item.Content, &text); err == nil {
+				in.Text = text
+			} else {
+				var parts []struct {
+					Text string `json:"text"`
+				}
+				if err := json.Unmarshal(item.Content, &parts); err == nil {
+					for _, p := range parts {
+						in.Text += p.Text
+					}
+				}
+			}
+		}
+		req.Input = append(req.Input, in)
+	}
+
+	return req, nil
+}
+
+func newResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
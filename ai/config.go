@@ -1,21 +1,102 @@
 package ai
 
-import "io"
+import (
+	"log/slog"
+	"maps"
+
+	"github.com/jinford/coding-agent-example/ai/redact"
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/openai/openai-go/v3/option"
+)
 
 type Config struct {
-	debugOutput io.Writer
+	logger        *slog.Logger
+	trace         bool
+	pricingTable  map[string]ModelPricing
+	modelSettings ModelSettings
+	instructions  string
+	requestOpts   []option.RequestOption
+	redactor      *redact.Redactor
+	workspace     session.Workspace
+	titleModel    string
 }
 
 func defaultConfig() *Config {
 	return &Config{
-		debugOutput: io.Discard,
+		logger:        slog.Default(),
+		pricingTable:  maps.Clone(defaultPricingTable),
+		modelSettings: DefaultModelSettings(),
+		instructions:  systemPrompt,
+		redactor:      redact.Default(),
 	}
 }
 
 type OptionFunc func(*Config)
 
-func WithDebugOutput(w io.Writer) func(*Config) {
+// WithLogger はログの出力先を指定する
+func WithLogger(logger *slog.Logger) func(*Config) {
+	return func(c *Config) {
+		c.logger = logger
+	}
+}
+
+// WithTrace はAPIのリクエスト・レスポンスの内容をデバッグレベルでログに記録する
+func WithTrace(enabled bool) func(*Config) {
+	return func(c *Config) {
+		c.trace = enabled
+	}
+}
+
+// WithPricing はモデルの料金を追加・上書きする
+func WithPricing(model string, pricing ModelPricing) func(*Config) {
+	return func(c *Config) {
+		c.pricingTable[model] = pricing
+	}
+}
+
+// WithModelSettings は新しいセッションで使用するモデル設定を指定する
+// 既にモデル設定が保存されているセッションでは、保存された設定が優先される
+func WithModelSettings(settings ModelSettings) func(*Config) {
+	return func(c *Config) {
+		c.modelSettings = settings
+	}
+}
+
+// WithInstructions はシステムプロンプトを指定する（LoadInstructions の結果を渡す）
+func WithInstructions(instructions *Instructions) func(*Config) {
+	return func(c *Config) {
+		c.instructions = instructions.String()
+	}
+}
+
+// WithRequestOptions はOpenAI SDKのリクエストオプションを追加する
+// テストでHTTPクライアントを差し替える場合などに使用する
+func WithRequestOptions(opts ...option.RequestOption) func(*Config) {
+	return func(c *Config) {
+		c.requestOpts = append(c.requestOpts, opts...)
+	}
+}
+
+// WithRedactor はツールの実行結果から秘密情報を伏せる Redactor を指定する
+// 既定では組み込みの検出器を使う redact.Default() が使われる。nil を指定すると伏せない
+func WithRedactor(redactor *redact.Redactor) func(*Config) {
+	return func(c *Config) {
+		c.redactor = redactor
+	}
+}
+
+// WithWorkspace は新しいセッションに記録するワークスペースを指定する
+// 指定した場合、ListSessions は既定でこのワークスペースのセッションだけを返す
+func WithWorkspace(workspace session.Workspace) func(*Config) {
+	return func(c *Config) {
+		c.workspace = workspace
+	}
+}
+
+// WithTitleModel は最初の往復からセッションのタイトルを生成するモデルを指定する
+// 指定しない場合は、ユーザーの最初の発言からタイトルを作る
+func WithTitleModel(model string) func(*Config) {
 	return func(c *Config) {
-		c.debugOutput = w
+		c.titleModel = model
 	}
 }
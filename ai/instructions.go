@@ -0,0 +1,122 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// InstructionFileName はシステムプロンプトに追記する指示ファイルの名前
+	InstructionFileName = "AGENTS.md"
+
+	// SystemPromptOverrideFileName は組み込みのシステムプロンプトを置き換えるファイルの名前
+	// ワークスペースの ".coding-agent" ディレクトリ、またはユーザー設定ディレクトリに配置する
+	SystemPromptOverrideFileName = "system_prompt.md"
+)
+
+// InstructionFile は読み込んだ指示ファイル
+type InstructionFile struct {
+	Path    string // ファイルのパス
+	Content string // ファイルの内容
+}
+
+// Instructions はシステムプロンプトの構成要素
+type Instructions struct {
+	Base       string            // ベースとなるシステムプロンプト
+	BaseSource string            // ベースの出所（"built-in" またはファイルのパス）
+	Files      []InstructionFile // 追記する指示ファイル（優先度の低い順）
+}
+
+// String は全ての指示を結合した実効的なシステムプロンプトを返す
+// 後に追記されたもの（より作業ディレクトリに近いもの）ほど優先されることをモデルに伝える
+func (i *Instructions) String() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(i.Base))
+
+	if len(i.Files) > 0 {
+		b.WriteString("\n\n# プロジェクト固有の指示\n\n")
+		b.WriteString("以下はユーザーやプロジェクトが定めた追加の指示です。指示が矛盾する場合は、後に記載されたものを優先してください。\n")
+	}
+	for _, f := range i.Files {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", f.Path, strings.TrimSpace(f.Content))
+	}
+
+	return b.String()
+}
+
+// LoadInstructions はシステムプロンプトと指示ファイルを読み込む
+// 指示ファイルはユーザー設定ディレクトリ、ワークスペースの祖先ディレクトリ（ルート側から）、
+// ワークスペースの順に読み込み、この順に優先度が高くなる
+// userConfigDir が空の場合はユーザー単位のファイルを読み込まない
+func LoadInstructions(workspaceRoot, userConfigDir string) (*Instructions, error) {
+	root, err := filepath.Abs(workspaceRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+
+	instructions := &Instructions{
+		Base:       systemPrompt,
+		BaseSource: "built-in",
+	}
+
+	// 組み込みのシステムプロンプトの置き換え（ワークスペースの設定を優先）
+	overrideCandidates := []string{filepath.Join(root, ".coding-agent", SystemPromptOverrideFileName)}
+	if userConfigDir != "" {
+		overrideCandidates = append(overrideCandidates, filepath.Join(userConfigDir, SystemPromptOverrideFileName))
+	}
+	for _, path := range overrideCandidates {
+		content, ok, err := readOptionalFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			instructions.Base = content
+			instructions.BaseSource = path
+			break
+		}
+	}
+
+	// 優先度の低い順に指示ファイルの候補を並べる
+	var candidates []string
+	if userConfigDir != "" {
+		candidates = append(candidates, filepath.Join(userConfigDir, InstructionFileName))
+	}
+	var dirs []string
+	for dir := root; ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		candidates = append(candidates, filepath.Join(dirs[i], InstructionFileName))
+	}
+
+	for _, path := range candidates {
+		content, ok, err := readOptionalFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok && strings.TrimSpace(content) != "" {
+			instructions.Files = append(instructions.Files, InstructionFile{Path: path, Content: content})
+		}
+	}
+
+	return instructions, nil
+}
+
+// readOptionalFile はファイルを読み込む。ファイルが存在しない場合は ok=false を返す
+func readOptionalFile(path string) (content string, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read instruction file %q: %w", path, err)
+	}
+	return string(data), true, nil
+}
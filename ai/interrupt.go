@@ -0,0 +1,49 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/openai/openai-go/v3/responses"
+)
+
+// interruptedMetadataKey は中断したターンに付けるターン単位のメタデータのキー
+const interruptedMetadataKey = "interrupted"
+
+// interruptedNote は中断したターンのアシスタントの発言として保存する内容
+const interruptedNote = "（ユーザーが応答を中断しました）"
+
+// interruptedExchanges は会話履歴の末尾にある中断したやり取りを、モデルへの入力として返す
+// 中断したターンは前回の応答（previous_response_id）に含まれないため、発言と実行済みのツールを伝え直す
+func interruptedExchanges(history []*session.ConversationTurn) responses.ResponseInputParam {
+	start := len(history)
+	for start >= 2 && history[start-2].Role == "user" && history[start-1].Role == "assistant" &&
+		history[start-1].Metadata[interruptedMetadataKey] == "true" {
+		start -= 2
+	}
+
+	var input responses.ResponseInputParam
+	for i := start; i < len(history); i += 2 {
+		input = append(input,
+			responses.ResponseInputItemParamOfMessage(history[i].Content, responses.EasyInputMessageRoleUser),
+			responses.ResponseInputItemParamOfMessage(describeInterruptedTurn(history[i+1]), responses.EasyInputMessageRoleAssistant),
+		)
+	}
+	return input
+}
+
+// describeInterruptedTurn は中断したターンの内容を実行済みのツールとともに説明する
+func describeInterruptedTurn(turn *session.ConversationTurn) string {
+	if len(turn.ToolCalls) == 0 {
+		return turn.Content
+	}
+
+	var b strings.Builder
+	b.WriteString(turn.Content)
+	b.WriteString("\n中断までに実行したツール:")
+	for _, call := range turn.ToolCalls {
+		fmt.Fprintf(&b, "\n- %s %s", call.Name, call.Arguments)
+	}
+	return b.String()
+}
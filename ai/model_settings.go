@@ -0,0 +1,180 @@
+package ai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/responses"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// セッションメタデータにモデル設定を保存する際のキー
+const (
+	metadataKeyModel           = "model"
+	metadataKeyTemperature     = "model.temperature"
+	metadataKeyMaxOutputTokens = "model.max_output_tokens"
+	metadataKeyReasoningEffort = "model.reasoning_effort"
+)
+
+// ModelSettings はモデルと推論パラメータの設定
+// ポインタ型のフィールドが nil の場合はAPIの既定値を使用する
+type ModelSettings struct {
+	Model           string   // モデル名
+	Temperature     *float64 // 温度（0〜2）
+	MaxOutputTokens *int64   // 最大出力トークン数
+	ReasoningEffort string   // 推論の度合い（"minimal", "low", "medium", "high"）
+}
+
+// DefaultModelSettings は既定のモデル設定を返す
+func DefaultModelSettings() ModelSettings {
+	return ModelSettings{
+		Model: shared.ChatModelGPT4_1,
+	}
+}
+
+// Validate は設定値が有効か検証する
+func (s ModelSettings) Validate() error {
+	if s.Model == "" {
+		return fmt.Errorf("model must not be empty")
+	}
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2: %v", *s.Temperature)
+	}
+	if s.MaxOutputTokens != nil && *s.MaxOutputTokens <= 0 {
+		return fmt.Errorf("max output tokens must be positive: %d", *s.MaxOutputTokens)
+	}
+	switch shared.ReasoningEffort(s.ReasoningEffort) {
+	case "", shared.ReasoningEffortMinimal, shared.ReasoningEffortLow, shared.ReasoningEffortMedium, shared.ReasoningEffortHigh:
+	default:
+		return fmt.Errorf("unknown reasoning effort: %q", s.ReasoningEffort)
+	}
+	return nil
+}
+
+// String は設定内容を人が読める形式で返す
+func (s ModelSettings) String() string {
+	parts := []string{s.Model}
+	if s.Temperature != nil {
+		parts = append(parts, "temperature="+strconv.FormatFloat(*s.Temperature, 'g', -1, 64))
+	}
+	if s.MaxOutputTokens != nil {
+		parts = append(parts, "max_tokens="+strconv.FormatInt(*s.MaxOutputTokens, 10))
+	}
+	if s.ReasoningEffort != "" {
+		parts = append(parts, "effort="+s.ReasoningEffort)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseModelSettingArgs は "/model" コマンドの引数を解釈し、base を更新した設定を返す
+// 引数は "gpt-5 effort=high temperature=0.2 max_tokens=4096" の形式で、
+// "key=" のように値を省略するとその設定を解除する
+func ParseModelSettingArgs(base ModelSettings, args []string) (ModelSettings, error) {
+	settings := base
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			settings.Model = arg
+			continue
+		}
+
+		switch key {
+		case "model":
+			settings.Model = value
+		case "temperature", "temp":
+			if value == "" {
+				settings.Temperature = nil
+				continue
+			}
+			t, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return base, fmt.Errorf("invalid temperature %q: %w", value, err)
+			}
+			settings.Temperature = &t
+		case "max_tokens", "max_output_tokens":
+			if value == "" {
+				settings.MaxOutputTokens = nil
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return base, fmt.Errorf("invalid max output tokens %q: %w", value, err)
+			}
+			settings.MaxOutputTokens = &n
+		case "effort", "reasoning_effort":
+			settings.ReasoningEffort = value
+		default:
+			return base, fmt.Errorf("unknown model setting: %q", key)
+		}
+	}
+
+	if err := settings.Validate(); err != nil {
+		return base, err
+	}
+
+	return settings, nil
+}
+
+// toMetadata はセッションメタデータに保存する形式に変換する
+// 未設定の項目は空文字列となり、SetMetadata によって削除される
+func (s ModelSettings) toMetadata() map[string]string {
+	metadata := map[string]string{
+		metadataKeyModel:           s.Model,
+		metadataKeyTemperature:     "",
+		metadataKeyMaxOutputTokens: "",
+		metadataKeyReasoningEffort: s.ReasoningEffort,
+	}
+	if s.Temperature != nil {
+		metadata[metadataKeyTemperature] = strconv.FormatFloat(*s.Temperature, 'g', -1, 64)
+	}
+	if s.MaxOutputTokens != nil {
+		metadata[metadataKeyMaxOutputTokens] = strconv.FormatInt(*s.MaxOutputTokens, 10)
+	}
+	return metadata
+}
+
+// modelSettingsFromMetadata はセッションメタデータからモデル設定を復元する
+// モデル設定が保存されていない場合は ok=false を返す
+func modelSettingsFromMetadata(metadata map[string]string) (settings ModelSettings, ok bool, err error) {
+	model, ok := metadata[metadataKeyModel]
+	if !ok {
+		return ModelSettings{}, false, nil
+	}
+
+	settings.Model = model
+	settings.ReasoningEffort = metadata[metadataKeyReasoningEffort]
+	if v, ok := metadata[metadataKeyTemperature]; ok {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return ModelSettings{}, false, fmt.Errorf("invalid temperature in session metadata: %w", err)
+		}
+		settings.Temperature = &t
+	}
+	if v, ok := metadata[metadataKeyMaxOutputTokens]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return ModelSettings{}, false, fmt.Errorf("invalid max output tokens in session metadata: %w", err)
+		}
+		settings.MaxOutputTokens = &n
+	}
+
+	return settings, true, nil
+}
+
+// applyTo はリクエストパラメータに設定を反映する
+func (s ModelSettings) applyTo(params *responses.ResponseNewParams) {
+	params.Model = s.Model
+	if s.Temperature != nil {
+		params.Temperature = openai.Float(*s.Temperature)
+	}
+	if s.MaxOutputTokens != nil {
+		params.MaxOutputTokens = openai.Int(*s.MaxOutputTokens)
+	}
+	if s.ReasoningEffort != "" {
+		params.Reasoning = shared.ReasoningParam{
+			Effort: shared.ReasoningEffort(s.ReasoningEffort),
+		}
+	}
+}
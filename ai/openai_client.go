@@ -3,19 +3,30 @@ package ai
 import (
 	"context"
 	"fmt"
+	"maps"
+	"sync"
+	"time"
 
+	"github.com/jinford/coding-agent-example/ai/redact"
 	"github.com/jinford/coding-agent-example/ai/tools"
 	"github.com/jinford/coding-agent-example/session"
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/responses"
-	"github.com/openai/openai-go/v3/shared"
 )
 
 type OpenAIClient struct {
 	client       openai.Client
 	config       *Config
 	sessionStore session.Store
+
+	// ツールの実行イベントの購読者
+	subscribersMu  sync.Mutex
+	subscribers    map[int]func(session.ToolEvent)
+	nextSubscriber int
+
+	// バックグラウンドで生成中のセッションのタイトル
+	titles sync.WaitGroup
 }
 
 func NewOpenAIClient(apiKey string, sessionStore session.Store, opts ...OptionFunc) *OpenAIClient {
@@ -24,8 +35,14 @@ func NewOpenAIClient(apiKey string, sessionStore session.Store, opts ...OptionFu
 		f(config)
 	}
 
+	requestOpts := []option.RequestOption{option.WithAPIKey(apiKey)}
+	if config.trace {
+		requestOpts = append(requestOpts, option.WithMiddleware(newTraceMiddleware(config.logger, config.redactor)))
+	}
+	requestOpts = append(requestOpts, config.requestOpts...)
+
 	return &OpenAIClient{
-		client:       openai.NewClient(option.WithAPIKey(apiKey)),
+		client:       openai.NewClient(requestOpts...),
 		config:       config,
 		sessionStore: sessionStore,
 	}
@@ -33,8 +50,10 @@ func NewOpenAIClient(apiKey string, sessionStore session.Store, opts ...OptionFu
 
 // GenerateResponse implements ui.OutputGenerator.
 func (c *OpenAIClient) GenerateResponse(ctx context.Context, userInput string, sessionID session.SessionID) (string, error) {
+	askedAt := time.Now()
+
 	// セッションから会話履歴を取得
-	conversationHistory, err := c.sessionStore.List(sessionID)
+	conversationHistory, err := c.sessionStore.List(ctx, sessionID)
 	if err != nil {
 		return "", fmt.Errorf("failed to list conversation history: %w", err)
 	}
@@ -53,61 +72,122 @@ func (c *OpenAIClient) GenerateResponse(ctx context.Context, userInput string, s
 	// response ID が有効か確認
 	if previousResponseID != "" {
 		if _, err := c.client.Responses.Get(ctx, previousResponseID, responses.ResponseGetParams{}); err != nil {
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("failed to get previous response: %w", err)
+			}
+			c.config.logger.WarnContext(ctx, "previous response is no longer available",
+				"session_id", sessionID, "response_id", previousResponseID, "error", err)
 			previousResponseID = ""
 		}
 	}
 
-	params := responses.ResponseNewParams{
-		Model:        shared.ChatModelGPT4_1,
-		Instructions: openai.String(systemPrompt),
-		Input: responses.ResponseNewParamsInputUnion{
-			OfInputItemList: responses.ResponseInputParam{
-				responses.ResponseInputItemParamOfMessage(userInput, responses.EasyInputMessageRoleUser),
-			},
-		},
-		Tools: tools.GetAllToolParams(),
+	// セッションのモデル設定を取得
+	settings, stored, err := c.modelSettings(ctx, sessionID)
+	if err != nil {
+		return "", err
 	}
 
-	if previousResponseID != "" {
-		params.PreviousResponseID = openai.String(previousResponseID)
-	}
+	// 中断したやり取りはモデルに伝わっていないため、今回の入力の前に含める
+	input := interruptedExchanges(conversationHistory)
+	input = append(input, responses.ResponseInputItemParamOfMessage(userInput, responses.EasyInputMessageRoleUser))
+	params := c.newResponseParams(settings, input, previousResponseID)
 
-	resp, err := c.client.Responses.New(ctx, params)
-	if err != nil {
-		return "", fmt.Errorf("failed to call response API: %w", err)
-	}
+	c.config.logger.InfoContext(ctx, "generating response",
+		"session_id", sessionID, "model", settings.Model, "previous_response_id", previousResponseID)
 
-	responseText, toolCalls, lastResponseID, err := c.resolveToolCalls(ctx, resp)
-	if err != nil {
+	var (
+		usage          session.Usage
+		responseText   string
+		toolCalls      []session.ToolCall
+		lastResponseID string
+	)
+	resp, err := c.createResponse(ctx, params)
+	if err == nil {
+		// トークン使用量を集計（ツール呼び出しによる追加のAPI呼び出し分も含む）
+		usage = c.usageFromResponse(resp)
+		responseText, toolCalls, lastResponseID, err = c.resolveToolCalls(ctx, settings, resp, &usage)
+	}
+	// 中断した場合（ctx がキャンセルされた場合）は途中までの内容をセッションに保存してからエラーを返す
+	interrupted := err != nil && ctx.Err() != nil
+	if err != nil && !interrupted {
 		return "", err
 	}
+	turnErr := err
+	if interrupted {
+		ctx = context.WithoutCancel(ctx)
+		responseText = interruptedNote
+	}
 
-	// ユーザーのターンを追加
+	// ユーザーのターンとアシスタントのターンをまとめて追加する
+	// （応答のないユーザーのターンが残らないよう、1回の Append で保存する）
 	userTurn := &session.ConversationTurn{
-		Role:    "user",
-		Content: userInput,
-	}
-	if err := c.sessionStore.Append(sessionID, userTurn); err != nil {
-		return "", fmt.Errorf("failed to append user turn: %w", err)
+		Role:      "user",
+		Content:   userInput,
+		CreatedAt: askedAt,
 	}
-
-	// アシスタントのターンを追加
 	assistantTurn := &session.ConversationTurn{
 		Role:      "assistant",
 		Content:   responseText,
 		ToolCalls: toolCalls,
-		Metadata: map[string]string{
-			"previous_response_id": lastResponseID,
-		},
+		Metadata:  map[string]string{},
+		Usage:     &usage,
+		CreatedAt: time.Now(),
+	}
+	if interrupted {
+		// 中断したターンは応答が完結していないため、次のターンは前回の応答から続ける
+		assistantTurn.Metadata[interruptedMetadataKey] = "true"
+	} else {
+		assistantTurn.Metadata["previous_response_id"] = lastResponseID
+	}
+	// 新しいセッションにはタイトルと作成したワークスペースを記録する
+	var sessionMetadata map[string]string
+	if len(conversationHistory) == 0 {
+		sessionMetadata = c.newSessionMetadata(ctx, sessionID, userInput)
+	}
+	// 既定のモデル設定は最初のやり取りを保存するときに記録する
+	// （最初のリクエストが失敗した場合にメタデータだけのセッションを残さない）
+	if !stored {
+		if sessionMetadata == nil {
+			sessionMetadata = make(map[string]string)
+		}
+		maps.Copy(sessionMetadata, settings.toMetadata())
+	}
+
+	if err := c.sessionStore.Append(ctx, sessionID, userTurn, assistantTurn); err != nil {
+		return "", fmt.Errorf("failed to append turns: %w", err)
 	}
-	if err := c.sessionStore.Append(sessionID, assistantTurn); err != nil {
-		return "", fmt.Errorf("failed to append assistant turn: %w", err)
+
+	if len(sessionMetadata) > 0 {
+		if err := c.sessionStore.SetMetadata(ctx, sessionID, sessionMetadata); err != nil {
+			c.config.logger.WarnContext(ctx, "failed to save session metadata",
+				"session_id", sessionID, "error", err)
+		} else if title, ok := sessionMetadata[session.TitleMetadataKey]; ok && c.config.titleModel != "" && !interrupted {
+			// 最初の発言から作った仮のタイトルを、応答を返した後にタイトル用のモデルで生成したものに置き換える
+			c.updateTitleInBackground(ctx, sessionID, userInput, responseText, title)
+		}
+	}
+
+	if interrupted {
+		c.config.logger.InfoContext(ctx, "response interrupted",
+			"session_id", sessionID,
+			"tool_calls", len(toolCalls),
+			"error", turnErr,
+		)
+		return "", turnErr
 	}
 
+	c.config.logger.InfoContext(ctx, "response generated",
+		"session_id", sessionID,
+		"tool_calls", len(toolCalls),
+		"input_tokens", usage.InputTokens,
+		"output_tokens", usage.OutputTokens,
+		"cost_usd", usage.CostUSD,
+	)
+
 	return responseText, nil
 }
 
-func (c *OpenAIClient) resolveToolCalls(ctx context.Context, resp *responses.Response) (string, []session.ToolCall, string, error) {
+func (c *OpenAIClient) resolveToolCalls(ctx context.Context, settings ModelSettings, resp *responses.Response, usage *session.Usage) (string, []session.ToolCall, string, error) {
 	// ツール呼び出し情報を記録
 	var toolCalls []session.ToolCall
 
@@ -118,53 +198,65 @@ func (c *OpenAIClient) resolveToolCalls(ctx context.Context, resp *responses.Res
 			continue
 		}
 
+		// 中断された場合は残りのツールを実行しない
+		if err := ctx.Err(); err != nil {
+			return "", toolCalls, "", err
+		}
+
 		item := outputItem.AsFunctionCall()
+		startedAt := time.Now()
+		c.emitToolEvent(session.ToolEvent{
+			Type: session.ToolStarted,
+			Call: session.ToolCall{
+				CallID:    item.CallID,
+				Name:      item.Name,
+				Arguments: item.Arguments,
+				StartedAt: startedAt,
+			},
+		})
 		result, err := c.handleFunctionCall(ctx, item)
+		duration := time.Since(startedAt)
 		if err != nil {
 			// エラーの場合も結果として返す
 			result = fmt.Sprintf("Error: %v", err)
-			toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(
-				item.CallID,
-				result,
-			))
-		} else {
-			// 実行結果を次のプロンプトに含める
-			toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(
-				item.CallID,
-				result,
-			))
 		}
+		// 秘密情報を伏せてから、実行結果を次のプロンプトに含めてセッションに記録する
+		result = c.redactToolResult(ctx, item, result)
+		toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(
+			item.CallID,
+			result,
+		))
 
 		// ツール呼び出し情報を記録
-		toolCalls = append(toolCalls, session.ToolCall{
+		call := session.ToolCall{
+			CallID:    item.CallID,
 			Name:      item.Name,
 			Arguments: item.Arguments,
 			Result:    result,
-		})
+			IsError:   err != nil,
+			StartedAt: startedAt,
+			Duration:  duration,
+			Bytes:     len(result),
+		}
+		toolCalls = append(toolCalls, call)
+		c.emitToolEvent(session.ToolEvent{Type: session.ToolFinished, Call: call})
 	}
 
 	// ツールコールがあった場合は、再度APIを呼び出して結果を返す
 	if len(toolOutputs) > 0 {
-		nextResp, err := c.client.Responses.New(ctx, responses.ResponseNewParams{
-			Model:        shared.ChatModelGPT4_1,
-			Instructions: openai.String(systemPrompt),
-			Input: responses.ResponseNewParamsInputUnion{
-				OfInputItemList: toolOutputs,
-			},
-			Tools:              tools.GetAllToolParams(),
-			PreviousResponseID: openai.String(resp.ID),
-		})
+		nextResp, err := c.createResponse(ctx, c.newResponseParams(settings, toolOutputs, resp.ID))
 		if err != nil {
-			return "", toolCalls, "", fmt.Errorf("failed to call response API: %w", err)
+			return "", toolCalls, "", err
 		}
+		usage.Add(c.usageFromResponse(nextResp))
 
 		// 再帰的に処理（ツール呼び出し情報を引き継ぐ）
-		nextText, nextToolCalls, lastRespID, err := c.resolveToolCalls(ctx, nextResp)
+		nextText, nextToolCalls, lastRespID, err := c.resolveToolCalls(ctx, settings, nextResp, usage)
+		// ツール呼び出し情報をマージ（エラーの場合も実行済みのツール呼び出しを返す）
+		allToolCalls := append(toolCalls, nextToolCalls...)
 		if err != nil {
-			return "", toolCalls, "", err
+			return "", allToolCalls, "", err
 		}
-		// ツール呼び出し情報をマージ
-		allToolCalls := append(toolCalls, nextToolCalls...)
 		return nextText, allToolCalls, lastRespID, nil
 	}
 
@@ -172,7 +264,260 @@ func (c *OpenAIClient) resolveToolCalls(ctx context.Context, resp *responses.Res
 	return resp.OutputText(), toolCalls, resp.ID, nil
 }
 
+// newResponseParams はResponses APIのリクエストパラメータを組み立てる
+func (c *OpenAIClient) newResponseParams(settings ModelSettings, input responses.ResponseInputParam, previousResponseID string) responses.ResponseNewParams {
+	params := responses.ResponseNewParams{
+		Instructions: openai.String(c.config.instructions),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: input,
+		},
+		Tools: tools.GetAllToolParams(),
+	}
+	settings.applyTo(&params)
+
+	if previousResponseID != "" {
+		params.PreviousResponseID = openai.String(previousResponseID)
+	}
+
+	return params
+}
+
+// createResponse はResponses APIを呼び出す
+func (c *OpenAIClient) createResponse(ctx context.Context, params responses.ResponseNewParams) (*responses.Response, error) {
+	start := time.Now()
+	resp, err := c.client.Responses.New(ctx, params)
+	if err != nil {
+		c.config.logger.ErrorContext(ctx, "response API call failed",
+			"model", params.Model, "duration", time.Since(start), "error", err)
+		return nil, fmt.Errorf("failed to call response API: %w", err)
+	}
+
+	c.config.logger.DebugContext(ctx, "response API call completed",
+		"response_id", resp.ID,
+		"model", resp.Model,
+		"status", resp.Status,
+		"duration", time.Since(start),
+		"input_tokens", resp.Usage.InputTokens,
+		"output_tokens", resp.Usage.OutputTokens,
+	)
+
+	return resp, nil
+}
+
 func (c *OpenAIClient) handleFunctionCall(ctx context.Context, item responses.ResponseFunctionToolCall) (string, error) {
-	fmt.Fprintf(c.config.debugOutput, "function called: %s\n", item.Name)
-	return tools.CallFunction(ctx, item.Name, item.Arguments)
+	logger := c.config.logger.With("tool", item.Name, "call_id", item.CallID)
+	logger.DebugContext(ctx, "tool call started", "arguments", item.Arguments)
+
+	var opts []tools.Option
+	if c.config.redactor != nil {
+		opts = append(opts, tools.WithDeniedPath(c.config.redactor.Denied))
+	}
+
+	start := time.Now()
+	result, err := tools.CallFunction(ctx, item.Name, item.Arguments, opts...)
+	if err != nil {
+		logger.WarnContext(ctx, "tool call failed", "duration", time.Since(start), "error", err)
+		return "", err
+	}
+
+	logger.InfoContext(ctx, "tool call completed", "duration", time.Since(start), "result_bytes", len(result))
+	return result, nil
+}
+
+// redactToolResult はツールの実行結果から秘密情報を伏せ、伏せた場合はモデルへの注記を末尾に加える
+func (c *OpenAIClient) redactToolResult(ctx context.Context, item responses.ResponseFunctionToolCall, result string) string {
+	if c.config.redactor == nil {
+		return result
+	}
+
+	redacted, findings := c.config.redactor.RedactJSON(result)
+	if len(findings) == 0 {
+		return result
+	}
+
+	detectors := make([]string, 0, len(findings))
+	for _, f := range findings {
+		detectors = append(detectors, f.Detector)
+	}
+	c.config.logger.WarnContext(ctx, "secrets redacted from tool result",
+		"tool", item.Name, "call_id", item.CallID, "detectors", detectors)
+
+	return redacted + "\n\n" + redact.Notice(findings)
+}
+
+// SessionUsage はセッション全体のトークン使用量を集計する
+func (c *OpenAIClient) SessionUsage(ctx context.Context, sessionID session.SessionID) (*session.Usage, error) {
+	turns, err := c.sessionStore.List(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation history: %w", err)
+	}
+
+	usage := session.SumUsage(turns)
+
+	// タイトルの生成に使ったトークンはセッションのメタデータに記録している
+	metadata, err := c.sessionStore.GetMetadata(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session metadata: %w", err)
+	}
+	if title := session.TitleUsage(metadata); title != nil {
+		usage.Add(*title)
+	}
+	return &usage, nil
+}
+
+// newSessionMetadata は新しいセッションに記録するタイトルとワークスペースを返す
+// タイトルはユーザーの発言から作る（タイトル用のモデルが指定されている場合は後で置き換える）。タイトルが設定済みの場合は含めない
+func (c *OpenAIClient) newSessionMetadata(ctx context.Context, sessionID session.SessionID, userInput string) map[string]string {
+	metadata := make(map[string]string)
+	if c.config.workspace.Path != "" {
+		maps.Copy(metadata, c.config.workspace.Metadata())
+	}
+
+	current, err := c.sessionStore.GetMetadata(ctx, sessionID)
+	if err != nil {
+		c.config.logger.WarnContext(ctx, "failed to get session metadata", "session_id", sessionID, "error", err)
+		return metadata
+	}
+	if current[session.TitleMetadataKey] != "" {
+		return metadata
+	}
+
+	metadata[session.TitleMetadataKey] = heuristicTitle(userInput)
+	return metadata
+}
+
+// Wait はバックグラウンドで生成中のセッションのタイトルが保存されるまで待つ
+// セッションストアを閉じる前に呼び出す
+func (c *OpenAIClient) Wait() {
+	c.titles.Wait()
+}
+
+// SessionTitle はセッションのタイトルを返す（未設定の場合は空）
+func (c *OpenAIClient) SessionTitle(ctx context.Context, sessionID session.SessionID) (string, error) {
+	metadata, err := c.sessionStore.GetMetadata(ctx, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get session metadata: %w", err)
+	}
+	return metadata[session.TitleMetadataKey], nil
+}
+
+// SetSessionTitle はセッションのタイトルを変更する
+func (c *OpenAIClient) SetSessionTitle(ctx context.Context, sessionID session.SessionID, title string) (string, error) {
+	title = normalizeTitle(title)
+	if title == "" {
+		return "", fmt.Errorf("title must not be empty")
+	}
+	if err := c.sessionStore.SetMetadata(ctx, sessionID, map[string]string{session.TitleMetadataKey: title}); err != nil {
+		return "", fmt.Errorf("failed to save session title: %w", err)
+	}
+	return title, nil
+}
+
+// ListSessions はセッションの概要を更新日時の新しい順に返す
+// all が false の場合は現在のワークスペースのセッションだけを返す
+func (c *OpenAIClient) ListSessions(ctx context.Context, all bool) ([]session.SessionInfo, error) {
+	if all || c.config.workspace.Path == "" {
+		return c.sessionStore.Sessions(ctx)
+	}
+	return session.WorkspaceSessions(ctx, c.sessionStore, c.config.workspace)
+}
+
+// SearchSessions は過去のセッションを全文検索する
+func (c *OpenAIClient) SearchSessions(ctx context.Context, query string) ([]session.SearchResult, error) {
+	searcher, ok := c.sessionStore.(session.Searcher)
+	if !ok {
+		return nil, session.ErrSearchUnavailable
+	}
+	return searcher.Search(ctx, query, session.DefaultSearchLimit)
+}
+
+// ForkSession はセッションの先頭から exchanges 往復分の会話を新しいセッションにコピーする
+// exchanges が0以下の場合は全ての会話をコピーする。
+// 往復の区切り（アシスタントのターン）で分岐するため、新しいセッションはその時点の応答から会話を続けられる
+func (c *OpenAIClient) ForkSession(ctx context.Context, sessionID session.SessionID, exchanges int) (session.SessionID, error) {
+	turns := 0
+	if exchanges > 0 {
+		history, err := c.sessionStore.List(ctx, sessionID)
+		if err != nil {
+			return "", fmt.Errorf("failed to list conversation history: %w", err)
+		}
+
+		count := 0
+		for i, turn := range history {
+			if turn.Role != "assistant" {
+				continue
+			}
+			count++
+			if count == exchanges {
+				turns = i + 1
+				break
+			}
+		}
+		if turns == 0 {
+			return "", fmt.Errorf("cannot fork at turn %d: session has only %d turns", exchanges, count)
+		}
+	}
+
+	forkID, err := c.sessionStore.Fork(ctx, sessionID, turns)
+	if err != nil {
+		return "", fmt.Errorf("failed to fork session: %w", err)
+	}
+	return forkID, nil
+}
+
+// ModelSettings はセッションで使用するモデル設定を返す
+// セッションに設定が保存されていなければ既定の設定を返す（既定の設定は最初の応答と一緒に保存する）
+func (c *OpenAIClient) ModelSettings(ctx context.Context, sessionID session.SessionID) (ModelSettings, error) {
+	settings, _, err := c.modelSettings(ctx, sessionID)
+	return settings, err
+}
+
+// modelSettings はセッションで使用するモデル設定と、それがセッションに保存されているかを返す
+func (c *OpenAIClient) modelSettings(ctx context.Context, sessionID session.SessionID) (ModelSettings, bool, error) {
+	metadata, err := c.sessionStore.GetMetadata(ctx, sessionID)
+	if err != nil {
+		return ModelSettings{}, false, fmt.Errorf("failed to get session metadata: %w", err)
+	}
+
+	settings, ok, err := modelSettingsFromMetadata(metadata)
+	if err != nil {
+		return ModelSettings{}, false, err
+	}
+	if ok {
+		return settings, true, nil
+	}
+	return c.config.modelSettings, false, nil
+}
+
+// DescribeModel はセッションのモデル設定を表示用の文字列で返す
+func (c *OpenAIClient) DescribeModel(ctx context.Context, sessionID session.SessionID) (string, error) {
+	settings, err := c.ModelSettings(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	return settings.String(), nil
+}
+
+// SwitchModel は "/model" コマンドの引数に従ってセッションのモデル設定を変更する
+func (c *OpenAIClient) SwitchModel(ctx context.Context, sessionID session.SessionID, args []string) (string, error) {
+	current, err := c.ModelSettings(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	settings, err := ParseModelSettingArgs(current, args)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.sessionStore.SetMetadata(ctx, sessionID, settings.toMetadata()); err != nil {
+		return "", fmt.Errorf("failed to save model settings: %w", err)
+	}
+
+	return settings.String(), nil
+}
+
+// EffectivePrompt は実際に送信されるシステムプロンプトを返す
+func (c *OpenAIClient) EffectivePrompt() string {
+	return c.config.instructions
 }
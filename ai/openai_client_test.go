@@ -0,0 +1,154 @@
+package ai_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jinford/coding-agent-example/ai"
+	"github.com/jinford/coding-agent-example/ai/replay"
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// newReplayClient はフィクスチャを再生するOpenAIClientを作成する
+func newReplayClient(t *testing.T, fixture string, store session.Store) (*ai.OpenAIClient, *replay.Replayer) {
+	t.Helper()
+
+	replayer, err := replay.LoadReplayer(filepath.Join("testdata", "fixtures", fixture))
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	client := ai.NewOpenAIClient("test-api-key", store, ai.WithRequestOptions(
+		option.WithHTTPClient(&http.Client{Transport: replayer}),
+		option.WithMaxRetries(0),
+	))
+
+	return client, replayer
+}
+
+func TestGenerateResponse_ToolLoop(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	client, replayer := newReplayClient(t, "tool_loop.json", store)
+	sessionID := session.NewSessionID()
+
+	out, err := client.GenerateResponse(ctx, "testdata/hello.txt を読んで", sessionID)
+	if err != nil {
+		t.Fatalf("GenerateResponse returned error: %v", err)
+	}
+	if !strings.Contains(out, "Hello, fixture!") {
+		t.Errorf("unexpected response: %q", out)
+	}
+	if n := replayer.Remaining(); n != 0 {
+		t.Errorf("%d interactions were not replayed", n)
+	}
+
+	// ツールの実行結果が2回目のリクエストで返されていること
+	requests := replayer.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	var second struct {
+		PreviousResponseID string `json:"previous_response_id"`
+		Input              []struct {
+			Type   string `json:"type"`
+			CallID string `json:"call_id"`
+			Output string `json:"output"`
+		} `json:"input"`
+	}
+	if err := json.Unmarshal(requests[1].Body, &second); err != nil {
+		t.Fatalf("failed to parse second request: %v", err)
+	}
+	if second.PreviousResponseID != "resp_tool_1" {
+		t.Errorf("previous_response_id = %q, want %q", second.PreviousResponseID, "resp_tool_1")
+	}
+	if len(second.Input) != 1 || second.Input[0].Type != "function_call_output" || second.Input[0].CallID != "call_1" {
+		t.Fatalf("unexpected tool output input: %+v", second.Input)
+	}
+	if !strings.Contains(second.Input[0].Output, "Hello, fixture!") {
+		t.Errorf("tool output does not contain file content: %q", second.Input[0].Output)
+	}
+
+	// セッションにユーザーとアシスタントのターンが保存されていること
+	turns, err := store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("failed to list turns: %v", err)
+	}
+	if len(turns) != 2 {
+		t.Fatalf("expected 2 turns, got %d", len(turns))
+	}
+	if turns[0].Role != "user" || turns[1].Role != "assistant" {
+		t.Errorf("unexpected roles: %q, %q", turns[0].Role, turns[1].Role)
+	}
+
+	assistant := turns[1]
+	if len(assistant.ToolCalls) != 1 || assistant.ToolCalls[0].Name != "read_file" {
+		t.Fatalf("unexpected tool calls: %+v", assistant.ToolCalls)
+	}
+	if !strings.Contains(assistant.ToolCalls[0].Result, "Hello, fixture!") {
+		t.Errorf("tool call result not recorded: %q", assistant.ToolCalls[0].Result)
+	}
+	if got := assistant.Metadata["previous_response_id"]; got != "resp_tool_2" {
+		t.Errorf("previous_response_id metadata = %q, want %q", got, "resp_tool_2")
+	}
+
+	// 2回のAPI呼び出しの使用量が合算されていること
+	if assistant.Usage == nil {
+		t.Fatal("usage is not recorded")
+	}
+	if assistant.Usage.InputTokens != 2100 || assistant.Usage.CachedTokens != 1200 || assistant.Usage.OutputTokens != 50 {
+		t.Errorf("unexpected usage: %+v", assistant.Usage)
+	}
+	if assistant.Usage.CostUSD <= 0 {
+		t.Errorf("cost is not estimated: %+v", assistant.Usage)
+	}
+}
+
+func TestGenerateResponse_ContinuesFromPreviousResponse(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	client, replayer := newReplayClient(t, "continuation.json", store)
+	sessionID := session.NewSessionID()
+
+	if _, err := client.GenerateResponse(ctx, "覚えておいて", sessionID); err != nil {
+		t.Fatalf("first GenerateResponse returned error: %v", err)
+	}
+	out, err := client.GenerateResponse(ctx, "続けて", sessionID)
+	if err != nil {
+		t.Fatalf("second GenerateResponse returned error: %v", err)
+	}
+	if out != "先ほどの続きです。" {
+		t.Errorf("unexpected response: %q", out)
+	}
+
+	requests := replayer.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+	var last struct {
+		PreviousResponseID string `json:"previous_response_id"`
+		Model              string `json:"model"`
+	}
+	if err := json.Unmarshal(requests[2].Body, &last); err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+	if last.PreviousResponseID != "resp_first" {
+		t.Errorf("previous_response_id = %q, want %q", last.PreviousResponseID, "resp_first")
+	}
+	if last.Model != ai.DefaultModelSettings().Model {
+		t.Errorf("model = %q, want %q", last.Model, ai.DefaultModelSettings().Model)
+	}
+
+	usage, err := client.SessionUsage(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("SessionUsage returned error: %v", err)
+	}
+	if usage.InputTokens != 1100 || usage.OutputTokens != 13 {
+		t.Errorf("unexpected session usage: %+v", usage)
+	}
+}
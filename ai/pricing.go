@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/openai/openai-go/v3/responses"
+)
+
+// ModelPricing はモデルごとの100万トークンあたりの料金（USD）
+type ModelPricing struct {
+	Input       float64 // 入力トークン
+	CachedInput float64 // キャッシュされた入力トークン
+	Output      float64 // 出力トークン（推論トークンを含む）
+}
+
+// defaultPricingTable は既定の料金表
+var defaultPricingTable = map[string]ModelPricing{
+	"gpt-4.1":      {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"gpt-4.1-mini": {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+	"gpt-4.1-nano": {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"gpt-4o":       {Input: 2.50, CachedInput: 1.25, Output: 10.00},
+	"gpt-4o-mini":  {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	"o3":           {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"o4-mini":      {Input: 1.10, CachedInput: 0.275, Output: 4.40},
+	"gpt-5":        {Input: 1.25, CachedInput: 0.125, Output: 10.00},
+	"gpt-5-mini":   {Input: 0.25, CachedInput: 0.025, Output: 2.00},
+	"gpt-5-nano":   {Input: 0.05, CachedInput: 0.005, Output: 0.40},
+}
+
+// lookupPricing はモデル名に対応する料金を探す
+// "gpt-4.1-2025-04-14" のような日付付きのモデル名は、最も長く一致する接頭辞のモデルとして扱う
+func lookupPricing(table map[string]ModelPricing, model string) (ModelPricing, bool) {
+	if pricing, ok := table[model]; ok {
+		return pricing, true
+	}
+
+	var (
+		best    ModelPricing
+		bestLen int
+	)
+	for name, pricing := range table {
+		if strings.HasPrefix(model, name+"-") && len(name) > bestLen {
+			best = pricing
+			bestLen = len(name)
+		}
+	}
+
+	return best, bestLen > 0
+}
+
+// estimateCost はトークン使用量からコスト（USD）を見積もる
+// 料金表にないモデルの場合は0を返す
+func estimateCost(table map[string]ModelPricing, usage session.Usage) float64 {
+	pricing, ok := lookupPricing(table, usage.Model)
+	if !ok {
+		return 0
+	}
+
+	uncached := usage.InputTokens - usage.CachedTokens
+	cost := float64(uncached)*pricing.Input +
+		float64(usage.CachedTokens)*pricing.CachedInput +
+		float64(usage.OutputTokens)*pricing.Output
+
+	return cost / 1_000_000
+}
+
+// usageFromResponse はレスポンスのトークン使用量を取り出し、コストを見積もる
+func (c *OpenAIClient) usageFromResponse(resp *responses.Response) session.Usage {
+	usage := session.Usage{
+		Model:           resp.Model,
+		InputTokens:     resp.Usage.InputTokens,
+		CachedTokens:    resp.Usage.InputTokensDetails.CachedTokens,
+		OutputTokens:    resp.Usage.OutputTokens,
+		ReasoningTokens: resp.Usage.OutputTokensDetails.ReasoningTokens,
+	}
+	usage.CostUSD = estimateCost(c.config.pricingTable, usage)
+	return usage
+}
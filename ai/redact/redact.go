@@ -0,0 +1,352 @@
+// Package redact はツールの実行結果に含まれる秘密情報を検出して伏せる
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// CustomDetector は WithPatterns で追加したパターンの検出器の名前
+const CustomDetector = "custom_pattern"
+
+// MarkerPrefix は伏せた箇所の印（[REDACTED:検出器の名前]）の先頭
+const MarkerPrefix = "[REDACTED:"
+
+// DefaultDeniedPaths は既定で読み込みを拒否するファイル・ディレクトリ名のパターン
+var DefaultDeniedPaths = []string{
+	".env",
+	".env.*",
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"id_rsa",
+	"id_dsa",
+	"id_ecdsa",
+	"id_ed25519",
+	".netrc",
+	".pgpass",
+	".git-credentials",
+	".ssh",
+	".aws",
+}
+
+// Finding は検出した秘密情報の種類と件数
+type Finding struct {
+	Detector string // 検出器の名前（伏せた箇所の印に使う）
+	Count    int    // 伏せた件数
+}
+
+// detector は秘密情報の検出器
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	group int               // 伏せるサブマッチの番号（0 の場合はマッチ全体）
+	check func(string) bool // 伏せる部分の追加の判定（nil の場合はマッチした部分を全て伏せる）
+}
+
+// builtinDetectors は組み込みの検出器（適用順）
+// 具体的な形式の検出器を先に適用し、汎用的な検出器が伏せた後の印に反応しないようにする
+var builtinDetectors = []detector{
+	{
+		name: "private_key",
+		re:   regexp.MustCompile(`(?s)-----BEGIN[A-Z0-9 ]* PRIVATE KEY[A-Z ]*-----.*?(?:-----END[A-Z0-9 ]* PRIVATE KEY[A-Z ]*-----|\z)`),
+	},
+	{
+		name: "aws_access_key",
+		re:   regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+	},
+	{
+		name: "jwt",
+		re:   regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	},
+	{
+		name: "github_token",
+		re:   regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`),
+	},
+	{
+		name: "openai_api_key",
+		re:   regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`),
+	},
+	{
+		name: "slack_token",
+		re:   regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	},
+	{
+		// password=... や "api_key": "..." のような代入の値
+		name:  "secret_assignment",
+		re:    regexp.MustCompile(`(?i)[a-z0-9_.-]*(?:secret|passwd|password|token|api[_-]?key|access[_-]?key|private[_-]?key)[a-z0-9_.-]*["']?\s*[:=]\s*["']?([^\s"'\\,;]{8,})`),
+		group: 1,
+		check: isSecretValue,
+	},
+	{
+		// ハッシュ値の接頭辞を含めてマッチさせ、チェックサムの形式は除く
+		name:  "high_entropy",
+		re:    regexp.MustCompile(`(?:h1:)?[A-Za-z0-9+/_=-]{24,}`),
+		check: func(s string) bool { return !checksumPrefix.MatchString(s) && isHighEntropy(s) },
+	},
+}
+
+// Redactor はテキストから秘密情報を検出して伏せる
+type Redactor struct {
+	detectors   []detector
+	deniedPaths []string
+}
+
+// Option は Redactor の検出対象を追加するオプション
+type Option func(*options)
+
+type options struct {
+	patterns    []string
+	deniedPaths []string
+}
+
+// WithPatterns は秘密情報として伏せる正規表現を追加する
+// サブマッチを含む場合は最初のサブマッチだけを伏せる
+func WithPatterns(patterns ...string) Option {
+	return func(o *options) {
+		o.patterns = append(o.patterns, patterns...)
+	}
+}
+
+// WithDeniedPaths は読み込みを拒否するファイル・ディレクトリ名のパターンを DefaultDeniedPaths に追加する
+// パターンは path.Match の形式で、パスの各要素と照合する
+func WithDeniedPaths(patterns ...string) Option {
+	return func(o *options) {
+		o.deniedPaths = append(o.deniedPaths, patterns...)
+	}
+}
+
+// Default は組み込みの検出器と DefaultDeniedPaths を使う Redactor を返す
+func Default() *Redactor {
+	return &Redactor{
+		detectors:   builtinDetectors,
+		deniedPaths: DefaultDeniedPaths,
+	}
+}
+
+// New は組み込みの検出器にオプションで指定したパターンを加えた Redactor を作成する
+func New(opts ...Option) (*Redactor, error) {
+	var o options
+	for _, f := range opts {
+		f(&o)
+	}
+
+	r := Default()
+	for _, pattern := range o.patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		r.detectors = append(r.detectors, detector{name: CustomDetector, re: re, group: group})
+	}
+	for _, pattern := range o.deniedPaths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid denied path pattern %q: %w", pattern, err)
+		}
+	}
+	r.deniedPaths = append(append([]string{}, DefaultDeniedPaths...), o.deniedPaths...)
+
+	return r, nil
+}
+
+// Denied はパスが読み込みを拒否するファイル・ディレクトリを指すかを返す
+// パスのいずれかの要素が拒否するパターンに一致する場合に拒否する
+func (r *Redactor) Denied(p string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(filepath.Clean(p)), "/") {
+		for _, pattern := range r.deniedPaths {
+			if ok, _ := path.Match(pattern, elem); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Redact はテキストに含まれる秘密情報を [REDACTED:検出器の名前] に置き換え、検出した秘密情報を返す
+func (r *Redactor) Redact(text string) (string, []Finding) {
+	var findings []Finding
+	for _, d := range r.detectors {
+		var count int
+		text, count = d.replace(text)
+		if count > 0 {
+			findings = addFinding(findings, d.name, count)
+		}
+	}
+	return text, findings
+}
+
+// RedactJSON はJSONの文字列の値に含まれる秘密情報を伏せる
+// 秘密情報がない場合は元のテキストをそのまま返す。JSONとして解析できない場合はテキスト全体を対象にする
+func (r *Redactor) RedactJSON(text string) (string, []Finding) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return r.Redact(text)
+	}
+
+	var findings []Finding
+	value = r.redactValue(value, &findings)
+	if len(findings) == 0 {
+		return text, nil
+	}
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return r.Redact(text)
+	}
+	return string(redacted), findings
+}
+
+// redactValue はJSONの値に含まれる文字列を再帰的に伏せる
+func (r *Redactor) redactValue(value any, findings *[]Finding) any {
+	switch v := value.(type) {
+	case string:
+		redacted, found := r.Redact(v)
+		for _, f := range found {
+			*findings = addFinding(*findings, f.Detector, f.Count)
+		}
+		return redacted
+	case map[string]any:
+		for key, elem := range v {
+			v[key] = r.redactValue(elem, findings)
+		}
+		return v
+	case []any:
+		for i, elem := range v {
+			v[i] = r.redactValue(elem, findings)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// CountMarkers はテキストに含まれる伏せた箇所の印の数を返す
+// 伏せた内容をそのままファイルに書き戻していないかの確認に使う
+func CountMarkers(text string) int {
+	return strings.Count(text, MarkerPrefix)
+}
+
+// Notice は秘密情報を伏せたことをモデルに伝える注記を返す
+func Notice(findings []Finding) string {
+	kinds := make([]string, 0, len(findings))
+	for _, f := range findings {
+		kinds = append(kinds, fmt.Sprintf("%s ×%d", f.Detector, f.Count))
+	}
+	return fmt.Sprintf("[注意] 秘密情報の可能性がある値を伏せました（%s）。伏せた箇所は [REDACTED:種類] に置き換えています。元の値が必要な場合はユーザーに確認してください。",
+		strings.Join(kinds, ", "))
+}
+
+// replace はテキスト中の検出した部分を印に置き換え、置き換えた件数を返す
+func (d detector) replace(text string) (string, int) {
+	matches := d.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, 0
+	}
+
+	var (
+		b     strings.Builder
+		last  int
+		count int
+	)
+	marker := MarkerPrefix + d.name + "]"
+	for _, m := range matches {
+		start, end := m[2*d.group], m[2*d.group+1]
+		if start < 0 || (d.check != nil && !d.check(text[start:end])) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(marker)
+		last = end
+		count++
+	}
+	if count == 0 {
+		return text, 0
+	}
+	b.WriteString(text[last:])
+	return b.String(), count
+}
+
+// addFinding は検出器ごとの件数を加算する
+func addFinding(findings []Finding, name string, count int) []Finding {
+	for i := range findings {
+		if findings[i].Detector == name {
+			findings[i].Count += count
+			return findings
+		}
+	}
+	return append(findings, Finding{Detector: name, Count: count})
+}
+
+// isSecretValue は代入の値が秘密情報らしいかを返す
+// 変数や関数呼び出しなどのコードを除くため、数字を含みコードに使う記号を含まない値だけを対象とする。
+// n.inputTokens.Int64 のようなフィールドの参照や、tokenValue1 のような末尾だけに数字を含む識別子も除く
+func isSecretValue(value string) bool {
+	if strings.HasPrefix(value, "=") || strings.ContainsAny(value, "()[]{}<>$") {
+		return false
+	}
+	if selectorExpr.MatchString(value) || codeIdentifier.MatchString(value) {
+		return false
+	}
+	return strings.ContainsFunc(value, unicode.IsDigit)
+}
+
+// コードの式とみなす代入の値
+var (
+	// selectorExpr は識別子を . でつないだフィールドやパッケージの参照
+	selectorExpr = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)+$`)
+	// codeIdentifier は数字を末尾だけに含む識別子（数字の後に文字が続く hunter2hunter2 のような値は含めない）
+	codeIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z_]*[0-9]*$`)
+)
+
+// checksumPrefix はファイルの内容の一部として扱うハッシュ値の形式
+// go.sum の h1: や、package-lock.json などの integrity の sha512- はランダムな文字列に見えるが秘密情報ではない
+var checksumPrefix = regexp.MustCompile(`^(?:h1:|sha(?:1|256|384|512)-)`)
+
+// minEntropy は high_entropy で伏せる文字列の1文字あたりのエントロピー（ビット）の下限
+// 16進数の文字列（ハッシュ値やUUID）は最大でも4ビットのため対象にならない
+const minEntropy = 4.2
+
+// isHighEntropy はランダムに生成されたトークンらしい文字列かを返す
+// 識別子やパスを除くため、大文字・小文字・数字を全て含む文字列だけを対象とする
+func isHighEntropy(s string) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case 'A' <= c && c <= 'Z':
+			upper = true
+		case 'a' <= c && c <= 'z':
+			lower = true
+		case '0' <= c && c <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit && shannonEntropy(s) >= minEntropy
+}
+
+// shannonEntropy は文字列の1文字あたりのシャノンエントロピーを返す
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	var entropy float64
+	n := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,262 @@
+// Package replay はHTTPのやり取りをフィクスチャファイルに記録・再生する http.RoundTripper を提供する
+//
+// Recorder で実際のAPIとのやり取りを記録し、Replayer で記録した順にレスポンスを返すことで、
+// ネットワークに接続せずに OpenAIClient の動作を決定的にテストできる
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Fixture は記録されたHTTPのやり取りの一覧
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction は1回分のリクエストとレスポンス
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request は記録されたリクエスト
+// 認証情報を残さないため、ヘッダーは記録しない
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Response は記録されたレスポンス
+type Response struct {
+	StatusCode  int             `json:"status_code"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// LoadFixture はフィクスチャファイルを読み込む
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture %q: %w", path, err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %q: %w", path, err)
+	}
+
+	return &fixture, nil
+}
+
+// Save はフィクスチャファイルに書き込む（ディレクトリがなければ作成する）
+func (f *Fixture) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// Recorder は実際のトランスポートにリクエストを転送し、やり取りを記録する
+type Recorder struct {
+	transport http.RoundTripper
+
+	mu      sync.Mutex
+	fixture Fixture
+}
+
+// NewRecorder は新しいRecorderを作成する
+// transport が nil の場合は http.DefaultTransport を使用する
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{transport: transport}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fixture.Interactions = append(r.fixture.Interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Body:   toRawJSON(reqBody),
+		},
+		Response: Response{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        toRawJSON(respBody),
+		},
+	})
+
+	return resp, nil
+}
+
+// Fixture はこれまでに記録したやり取りを返す
+func (r *Recorder) Fixture() *Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Fixture{Interactions: append([]Interaction(nil), r.fixture.Interactions...)}
+}
+
+// Save はこれまでに記録したやり取りをフィクスチャファイルに書き込む
+func (r *Recorder) Save(path string) error {
+	return r.Fixture().Save(path)
+}
+
+// Replayer は記録されたやり取りを記録順に再生する
+// リクエストのメソッドとパスが記録と異なる場合はエラーを返す
+type Replayer struct {
+	mu       sync.Mutex
+	fixture  *Fixture
+	next     int
+	requests []Request
+}
+
+// NewReplayer はフィクスチャを再生するReplayerを作成する
+func NewReplayer(fixture *Fixture) *Replayer {
+	return &Replayer{fixture: fixture}
+}
+
+// LoadReplayer はフィクスチャファイルを読み込んでReplayerを作成する
+func LoadReplayer(path string) (*Replayer, error) {
+	fixture, err := LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(fixture), nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Body:   toRawJSON(reqBody),
+	})
+
+	if r.next >= len(r.fixture.Interactions) {
+		return nil, fmt.Errorf("replay: no more recorded interactions for %s %s", req.Method, req.URL.Path)
+	}
+
+	interaction := r.fixture.Interactions[r.next]
+	if interaction.Request.Method != req.Method || interaction.Request.Path != req.URL.Path {
+		return nil, fmt.Errorf("replay: interaction #%d expected %s %s, got %s %s",
+			r.next, interaction.Request.Method, interaction.Request.Path, req.Method, req.URL.Path)
+	}
+	r.next++
+
+	body := fromRawJSON(interaction.Response.Body)
+	header := make(http.Header)
+	if interaction.Response.ContentType != "" {
+		header.Set("Content-Type", interaction.Response.ContentType)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Requests は受け取ったリクエストを受信順に返す
+func (r *Replayer) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Request(nil), r.requests...)
+}
+
+// Remaining はまだ再生されていないやり取りの数を返す
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.fixture.Interactions) - r.next
+}
+
+// readBody はボディを全て読み込み、再度読めるように差し替える
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+// toRawJSON はボディをJSONとして記録する。JSONでない場合は文字列として記録する
+func toRawJSON(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	quoted, _ := json.Marshal(string(data))
+	return json.RawMessage(quoted)
+}
+
+// fromRawJSON は toRawJSON で記録したボディを元のバイト列に戻す
+func fromRawJSON(raw json.RawMessage) []byte {
+	var s string
+	if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return []byte(s)
+	}
+	return raw
+}
@@ -0,0 +1,91 @@
+package replay_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jinford/coding-agent-example/ai/replay"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `","echo":` + string(body) + `}`))
+	}))
+	defer server.Close()
+
+	// 実際のサーバーとのやり取りを記録
+	recorder := replay.NewRecorder(nil)
+	recordClient := &http.Client{Transport: recorder}
+	resp, err := recordClient.Post(server.URL+"/v1/responses", "application/json", strings.NewReader(`{"n":1}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	recorded, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("failed to save fixture: %v", err)
+	}
+
+	// サーバーを使わずに再生
+	replayer, err := replay.LoadReplayer(path)
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	replayClient := &http.Client{Transport: replayer}
+	resp, err = replayClient.Post("https://example.invalid/v1/responses", "application/json", strings.NewReader(`{"n":1}`))
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	replayed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// フィクスチャは整形して保存されるため、JSONとして比較する
+	var want, got any
+	if err := json.Unmarshal(recorded, &want); err != nil {
+		t.Fatalf("recorded body is not JSON: %v", err)
+	}
+	if err := json.Unmarshal(replayed, &got); err != nil {
+		t.Fatalf("replayed body is not JSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed body = %s, want %s", replayed, recorded)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("remaining = %d, want 0", replayer.Remaining())
+	}
+
+	// 記録にないリクエストはエラーになる
+	if _, err := replayClient.Get("https://example.invalid/v1/responses"); err == nil {
+		t.Error("expected error for exhausted fixture")
+	}
+}
+
+func TestReplayer_RejectsMismatchedRequest(t *testing.T) {
+	replayer := replay.NewReplayer(&replay.Fixture{
+		Interactions: []replay.Interaction{{
+			Request:  replay.Request{Method: http.MethodPost, Path: "/v1/responses"},
+			Response: replay.Response{StatusCode: http.StatusOK},
+		}},
+	})
+
+	client := &http.Client{Transport: replayer}
+	if _, err := client.Get("https://example.invalid/v1/responses/resp_1"); err == nil {
+		t.Fatal("expected error for mismatched request")
+	}
+	if replayer.Remaining() != 1 {
+		t.Errorf("mismatched request must not consume the interaction")
+	}
+}
@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/responses"
+)
+
+// maxTitleRunes はセッションのタイトルの最大文字数（切り詰めた場合の … を除く）
+const maxTitleRunes = 40
+
+// titleExcerptRunes はタイトルの生成に使う発言の最大文字数
+const titleExcerptRunes = 1000
+
+// titleTimeout はタイトルを生成するAPI呼び出しのタイムアウト
+const titleTimeout = 10 * time.Second
+
+// titleInstructions はタイトルを生成するモデルへの指示
+const titleInstructions = `あなたは会話にタイトルを付けるアシスタントです。
+ユーザーとアシスタントの最初のやり取りを読み、会話の目的が分かる20文字程度のタイトルを1つだけ出力してください。
+ユーザーの発言と同じ言語で書き、引用符・句点・説明は付けないでください。`
+
+// updateTitleInBackground はタイトル用のモデルでセッションのタイトルを生成し、仮のタイトルを置き換える
+// 最初の応答を待たせないよう、会話履歴を保存した後にバックグラウンドで実行する（Wait で終了を待てる）
+func (c *OpenAIClient) updateTitleInBackground(ctx context.Context, sessionID session.SessionID, userInput, response, placeholder string) {
+	c.titles.Add(1)
+	go func() {
+		defer c.titles.Done()
+		c.updateTitle(context.WithoutCancel(ctx), sessionID, userInput, response, placeholder)
+	}()
+}
+
+// updateTitle は生成したタイトルとその使用量をセッションに保存する
+// 生成している間にユーザーがタイトルを変更した場合は上書きしない
+func (c *OpenAIClient) updateTitle(ctx context.Context, sessionID session.SessionID, userInput, response, placeholder string) {
+	title, usage := c.generateTitle(ctx, userInput, response)
+	if usage == nil {
+		return
+	}
+
+	metadata := make(map[string]string)
+	if data, err := json.Marshal(usage); err == nil {
+		metadata[session.TitleUsageMetadataKey] = string(data)
+	}
+	if title != "" {
+		current, err := c.sessionStore.GetMetadata(ctx, sessionID)
+		if err != nil {
+			c.config.logger.WarnContext(ctx, "failed to get session metadata", "session_id", sessionID, "error", err)
+			return
+		}
+		if current[session.TitleMetadataKey] == placeholder {
+			metadata[session.TitleMetadataKey] = title
+		}
+	}
+
+	if err := c.sessionStore.SetMetadata(ctx, sessionID, metadata); err != nil {
+		c.config.logger.WarnContext(ctx, "failed to save session title", "session_id", sessionID, "error", err)
+	}
+}
+
+// generateTitle はタイトル用のモデルで最初の往復からセッションのタイトルを生成する
+// 生成に失敗した場合や空のタイトルが返った場合は空文字列を返す。モデルが応答した場合はそのトークン使用量も返す
+func (c *OpenAIClient) generateTitle(ctx context.Context, userInput, response string) (string, *session.Usage) {
+	ctx, cancel := context.WithTimeout(ctx, titleTimeout)
+	defer cancel()
+
+	conversation := fmt.Sprintf("ユーザー:\n%s\n\nアシスタント:\n%s",
+		session.TruncateRunes(userInput, titleExcerptRunes), session.TruncateRunes(response, titleExcerptRunes))
+	resp, err := c.client.Responses.New(ctx, responses.ResponseNewParams{
+		Model:        c.config.titleModel,
+		Instructions: openai.String(titleInstructions),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: responses.ResponseInputParam{
+				responses.ResponseInputItemParamOfMessage(conversation, responses.EasyInputMessageRoleUser),
+			},
+		},
+		MaxOutputTokens: openai.Int(64),
+		Store:           openai.Bool(false),
+	})
+	if err != nil {
+		c.config.logger.WarnContext(ctx, "failed to generate session title; keeping first message as title",
+			"model", c.config.titleModel, "error", err)
+		return "", nil
+	}
+
+	usage := c.usageFromResponse(resp)
+	return normalizeTitle(resp.OutputText()), &usage
+}
+
+// heuristicTitle はユーザーの発言の最初の行からタイトルを作る
+func heuristicTitle(userInput string) string {
+	for line := range strings.Lines(userInput) {
+		if title := normalizeTitle(line); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// normalizeTitle はタイトルを1行にまとめ、前後の引用符を取り除いて maxTitleRunes 文字に切り詰める
+func normalizeTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	title = strings.Trim(title, "\"'「」『』`")
+	title = strings.TrimPrefix(title, "タイトル:")
+	return session.TruncateRunes(strings.TrimSpace(title), maxTitleRunes)
+}
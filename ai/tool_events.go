@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"github.com/jinford/coding-agent-example/session"
+)
+
+// SubscribeToolEvents implements ui.ToolEventSubscriber.
+// handler は GenerateResponse を呼び出したゴルーチンでツールの実行の前後に呼び出される
+func (c *OpenAIClient) SubscribeToolEvents(handler func(session.ToolEvent)) (unsubscribe func()) {
+	c.subscribersMu.Lock()
+	defer c.subscribersMu.Unlock()
+
+	if c.subscribers == nil {
+		c.subscribers = make(map[int]func(session.ToolEvent))
+	}
+	id := c.nextSubscriber
+	c.nextSubscriber++
+	c.subscribers[id] = handler
+
+	return func() {
+		c.subscribersMu.Lock()
+		defer c.subscribersMu.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+// emitToolEvent はツールの実行イベントを購読者に通知する
+func (c *OpenAIClient) emitToolEvent(event session.ToolEvent) {
+	c.subscribersMu.Lock()
+	handlers := make([]func(session.ToolEvent), 0, len(c.subscribers))
+	for _, handler := range c.subscribers {
+		handlers = append(handlers, handler)
+	}
+	c.subscribersMu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
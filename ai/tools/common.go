@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 
+	"github.com/jinford/coding-agent-example/ai/redact"
 	"github.com/openai/openai-go/v3/responses"
 )
 
@@ -18,7 +20,44 @@ func GetAllToolParams() []responses.ToolUnionParam {
 	}
 }
 
-func CallFunction(ctx context.Context, name string, argsJSONStr string) (string, error) {
+// Option はツールの実行方法を変更するオプション
+type Option func(*options)
+
+type options struct {
+	deniedPath func(path string) bool
+}
+
+// WithDeniedPath は読み込みを拒否するファイル・ディレクトリの判定を指定する
+// read_file は拒否したファイルを読み込まず、grep_file は検索の対象から外す
+func WithDeniedPath(denied func(path string) bool) Option {
+	return func(o *options) {
+		o.deniedPath = denied
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, f := range opts {
+		f(o)
+	}
+	return o
+}
+
+// denied はパスの読み込みを拒否するかを返す
+func (o *options) denied(path string) bool {
+	return o.deniedPath != nil && o.deniedPath(path)
+}
+
+// checkRedactionMarkers は書き込む内容に、元のファイルにない伏せた箇所の印が含まれていないかを確認する
+// 秘密情報を伏せた実行結果をそのまま書き戻すと、元の値が失われてファイルが壊れるため書き込みを拒否する
+func checkRedactionMarkers(path string, original []byte, content []byte) error {
+	if redact.CountMarkers(string(content)) > redact.CountMarkers(string(original)) {
+		return fmt.Errorf("ファイル %q に伏せた値の印 %s...] が含まれるため書き込めません。元の値が必要な場合はユーザーに確認してください", path, redact.MarkerPrefix)
+	}
+	return nil
+}
+
+func CallFunction(ctx context.Context, name string, argsJSONStr string, opts ...Option) (string, error) {
 	switch name {
 	case ToolNameReadFile:
 		var args ReadFileParamsJson
@@ -26,7 +65,7 @@ func CallFunction(ctx context.Context, name string, argsJSONStr string) (string,
 			return "", fmt.Errorf("failed to unmarshal arguments for read_file: %w", err)
 		}
 
-		result, err := ReadFile(ctx, args)
+		result, err := ReadFile(ctx, args, opts...)
 		if err != nil {
 			return "", err
 		}
@@ -60,7 +99,7 @@ func CallFunction(ctx context.Context, name string, argsJSONStr string) (string,
 			return "", fmt.Errorf("failed to unmarshal arguments for grep_file: %w", err)
 		}
 
-		result, err := GrepFile(ctx, args)
+		result, err := GrepFile(ctx, args, opts...)
 		if err != nil {
 			return "", err
 		}
@@ -106,6 +145,7 @@ func CallFunction(ctx context.Context, name string, argsJSONStr string) (string,
 
 		return string(outJSON), nil
 	default:
+		slog.WarnContext(ctx, "unknown tool requested", "name", name)
 		return "", fmt.Errorf("unknown function call: %s", name)
 	}
 }
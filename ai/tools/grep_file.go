@@ -6,6 +6,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -47,10 +48,15 @@ type GrepMatch struct {
 
 type GrepFileOut struct {
 	Matches []GrepMatch `json:"matches"`
+	Denied  []string    `json:"denied,omitempty"` // 秘密情報を含む可能性があるため検索しなかったパス
 }
 
-func GrepFile(_ context.Context, args GrepFileParamsJson) (*GrepFileOut, error) {
-	var matches []GrepMatch
+func GrepFile(ctx context.Context, args GrepFileParamsJson, opts ...Option) (*GrepFileOut, error) {
+	o := newOptions(opts)
+	var (
+		matches []GrepMatch
+		denied  []string
+	)
 	keyword := args.Keyword
 
 	// case_sensitiveがfalseの場合は小文字に変換
@@ -64,6 +70,15 @@ func GrepFile(_ context.Context, args GrepFileParamsJson) (*GrepFileOut, error)
 			return err
 		}
 
+		// 読み込みを拒否するファイル・ディレクトリは検索しない
+		if o.denied(path) {
+			denied = append(denied, path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// ディレクトリはスキップ
 		if info.IsDir() {
 			return nil
@@ -73,6 +88,7 @@ func GrepFile(_ context.Context, args GrepFileParamsJson) (*GrepFileOut, error)
 		file, err := os.Open(path)
 		if err != nil {
 			// 読み込めないファイルはスキップ
+			slog.DebugContext(ctx, "grep skipped unreadable file", "path", path, "error", err)
 			return nil
 		}
 		defer file.Close()
@@ -99,6 +115,7 @@ func GrepFile(_ context.Context, args GrepFileParamsJson) (*GrepFileOut, error)
 
 		if err := scanner.Err(); err != nil {
 			// スキャンエラーは無視して続行
+			slog.DebugContext(ctx, "grep stopped scanning file", "path", path, "error", err)
 			return nil
 		}
 
@@ -109,7 +126,10 @@ func GrepFile(_ context.Context, args GrepFileParamsJson) (*GrepFileOut, error)
 		return nil, fmt.Errorf("ディレクトリ %q の検索に失敗しました: %w", args.Path, err)
 	}
 
+	slog.DebugContext(ctx, "grep completed", "path", args.Path, "keyword", args.Keyword, "matches", len(matches), "denied", len(denied))
+
 	return &GrepFileOut{
 		Matches: matches,
+		Denied:  denied,
 	}, nil
 }
@@ -5,6 +5,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"sync"
 
@@ -45,7 +46,7 @@ type ListFileOut struct {
 	Entries []FileEntry `json:"entries"`
 }
 
-func ListFile(_ context.Context, args ListFileParamsJson) (*ListFileOut, error) {
+func ListFile(ctx context.Context, args ListFileParamsJson) (*ListFileOut, error) {
 	entries, err := os.ReadDir(args.Path)
 	if err != nil {
 		return nil, fmt.Errorf("ディレクトリ %q の読み込みに失敗しました: %w", args.Path, err)
@@ -59,6 +60,8 @@ func ListFile(_ context.Context, args ListFileParamsJson) (*ListFileOut, error)
 		})
 	}
 
+	slog.DebugContext(ctx, "directory listed", "path", args.Path, "entries", len(result))
+
 	return &ListFileOut{
 		Entries: result,
 	}, nil
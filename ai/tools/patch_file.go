@@ -6,6 +6,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 	"sync"
@@ -44,7 +45,7 @@ type PatchFileOut struct {
 	Message string `json:"message"`
 }
 
-func PatchFile(_ context.Context, args PatchFileParamsJson) (*PatchFileOut, error) {
+func PatchFile(ctx context.Context, args PatchFileParamsJson) (*PatchFileOut, error) {
 	// ファイルを読み込む
 	originalContent, err := os.ReadFile(args.Path)
 	if err != nil {
@@ -71,11 +72,19 @@ func PatchFile(_ context.Context, args PatchFileParamsJson) (*PatchFileOut, erro
 		return nil, fmt.Errorf("パッチの適用に失敗しました: %w", err)
 	}
 
+	// 伏せた値を書き戻さない
+	if err := checkRedactionMarkers(args.Path, originalContent, output.Bytes()); err != nil {
+		return nil, err
+	}
+
 	// 結果をファイルに書き戻す
 	if err := os.WriteFile(args.Path, output.Bytes(), 0644); err != nil {
 		return nil, fmt.Errorf("ファイル %q の書き込みに失敗しました: %w", args.Path, err)
 	}
 
+	slog.InfoContext(ctx, "file patched", "path", args.Path,
+		"fragments", len(file.TextFragments), "bytes", output.Len())
+
 	return &PatchFileOut{
 		Success: true,
 		Message: fmt.Sprintf("ファイル %q にパッチを適用しました", args.Path),
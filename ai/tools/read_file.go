@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"sync"
 
@@ -41,7 +42,11 @@ type ReadFileOut struct {
 	Content string `json:"content"`
 }
 
-func ReadFile(_ context.Context, args ReadFileParamsJson) (*ReadFileOut, error) {
+func ReadFile(ctx context.Context, args ReadFileParamsJson, opts ...Option) (*ReadFileOut, error) {
+	if newOptions(opts).denied(args.Path) {
+		return nil, fmt.Errorf("ファイル %q は秘密情報を含む可能性があるため読み込めません", args.Path)
+	}
+
 	file, err := os.Open(args.Path)
 	if err != nil {
 		return nil, fmt.Errorf("ファイル %q のオープンに失敗しました: %w", args.Path, err)
@@ -53,6 +58,8 @@ func ReadFile(_ context.Context, args ReadFileParamsJson) (*ReadFileOut, error)
 		return nil, fmt.Errorf("ファイル %q の読み込みに失敗しました: %w", args.Path, err)
 	}
 
+	slog.DebugContext(ctx, "file read", "path", args.Path, "bytes", len(content))
+
 	return &ReadFileOut{
 		Content: string(content),
 	}, nil
@@ -4,7 +4,10 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
@@ -42,7 +45,16 @@ type WriteFileOut struct {
 	Message string `json:"message"`
 }
 
-func WriteFile(_ context.Context, args WriteFileParamsJson) (*WriteFileOut, error) {
+func WriteFile(ctx context.Context, args WriteFileParamsJson) (*WriteFileOut, error) {
+	// 伏せた値を書き戻さない（既存のファイルに元から含まれる印は除く）
+	original, err := os.ReadFile(args.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("ファイル %q の読み込みに失敗しました: %w", args.Path, err)
+	}
+	if err := checkRedactionMarkers(args.Path, original, []byte(args.Content)); err != nil {
+		return nil, err
+	}
+
 	// ディレクトリが存在しない場合は作成
 	dir := filepath.Dir(args.Path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -54,6 +66,8 @@ func WriteFile(_ context.Context, args WriteFileParamsJson) (*WriteFileOut, erro
 		return nil, fmt.Errorf("ファイル %q の書き込みに失敗しました: %w", args.Path, err)
 	}
 
+	slog.InfoContext(ctx, "file written", "path", args.Path, "bytes", len(args.Content))
+
 	return &WriteFileOut{
 		Success: true,
 		Message: fmt.Sprintf("ファイル %q を正常に作成しました", args.Path),
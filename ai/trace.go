@@ -0,0 +1,92 @@
+package ai
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jinford/coding-agent-example/ai/redact"
+	"github.com/jinford/coding-agent-example/logging"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// newTraceMiddleware はHTTPのリクエストとレスポンスの内容をログに記録するミドルウェアを作成する
+// APIキーなどの秘密情報は伏せて記録する。本文にはユーザーの発言やツールの実行結果が含まれるため、
+// redactor の検出器でも伏せる（nil の場合は組み込みの検出器を使う）
+func newTraceMiddleware(logger *slog.Logger, redactor *redact.Redactor) option.Middleware {
+	if redactor == nil {
+		redactor = redact.Default()
+	}
+	redactBody := func(body []byte) string {
+		redacted, _ := redactor.RedactJSON(string(body))
+		return logging.Redact(redacted)
+	}
+
+	return func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		ctx := req.Context()
+
+		var reqBody []byte
+		if req.Body != nil {
+			var err error
+			reqBody, err = io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = io.NopCloser(bytes.NewReader(reqBody))
+		}
+
+		logger.DebugContext(ctx, "http request",
+			"method", req.Method,
+			"url", req.URL.String(),
+			"headers", redactHeaders(req.Header),
+			"body", redactBody(reqBody),
+		)
+
+		start := time.Now()
+		resp, err := next(req)
+		if err != nil {
+			logger.DebugContext(ctx, "http request failed",
+				"method", req.Method,
+				"url", req.URL.String(),
+				"duration", time.Since(start),
+				"error", err,
+			)
+			return resp, err
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+		logger.DebugContext(ctx, "http response",
+			"method", req.Method,
+			"url", req.URL.String(),
+			"status", resp.StatusCode,
+			"duration", time.Since(start),
+			"headers", redactHeaders(resp.Header),
+			"body", redactBody(respBody),
+		)
+
+		return resp, nil
+	}
+}
+
+// redactHeaders は秘密情報を含むヘッダーの値を伏せた文字列表現を返す
+func redactHeaders(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for name, values := range header {
+		if logging.IsSecretHeader(name) {
+			result[name] = "[REDACTED]"
+			continue
+		}
+		result[name] = strings.Join(values, ", ")
+	}
+	return result
+}
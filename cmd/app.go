@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/jinford/coding-agent-example/ai"
+	"github.com/jinford/coding-agent-example/ai/redact"
+	"github.com/jinford/coding-agent-example/ai/replay"
+	"github.com/jinford/coding-agent-example/config"
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// app はコマンド間で共有するコンポーネント
+type app struct {
+	cfg          *config.Config
+	sessionStore sessionStore
+	client       *ai.OpenAIClient
+	recorder     *replay.Recorder
+}
+
+// sessionStore はコマンドが使うセッションストア
+type sessionStore interface {
+	session.Store
+	io.Closer
+}
+
+// nopCloser は閉じる必要のないセッションストアに Close を追加する
+type nopCloser struct {
+	session.Store
+}
+
+func (nopCloser) Close() error { return nil }
+
+// encryptionKeySource は設定からセッションの暗号化の鍵の取得元を返す（暗号化しない場合は nil）
+func encryptionKeySource(cfg *config.Config) (session.KeySource, error) {
+	switch cfg.Encryption {
+	case "", "none":
+		return nil, nil
+	case "keyring":
+		return session.Keyring{Service: "coding-agent", User: "sessions"}, nil
+	case "passphrase":
+		if cfg.PassphraseFile == "" {
+			return nil, fmt.Errorf("session_passphrase_file is required when session_encryption is passphrase")
+		}
+		return session.PassphraseFile{Path: cfg.PassphraseFile}, nil
+	default:
+		return nil, fmt.Errorf("unsupported session encryption %q (must be none, keyring or passphrase)", cfg.Encryption)
+	}
+}
+
+// openSessionStore は設定で選択したセッションストアを開く
+func openSessionStore(cfg *config.Config) (sessionStore, error) {
+	keySource, err := encryptionKeySource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if keySource != nil && cfg.SessionStore != "sqlite" {
+		return nil, fmt.Errorf("session encryption is only supported by the sqlite session store")
+	}
+
+	switch cfg.SessionStore {
+	case "sqlite":
+		warnLegacySessionDB(cfg)
+		if err := os.MkdirAll(filepath.Dir(cfg.SessionDB), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create session database directory: %w", err)
+		}
+		opts := []session.SQLiteOption{session.WithLogger(slog.Default())}
+		if keySource != nil {
+			opts = append(opts, session.WithEncryption(keySource))
+		}
+		store, err := session.NewSQLiteStore(cfg.SessionDB, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize session store: %w", err)
+		}
+		return store, nil
+	case "jsonl":
+		store, err := session.NewJSONLStore(cfg.SessionDir, session.WithJSONLLogger(slog.Default()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize session store: %w", err)
+		}
+		return nopCloser{store}, nil
+	case "memory":
+		return nopCloser{session.NewInMemoryStore()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported session store %q (must be sqlite, jsonl or memory)", cfg.SessionStore)
+	}
+}
+
+// legacySessionDB は以前の既定のセッションデータベースのパス
+const legacySessionDB = "sessions.db"
+
+// warnLegacySessionDB は以前の既定の場所（作業ディレクトリ）にセッションデータベースが残っていれば警告する
+func warnLegacySessionDB(cfg *config.Config) {
+	if cfg.Source("session_db") != "default" {
+		return
+	}
+	if _, err := os.Stat(legacySessionDB); err != nil {
+		return
+	}
+	slog.Warn("found session database in working directory; sessions are now stored in the state directory",
+		"legacy", legacySessionDB, "session_db", cfg.SessionDB,
+		"hint", "set session_db to keep using it, or move it to the new location")
+}
+
+// noAPIKey は base_url を指定してAPIキーを設定していない場合に送る仮のAPIキー
+const noAPIKey = "no-api-key"
+
+// clientOptions は設定からAPIキーとOpenAIClientの共通オプションを組み立てる
+func clientOptions(cfg *config.Config) (string, []ai.OptionFunc, error) {
+	apiKey := cfg.APIKey
+	switch {
+	case apiKey != "":
+	case replayPath != "":
+		// 再生時はAPIを呼び出さないためキーは不要
+		apiKey = "replay"
+	case cfg.BaseURL != "":
+		// ローカルのOpenAI互換サーバーなどは認証を必要としないことが多いため、キーがなければ仮の値を送る
+		apiKey = noAPIKey
+	default:
+		return "", nil, fmt.Errorf("OPENAI_API_KEY environment variable is not set (export OPENAI_API_KEY=your_api_key_here, or set base_url to use an OpenAI-compatible server)")
+	}
+
+	modelSettings := ai.ModelSettings{
+		Model:           cfg.Model,
+		Temperature:     cfg.Temperature,
+		MaxOutputTokens: cfg.MaxOutputTokens,
+		ReasoningEffort: cfg.ReasoningEffort,
+	}
+	if err := modelSettings.Validate(); err != nil {
+		return "", nil, fmt.Errorf("invalid model settings: %w", err)
+	}
+
+	opts := []ai.OptionFunc{
+		ai.WithLogger(slog.Default()),
+		ai.WithTrace(cfg.Debug),
+		ai.WithModelSettings(modelSettings),
+		ai.WithTitleModel(cfg.TitleModel),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, ai.WithRequestOptions(option.WithBaseURL(cfg.BaseURL)))
+	}
+
+	// ツールの実行結果から秘密情報を伏せる
+	if cfg.Redact {
+		redactor, err := redact.New(
+			redact.WithPatterns(cfg.RedactPatterns...),
+			redact.WithDeniedPaths(cfg.RedactDeniedPaths...),
+		)
+		if err != nil {
+			return "", nil, err
+		}
+		opts = append(opts, ai.WithRedactor(redactor))
+	} else {
+		opts = append(opts, ai.WithRedactor(nil))
+	}
+
+	return apiKey, opts, nil
+}
+
+// newApp はセッションストアとOpenAIクライアントを初期化する
+func newApp(cfg *config.Config) (*app, error) {
+	apiKey, opts, err := clientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// システムプロンプトと指示ファイル（AGENTS.md）を読み込む
+	var userConfigDir string
+	if dir, err := os.UserConfigDir(); err == nil {
+		userConfigDir = filepath.Join(dir, "coding-agent")
+	}
+	instructions, err := ai.LoadInstructions(".", userConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load instructions: %w", err)
+	}
+	opts = append(opts, ai.WithInstructions(instructions))
+
+	// 新しいセッションにワークスペースを記録し、/sessions の一覧をワークスペースで絞り込む
+	workspace, err := session.DetectWorkspace(context.Background(), ".")
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, ai.WithWorkspace(workspace))
+
+	sessionStore, err := openSessionStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &app{
+		cfg:          cfg,
+		sessionStore: sessionStore,
+	}
+
+	// フィクスチャの記録・再生
+	switch {
+	case recordPath != "":
+		a.recorder = replay.NewRecorder(nil)
+		opts = append(opts, ai.WithRequestOptions(option.WithHTTPClient(&http.Client{Transport: a.recorder})))
+	case replayPath != "":
+		replayer, err := replay.LoadReplayer(replayPath)
+		if err != nil {
+			sessionStore.Close()
+			return nil, err
+		}
+		opts = append(opts, ai.WithRequestOptions(
+			option.WithHTTPClient(&http.Client{Transport: replayer}),
+			option.WithMaxRetries(0),
+		))
+	}
+
+	a.client = ai.NewOpenAIClient(apiKey, sessionStore, opts...)
+	return a, nil
+}
+
+// Close はアプリケーションが保持するリソースを解放する
+// 生成中のセッションのタイトルを待ち、記録中のフィクスチャがあればファイルに書き込む
+func (a *app) Close() error {
+	// バックグラウンドで生成中のタイトルを保存してから閉じる
+	if a.client != nil {
+		a.client.Wait()
+	}
+
+	var errs []error
+	if a.recorder != nil {
+		errs = append(errs, a.recorder.Save(recordPath))
+	}
+	errs = append(errs, a.sessionStore.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/jinford/coding-agent-example/ui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "対話モードでエージェントを起動する",
+	Args:  cobra.NoArgs,
+	RunE:  runChat,
+}
+
+func init() {
+	chatCmd.Flags().String("resume", "", "再開するセッションID")
+	chatCmd.Flags().Bool("verbose", false, "ツールの実行状況を詳細に表示する")
+	rootCmd.AddCommand(chatCmd)
+}
+
+func runChat(cmd *cobra.Command, _ []string) (err error) {
+	a, err := newApp(appConfig)
+	if err != nil {
+		return err
+	}
+	// フィクスチャの書き込みなど、終了時の処理の失敗もコマンドのエラーとして返す
+	defer func() { err = errors.Join(err, a.Close()) }()
+
+	var opts []ui.ConversationOption
+	if resume, _ := cmd.Flags().GetString("resume"); resume != "" {
+		opts = append(opts, ui.WithSessionID(session.SessionID(resume)))
+	}
+	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+		opts = append(opts, ui.WithVerbose(true))
+	}
+
+	// 端末から入力する場合は複数行の入力と入力履歴に対応したエディタを使う
+	var scanner ui.InputScanner = bufio.NewScanner(os.Stdin)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		history, err := ui.LoadHistory(appConfig.HistoryFile, ui.DefaultHistorySize)
+		if err != nil {
+			return fmt.Errorf("failed to load input history: %w", err)
+		}
+		editor := ui.NewLineEditor(os.Stdin, os.Stdout, ui.WithTerminal(fd), ui.WithHistory(history))
+		defer editor.Close()
+		scanner = editor
+	}
+
+	// 対話モードの Ctrl-C は応答中のターンだけを中断するため、SIGINT でキャンセルされるコマンドのコンテキストを引き継がない
+	ctx, stop := signal.NotifyContext(context.WithoutCancel(cmd.Context()), syscall.SIGTERM)
+	defer stop()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	opts = append(opts, ui.WithInterrupts(interrupts))
+
+	// 会話を開始
+	conversation := ui.NewConversation(scanner, a.client, opts...)
+	conversation.Run(ctx)
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jinford/coding-agent-example/eval"
+	"github.com/spf13/cobra"
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval <task-file-or-dir>...",
+	Short: "評価用のコーディングタスクを実行してレポートを出力する",
+	Long: `評価用のコーディングタスクを実行してレポートを出力します。
+
+タスクは task.json で定義します。ディレクトリを指定した場合は配下の全ての task.json を実行します。
+
+  {
+    "name": "fix-add",
+    "fixture": "repo",
+    "instruction": "Add関数のバグを修正してください",
+    "check": "go test ./...",
+    "timeout": "5m"
+  }
+
+各タスクはフィクスチャを一時ディレクトリにコピーして実行し、check コマンドの終了コードで成否を判定します。
+接続先は --base-url でOpenAI互換のサーバーに変更できます。`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runEval,
+}
+
+func init() {
+	evalCmd.Flags().String("json", "", "JSON形式のレポートの出力先")
+	evalCmd.Flags().String("markdown", "", "Markdown形式のレポートの出力先（省略時は標準出力）")
+	rootCmd.AddCommand(evalCmd)
+}
+
+func runEval(cmd *cobra.Command, args []string) error {
+	tasks, err := eval.LoadTasks(args...)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return fmt.Errorf("no tasks found")
+	}
+
+	apiKey, opts, err := clientOptions(appConfig)
+	if err != nil {
+		return err
+	}
+
+	runner := &eval.Runner{
+		APIKey:        apiKey,
+		ClientOptions: opts,
+		Progress:      cmd.ErrOrStderr(),
+	}
+	report, err := runner.Run(cmd.Context(), tasks)
+	if err != nil {
+		return err
+	}
+
+	if path, _ := cmd.Flags().GetString("json"); path != "" {
+		if err := writeToFile(path, report.WriteJSON); err != nil {
+			return err
+		}
+	}
+
+	if path, _ := cmd.Flags().GetString("markdown"); path != "" {
+		return writeToFile(path, report.WriteMarkdown)
+	}
+	return report.WriteMarkdown(cmd.OutOrStdout())
+}
+
+// writeToFile は write の出力をファイルに書き出す
+func writeToFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
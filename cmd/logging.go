@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/jinford/coding-agent-example/config"
+	"github.com/jinford/coding-agent-example/logging"
+)
+
+// setupLogger は設定に従ってロガーを作成し、既定のロガーとして登録する
+// 返されるクローズ関数はログファイルを閉じる
+func setupLogger(cfg *config.Config) (func() error, error) {
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Debug {
+		level = slog.LevelDebug
+	}
+
+	if cfg.LogFile == "" {
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+		return func() error { return nil }, nil
+	}
+
+	file, err := logging.OpenRotatingFile(cfg.LogFile, logging.DefaultMaxSize, logging.DefaultMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.SetDefault(logging.NewLogger(file, level))
+	return file.Close, nil
+}
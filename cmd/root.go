@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/jinford/coding-agent-example/config"
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/spf13/cobra"
+)
+
+// appConfig は実行中のコマンドの実効的な設定（PersistentPreRunE で読み込む）
+var appConfig *config.Config
+
+// closeLogger はログファイルを閉じる
+var closeLogger = func() error { return nil }
+
+var rootCmd = &cobra.Command{
+	Use:          "coding-agent",
+	Short:        "Coding Agent CLI",
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		appConfig = cfg
+
+		closeLogger, err = setupLogger(cfg)
+		if err != nil {
+			return err
+		}
+
+		slog.Debug("command started", "command", cmd.CommandPath())
+		return nil
+	},
+	PersistentPostRunE: func(cmd *cobra.Command, _ []string) error {
+		return closeLogger()
+	},
+	// サブコマンドを省略した場合は対話モードで起動する
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChat(cmd, args)
+	},
+}
+
+// recordPath と replayPath はAPIとのやり取りを記録・再生するフィクスチャファイルのパス
+var (
+	recordPath string
+	replayPath string
+)
+
+func init() {
+	config.BindFlags(rootCmd.PersistentFlags())
+	rootCmd.PersistentFlags().StringVar(&recordPath, "record", "", "APIとのやり取りを指定したフィクスチャファイルに記録する")
+	rootCmd.PersistentFlags().StringVar(&replayPath, "replay", "", "APIを呼び出さずに指定したフィクスチャファイルのやり取りを再生する")
+	rootCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	rootCmd.Flags().String("resume", "", "再開するセッションID")
+	rootCmd.Flags().Bool("verbose", false, "ツールの実行状況を詳細に表示する")
+}
+
+// Execute はコマンドを実行する
+func Execute() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return rootCmd.ExecuteContext(ctx)
+}
+
+// loadConfig はユーザー設定ファイル、ワークスペース設定ファイル、環境変数、フラグから設定を読み込む
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	userPath, err := config.UserPath()
+	if err != nil {
+		// ユーザー設定ディレクトリが取得できない環境ではユーザー設定ファイルを読み込まない
+		userPath = ""
+	}
+
+	// ワークスペース設定ファイルは、セッションのワークスペースと同じく git リポジトリのルートから探す
+	workspace, err := session.DetectWorkspace(cmd.Context(), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Load(config.LoadOptions{
+		UserPath:    userPath,
+		ProjectPath: filepath.Join(workspace.Path, config.ProjectPath),
+		Flags:       cmd.Flags(),
+	})
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [prompt]",
+	Short: "指示を1回だけ実行して応答を出力する",
+	Long:  "指示を1回だけ実行して応答を標準出力に出力します。引数を省略した場合は標準入力から指示を読み込みます。",
+	RunE:  runRun,
+}
+
+func init() {
+	runCmd.Flags().String("resume", "", "続きから実行するセッションID")
+	rootCmd.AddCommand(runCmd)
+}
+
+func runRun(cmd *cobra.Command, args []string) (err error) {
+	prompt := strings.Join(args, " ")
+	if prompt == "" {
+		input, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to read prompt from stdin: %w", err)
+		}
+		prompt = string(input)
+	}
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return fmt.Errorf("prompt is empty")
+	}
+
+	a, err := newApp(appConfig)
+	if err != nil {
+		return err
+	}
+	// フィクスチャの書き込みなど、終了時の処理の失敗もコマンドのエラーとして返す
+	defer func() { err = errors.Join(err, a.Close()) }()
+
+	sessionID := session.NewSessionID()
+	if resume, _ := cmd.Flags().GetString("resume"); resume != "" {
+		sessionID = session.SessionID(resume)
+	}
+
+	out, err := a.client.GenerateResponse(cmd.Context(), prompt, sessionID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), out)
+	fmt.Fprintf(cmd.ErrOrStderr(), "session: %s\n", sessionID)
+
+	return nil
+}
@@ -0,0 +1,454 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/spf13/cobra"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "保存されているセッションを管理する",
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "このワークスペースのセッションの一覧を表示する（--all で全てのセッション）",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		store, err := openSessionStore(appConfig)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		var sessions []session.SessionInfo
+		if listAll {
+			sessions, err = store.Sessions(cmd.Context())
+		} else {
+			var ws session.Workspace
+			if ws, err = session.DetectWorkspace(cmd.Context(), "."); err != nil {
+				return err
+			}
+			sessions, err = session.WorkspaceSessions(cmd.Context(), store, ws)
+		}
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUPDATED\tTURNS\tTITLE")
+		for _, row := range sessionTree(sessions) {
+			info := row.info
+			// タイトルのないセッションは最初の発言を表示する
+			title := info.Title
+			if title == "" {
+				title = preview(info.Preview, 50)
+			}
+			fmt.Fprintf(w, "%s%s\t%s\t%d\t%s\n",
+				row.prefix, info.ID, info.UpdatedAt.Local().Format("2006-01-02 15:04"), info.TurnCount, title)
+		}
+		return w.Flush()
+	},
+}
+
+var sessionsDeleteCmd = &cobra.Command{
+	Use:   "delete <session-id>...",
+	Short: "セッションを削除する",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openSessionStore(appConfig)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		// 存在しないIDがあっても残りのセッションは削除し、最後にまとめてエラーを返す
+		var errs []error
+		for _, id := range args {
+			if err := store.Delete(cmd.Context(), session.SessionID(id)); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "deleted: %s\n", id)
+		}
+		return errors.Join(errs...)
+	},
+}
+
+var sessionsSearchCmd = &cobra.Command{
+	Use:   "search <query>...",
+	Short: "過去のセッションの発言とツールの実行結果を全文検索する",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openSessionStore(appConfig)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		searcher, ok := store.(session.Searcher)
+		if !ok {
+			return fmt.Errorf("%w: session store %q does not support search", session.ErrSearchUnavailable, appConfig.SessionStore)
+		}
+		results, err := searcher.Search(cmd.Context(), strings.Join(args, " "), searchLimit)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTITLE\tDATE\tROLE\tSNIPPET")
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				result.SessionID, result.Title, result.CreatedAt.Local().Format("2006-01-02 15:04"), result.Role, session.StripSnippetMarkers(result.Snippet))
+		}
+		return w.Flush()
+	},
+}
+
+var sessionsToolsCmd = &cobra.Command{
+	Use:   "tools",
+	Short: "ツールごとの呼び出し回数・失敗回数・実行時間を集計する",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		store, err := openSessionStore(appConfig)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		sqliteStore, ok := store.(*session.SQLiteStore)
+		if !ok {
+			return fmt.Errorf("session store %q does not support tool stats", appConfig.SessionStore)
+		}
+
+		var since time.Time
+		if toolsSince > 0 {
+			since = time.Now().Add(-toolsSince)
+		}
+		stats, err := sqliteStore.ToolStats(cmd.Context(), since)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TOOL\tCALLS\tERRORS\tERROR%\tAVG\tMAX\tBYTES")
+		for _, stat := range stats {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%s\t%s\t%d\n",
+				stat.Name, stat.Calls, stat.Errors, stat.ErrorRate()*100,
+				stat.AvgDuration.Round(time.Millisecond), stat.MaxDuration.Round(time.Millisecond), stat.TotalBytes)
+		}
+		return w.Flush()
+	},
+}
+
+var sessionsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "保持ポリシーに従って古いセッションを削除し、データベースを縮小する",
+	Long: `保持ポリシー（retention_max_age, retention_max_sessions, retention_truncate_after）に従って
+古いセッションを削除し、古いツールの実行結果を切り詰めたあと VACUUM でデータベースを縮小する。
+sessions pin で固定したセッションは対象外になる。`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		retention := appConfig.Retention
+		policy := session.RetentionPolicy{
+			MaxAge:        retention.MaxAge,
+			MaxSessions:   retention.MaxSessions,
+			TruncateAfter: retention.TruncateAfter,
+			TruncateBytes: retention.TruncateBytes,
+		}
+		if policy.IsZero() {
+			return fmt.Errorf("no retention policy is configured (set retention_max_age, retention_max_sessions or retention_truncate_after)")
+		}
+
+		store, err := openSessionStore(appConfig)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		sqliteStore, ok := store.(*session.SQLiteStore)
+		if !ok {
+			return fmt.Errorf("session store %q does not support pruning", appConfig.SessionStore)
+		}
+
+		result, err := sqliteStore.Prune(cmd.Context(), policy, pruneDryRun)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if len(result.Sessions) > 0 {
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tUPDATED\tTURNS\tPREVIEW")
+			for _, info := range result.Sessions {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
+					info.ID, info.UpdatedAt.Local().Format("2006-01-02 15:04"), info.TurnCount, preview(info.Preview, 50))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if pruneDryRun {
+			fmt.Fprintf(out, "would delete %d sessions and truncate %d tool results (%s)\n",
+				len(result.Sessions), result.TruncatedResults, formatBytes(result.TruncatedBytes))
+			return nil
+		}
+		fmt.Fprintf(out, "deleted %d sessions, truncated %d tool results (%s), reclaimed %s\n",
+			len(result.Sessions), result.TruncatedResults, formatBytes(result.TruncatedBytes), formatBytes(result.ReclaimedBytes))
+		return nil
+	},
+}
+
+var sessionsPinCmd = &cobra.Command{
+	Use:   "pin <session-id>...",
+	Short: "セッションを固定して sessions prune の対象外にする",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setPinned(cmd, args, true)
+	},
+}
+
+var sessionsUnpinCmd = &cobra.Command{
+	Use:   "unpin <session-id>...",
+	Short: "セッションの固定を解除する",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setPinned(cmd, args, false)
+	},
+}
+
+var sessionsEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "既存のセッションデータベースを暗号化する",
+	Long: `session_encryption で指定した鍵で、保存済みの発言内容・ツール呼び出し・メタデータを暗号化する。
+暗号化したデータベースでは全文検索（sessions search, /search）は使えない。`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		keySource, err := encryptionKeySource(appConfig)
+		if err != nil {
+			return err
+		}
+		if keySource == nil {
+			return fmt.Errorf("set session_encryption to keyring or passphrase to encrypt the session database")
+		}
+		if appConfig.SessionStore != "sqlite" {
+			return fmt.Errorf("session encryption is only supported by the sqlite session store")
+		}
+
+		// 暗号化の前のデータベースは鍵を指定せずに開く
+		store, err := session.NewSQLiteStore(appConfig.SessionDB, session.WithLogger(slog.Default()))
+		if errors.Is(err, session.ErrEncryptionKeyRequired) {
+			return fmt.Errorf("%s is already encrypted", appConfig.SessionDB)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to initialize session store: %w", err)
+		}
+		defer store.Close()
+
+		if err := store.Encrypt(cmd.Context(), keySource); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "encrypted: %s\n", appConfig.SessionDB)
+		return nil
+	},
+}
+
+// setPinned はセッションの固定を設定・解除する
+func setPinned(cmd *cobra.Command, args []string, pinned bool) error {
+	store, err := openSessionStore(appConfig)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	value, label := "", "unpinned"
+	if pinned {
+		value, label = "true", "pinned"
+	}
+
+	for _, id := range args {
+		sessionID := session.SessionID(id)
+		turns, err := store.List(cmd.Context(), sessionID)
+		if err != nil {
+			return err
+		}
+		if len(turns) == 0 {
+			return fmt.Errorf("%w: %s", session.ErrSessionNotFound, id)
+		}
+		if err := store.SetMetadata(cmd.Context(), sessionID, map[string]string{session.PinnedMetadataKey: value}); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", label, id)
+	}
+	return nil
+}
+
+// formatBytes はバイト数を読みやすい単位で返す
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "KiB"
+	for _, next := range []string{"MiB", "GiB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
+
+var (
+	listAll      bool
+	pruneDryRun  bool
+	toolsSince   time.Duration
+	searchLimit  int
+	exportFormat string
+	exportOutput string
+	importNewID  bool
+)
+
+// transcriptWriters はエクスポート形式ごとの書き出し処理
+var transcriptWriters = map[string]func(*session.Transcript, io.Writer) error{
+	"md":   (*session.Transcript).WriteMarkdown,
+	"json": (*session.Transcript).WriteJSON,
+	"html": (*session.Transcript).WriteHTML,
+}
+
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <session-id>",
+	Short: "セッションをMarkdown・JSON・HTML形式で書き出す",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		write, ok := transcriptWriters[exportFormat]
+		if !ok {
+			return fmt.Errorf("unsupported format %q (must be md, json or html)", exportFormat)
+		}
+
+		store, err := openSessionStore(appConfig)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		transcript, err := session.ExportTranscript(cmd.Context(), store, session.SessionID(args[0]))
+		if err != nil {
+			return err
+		}
+
+		if exportOutput == "" || exportOutput == "-" {
+			return write(transcript, cmd.OutOrStdout())
+		}
+		return writeToFile(exportOutput, func(w io.Writer) error {
+			return write(transcript, w)
+		})
+	},
+}
+
+var sessionsImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "JSON形式で書き出したセッションを読み込む",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", args[0], err)
+		}
+		defer f.Close()
+
+		transcript, err := session.ReadTranscript(f)
+		if err != nil {
+			return err
+		}
+
+		store, err := openSessionStore(appConfig)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		sessionID := transcript.SessionID
+		if importNewID || sessionID.IsEmpty() {
+			sessionID = session.NewSessionID()
+		}
+		if err := session.ImportTranscript(cmd.Context(), store, transcript, sessionID); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "imported: %s (%d turns)\n", sessionID, len(transcript.Turns))
+		return nil
+	},
+}
+
+func init() {
+	sessionsListCmd.Flags().BoolVarP(&listAll, "all", "a", false, "全てのワークスペースのセッションを表示する")
+	sessionsExportCmd.Flags().StringVarP(&exportFormat, "format", "f", "md", "出力形式（md, json, html）")
+	sessionsExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "出力先のファイル（省略時は標準出力）")
+	sessionsSearchCmd.Flags().IntVarP(&searchLimit, "limit", "n", session.DefaultSearchLimit, "表示する件数")
+	sessionsImportCmd.Flags().BoolVar(&importNewID, "new-id", false, "新しいセッションIDで読み込む")
+	sessionsPruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "削除・切り詰めの対象を表示するだけで変更しない")
+	sessionsToolsCmd.Flags().DurationVar(&toolsSince, "since", 0, "集計する期間（例: 168h。省略時は全期間）")
+
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsDeleteCmd, sessionsSearchCmd, sessionsExportCmd, sessionsImportCmd, sessionsToolsCmd,
+		sessionsPruneCmd, sessionsPinCmd, sessionsUnpinCmd, sessionsEncryptCmd)
+	rootCmd.AddCommand(sessionsCmd)
+}
+
+// sessionTreeRow はツリー表示するセッションの1行
+type sessionTreeRow struct {
+	prefix string // ツリーの罫線
+	info   session.SessionInfo
+}
+
+// sessionTree は分岐したセッションを分岐元の下に並べる
+// 兄弟の順序は元の順序（更新日時の新しい順）を保ち、分岐元が削除されたセッションは最上位に表示する
+func sessionTree(sessions []session.SessionInfo) []sessionTreeRow {
+	exists := make(map[session.SessionID]bool, len(sessions))
+	for _, info := range sessions {
+		exists[info.ID] = true
+	}
+
+	var roots []session.SessionInfo
+	children := make(map[session.SessionID][]session.SessionInfo)
+	for _, info := range sessions {
+		if info.ParentID != "" && exists[info.ParentID] {
+			children[info.ParentID] = append(children[info.ParentID], info)
+			continue
+		}
+		roots = append(roots, info)
+	}
+
+	rows := make([]sessionTreeRow, 0, len(sessions))
+	var walk func(info session.SessionInfo, prefix, indent string)
+	walk = func(info session.SessionInfo, prefix, indent string) {
+		rows = append(rows, sessionTreeRow{prefix: prefix, info: info})
+		kids := children[info.ID]
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				walk(child, indent+"└─ ", indent+"   ")
+			} else {
+				walk(child, indent+"├─ ", indent+"│  ")
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root, "", "")
+	}
+	return rows
+}
+
+// preview は改行を除いた先頭 n 文字を返す
+func preview(s string, n int) string {
+	return session.TruncateRunes(strings.Join(strings.Fields(s), " "), n)
+}
@@ -0,0 +1,617 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v3/shared"
+	"github.com/spf13/pflag"
+)
+
+// ProjectPath はワークスペース単位の設定ファイルのパス
+const ProjectPath = ".coding-agent/config.json"
+
+// UserPath はユーザー単位の設定ファイルのパスを返す
+func UserPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config dir: %w", err)
+	}
+	return filepath.Join(dir, "coding-agent", "config.json"), nil
+}
+
+// StateDir はセッションやログなどの状態ファイルを保存するディレクトリを返す
+// $XDG_STATE_HOME が設定されていればそれを、なければ ~/.local/state を基準とする
+func StateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "coding-agent"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "coding-agent"), nil
+}
+
+// Config は実効的な設定値を表す
+type Config struct {
+	APIKey          string   // OpenAI APIキー
+	BaseURL         string   // APIのベースURL（OpenAI互換のサーバーを使う場合に指定する）
+	Model           string   // モデル名
+	Temperature     *float64 // 温度
+	MaxOutputTokens *int64   // 最大出力トークン数
+	ReasoningEffort string   // 推論の度合い
+	TitleModel      string   // セッションのタイトルを生成するモデル（空の場合は最初の発言から作る）
+	SessionStore    string   // セッションの保存先（sqlite, jsonl, memory）
+	SessionDB       string   // セッションを保存するSQLiteデータベースのパス
+	SessionDir      string   // セッションをJSONLファイルで保存するディレクトリ
+	Encryption      string   // セッションの暗号化の鍵の取得元（none, keyring, passphrase）
+	PassphraseFile  string   // 暗号化の鍵を導出するパスフレーズのファイル
+	HistoryFile     string   // 対話モードの入力履歴を保存するファイル（空の場合は保存しない）
+	LogFile         string   // ログファイルのパス（空の場合はログを出力しない）
+	LogLevel        string   // ログレベル（debug, info, warn, error）
+	Debug           bool     // APIのリクエスト・レスポンスを含むトレースをログに記録するか
+
+	Retention Retention // セッションの保持ポリシー
+
+	Redact            bool     // ツールの実行結果から秘密情報を伏せるか
+	RedactPatterns    []string // 秘密情報として伏せる正規表現（組み込みの検出器に追加する）
+	RedactDeniedPaths []string // 読み込みを拒否するファイル・ディレクトリ名のパターン（既定のパターンに追加する）
+
+	sources map[string]string
+}
+
+// Retention はセッションの保持ポリシーの設定
+// 期間・件数が0の場合はその条件で削除・切り詰めを行わない
+type Retention struct {
+	MaxAge        time.Duration // 最終更新からこの期間を過ぎたセッションを削除する
+	MaxSessions   int           // 新しい順にこの件数を超えたセッションを削除する
+	TruncateAfter time.Duration // この期間を過ぎたターンのツールの実行結果を切り詰める
+	TruncateBytes int           // 切り詰める実行結果の大きさ（バイト）
+}
+
+// Source は設定項目の値がどこから来たかを返す
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return "default"
+}
+
+// Entry は表示用の設定項目
+type Entry struct {
+	Key    string // 設定ファイルでのキー
+	Value  string // 値（秘密情報はマスクされる）
+	Source string // 値の出所
+}
+
+// Entries は全ての設定項目を返す
+func (c *Config) Entries() []Entry {
+	entries := make([]Entry, 0, len(fields))
+	for _, f := range fields {
+		value := f.get(c)
+		if f.secret && value != "" {
+			value = maskSecret(value)
+		}
+		entries = append(entries, Entry{Key: f.key, Value: value, Source: c.Source(f.key)})
+	}
+	return entries
+}
+
+// field は設定項目の定義
+type field struct {
+	key    string // 設定ファイルでのキー
+	env    string // 環境変数名
+	flag   string // コマンドラインフラグ名（空の場合はフラグを提供しない）
+	usage  string // フラグの説明
+	secret bool   // 表示時にマスクするか
+	repo   bool   // ワークスペース設定ファイルで指定できるか
+	get    func(c *Config) string
+	set    func(c *Config, value string) error
+}
+
+// fields は設定項目の一覧（表示順）
+// ワークスペース設定ファイルは clone したリポジトリに含まれるため、repo を指定した項目（モデルの設定など）だけを受け付ける。
+// 送信先・認証情報・秘密情報の保護・ファイルの保存先を指定できると、リポジトリの作成者がAPIキーや会話を外部に送らせることができてしまう
+var fields = []field{
+	{
+		key:    "api_key",
+		env:    "OPENAI_API_KEY",
+		secret: true,
+		get:    func(c *Config) string { return c.APIKey },
+		set:    func(c *Config, v string) error { c.APIKey = v; return nil },
+	},
+	{
+		key:   "base_url",
+		env:   "OPENAI_BASE_URL",
+		flag:  "base-url",
+		usage: "APIのベースURL（OpenAI互換のサーバーを使う場合に指定する）",
+		get:   func(c *Config) string { return c.BaseURL },
+		set:   func(c *Config, v string) error { c.BaseURL = v; return nil },
+	},
+	{
+		key:   "model",
+		repo:  true,
+		env:   "CODING_AGENT_MODEL",
+		flag:  "model",
+		usage: "使用するモデル",
+		get:   func(c *Config) string { return c.Model },
+		set:   func(c *Config, v string) error { c.Model = v; return nil },
+	},
+	{
+		key:   "temperature",
+		repo:  true,
+		env:   "CODING_AGENT_TEMPERATURE",
+		flag:  "temperature",
+		usage: "温度（0〜2）",
+		get: func(c *Config) string {
+			if c.Temperature == nil {
+				return ""
+			}
+			return strconv.FormatFloat(*c.Temperature, 'g', -1, 64)
+		},
+		set: func(c *Config, v string) error {
+			t, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return err
+			}
+			c.Temperature = &t
+			return nil
+		},
+	},
+	{
+		key:   "max_output_tokens",
+		repo:  true,
+		env:   "CODING_AGENT_MAX_OUTPUT_TOKENS",
+		flag:  "max-output-tokens",
+		usage: "最大出力トークン数",
+		get: func(c *Config) string {
+			if c.MaxOutputTokens == nil {
+				return ""
+			}
+			return strconv.FormatInt(*c.MaxOutputTokens, 10)
+		},
+		set: func(c *Config, v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return err
+			}
+			c.MaxOutputTokens = &n
+			return nil
+		},
+	},
+	{
+		key:   "reasoning_effort",
+		repo:  true,
+		env:   "CODING_AGENT_REASONING_EFFORT",
+		flag:  "reasoning-effort",
+		usage: "推論の度合い（minimal, low, medium, high）",
+		get:   func(c *Config) string { return c.ReasoningEffort },
+		set:   func(c *Config, v string) error { c.ReasoningEffort = v; return nil },
+	},
+	{
+		key:   "title_model",
+		repo:  true,
+		env:   "CODING_AGENT_TITLE_MODEL",
+		flag:  "title-model",
+		usage: "セッションのタイトルを生成するモデル（空の場合は最初の発言をタイトルにする）",
+		get:   func(c *Config) string { return c.TitleModel },
+		set:   func(c *Config, v string) error { c.TitleModel = v; return nil },
+	},
+	{
+		key:   "session_store",
+		env:   "CODING_AGENT_SESSION_STORE",
+		flag:  "session-store",
+		usage: "セッションの保存先（sqlite, jsonl, memory）",
+		get:   func(c *Config) string { return c.SessionStore },
+		set:   func(c *Config, v string) error { c.SessionStore = v; return nil },
+	},
+	{
+		key:   "session_db",
+		env:   "CODING_AGENT_SESSION_DB",
+		flag:  "session-db",
+		usage: "セッションを保存するデータベースのパス（session_store が sqlite の場合）",
+		get:   func(c *Config) string { return c.SessionDB },
+		set:   func(c *Config, v string) error { c.SessionDB = v; return nil },
+	},
+	{
+		key:   "session_dir",
+		env:   "CODING_AGENT_SESSION_DIR",
+		flag:  "session-dir",
+		usage: "セッションをJSONLファイルで保存するディレクトリ（session_store が jsonl の場合）",
+		get:   func(c *Config) string { return c.SessionDir },
+		set:   func(c *Config, v string) error { c.SessionDir = v; return nil },
+	},
+	{
+		key:   "session_encryption",
+		env:   "CODING_AGENT_SESSION_ENCRYPTION",
+		flag:  "session-encryption",
+		usage: "セッションの暗号化の鍵の取得元（none, keyring, passphrase）",
+		get:   func(c *Config) string { return c.Encryption },
+		set:   func(c *Config, v string) error { c.Encryption = v; return nil },
+	},
+	{
+		key:   "session_passphrase_file",
+		env:   "CODING_AGENT_SESSION_PASSPHRASE_FILE",
+		flag:  "session-passphrase-file",
+		usage: "暗号化の鍵を導出するパスフレーズのファイル（session_encryption が passphrase の場合）",
+		get:   func(c *Config) string { return c.PassphraseFile },
+		set:   func(c *Config, v string) error { c.PassphraseFile = v; return nil },
+	},
+	{
+		key:   "retention_max_age",
+		env:   "CODING_AGENT_RETENTION_MAX_AGE",
+		flag:  "retention-max-age",
+		usage: "最終更新からこの期間を過ぎたセッションを sessions prune で削除する（例: 90d, 720h）",
+		get:   func(c *Config) string { return formatDays(c.Retention.MaxAge) },
+		set: func(c *Config, v string) error {
+			d, err := parseDays(v)
+			if err != nil {
+				return err
+			}
+			c.Retention.MaxAge = d
+			return nil
+		},
+	},
+	{
+		key:   "retention_max_sessions",
+		env:   "CODING_AGENT_RETENTION_MAX_SESSIONS",
+		flag:  "retention-max-sessions",
+		usage: "sessions prune で残すセッションの件数（新しい順）",
+		get:   func(c *Config) string { return strconv.Itoa(c.Retention.MaxSessions) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			c.Retention.MaxSessions = n
+			return nil
+		},
+	},
+	{
+		key:   "retention_truncate_after",
+		env:   "CODING_AGENT_RETENTION_TRUNCATE_AFTER",
+		flag:  "retention-truncate-after",
+		usage: "この期間を過ぎたツールの実行結果を sessions prune で切り詰める（例: 30d）",
+		get:   func(c *Config) string { return formatDays(c.Retention.TruncateAfter) },
+		set: func(c *Config, v string) error {
+			d, err := parseDays(v)
+			if err != nil {
+				return err
+			}
+			c.Retention.TruncateAfter = d
+			return nil
+		},
+	},
+	{
+		key:   "retention_truncate_bytes",
+		env:   "CODING_AGENT_RETENTION_TRUNCATE_BYTES",
+		flag:  "retention-truncate-bytes",
+		usage: "切り詰めた後のツールの実行結果の最大バイト数",
+		get:   func(c *Config) string { return strconv.Itoa(c.Retention.TruncateBytes) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			c.Retention.TruncateBytes = n
+			return nil
+		},
+	},
+	{
+		key: "redact",
+		env: "CODING_AGENT_REDACT",
+		get: func(c *Config) string { return strconv.FormatBool(c.Redact) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			c.Redact = b
+			return nil
+		},
+	},
+	{
+		key:  "redact_patterns",
+		repo: true,
+		env:  "CODING_AGENT_REDACT_PATTERNS",
+		get:  func(c *Config) string { return formatList(c.RedactPatterns) },
+		set: func(c *Config, v string) error {
+			list, err := parseList(v)
+			if err != nil {
+				return err
+			}
+			c.RedactPatterns = list
+			return nil
+		},
+	},
+	{
+		key: "redact_denied_paths",
+		env: "CODING_AGENT_REDACT_DENIED_PATHS",
+		get: func(c *Config) string { return formatList(c.RedactDeniedPaths) },
+		set: func(c *Config, v string) error {
+			list, err := parseList(v)
+			if err != nil {
+				return err
+			}
+			c.RedactDeniedPaths = list
+			return nil
+		},
+	},
+	{
+		key:   "history_file",
+		env:   "CODING_AGENT_HISTORY_FILE",
+		flag:  "history-file",
+		usage: "対話モードの入力履歴を保存するファイル（空の場合は保存しない）",
+		get:   func(c *Config) string { return c.HistoryFile },
+		set:   func(c *Config, v string) error { c.HistoryFile = v; return nil },
+	},
+	{
+		key:   "log_file",
+		env:   "CODING_AGENT_LOG_FILE",
+		flag:  "log-file",
+		usage: "ログファイルのパス",
+		get:   func(c *Config) string { return c.LogFile },
+		set:   func(c *Config, v string) error { c.LogFile = v; return nil },
+	},
+	{
+		key:   "log_level",
+		repo:  true,
+		env:   "CODING_AGENT_LOG_LEVEL",
+		flag:  "log-level",
+		usage: "ログレベル（debug, info, warn, error）",
+		get:   func(c *Config) string { return c.LogLevel },
+		set:   func(c *Config, v string) error { c.LogLevel = v; return nil },
+	},
+	{
+		key:   "debug",
+		env:   "CODING_AGENT_DEBUG",
+		flag:  "debug",
+		usage: "APIのリクエスト・レスポンスを含むトレースをログに記録する（ログレベルは debug になる）",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Debug) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			c.Debug = b
+			return nil
+		},
+	},
+}
+
+// defaultConfig は既定の設定を返す
+func defaultConfig() *Config {
+	cfg := &Config{
+		Model:        shared.ChatModelGPT4_1,
+		TitleModel:   shared.ChatModelGPT4_1Nano,
+		SessionStore: "sqlite",
+		SessionDB:    "./sessions.db",
+		SessionDir:   "./sessions",
+		Encryption:   "none",
+		Retention:    Retention{TruncateBytes: 4096},
+		Redact:       true,
+		LogLevel:     "info",
+		sources:      make(map[string]string),
+	}
+	// セッションとログは作業ディレクトリではなく状態ディレクトリに保存する
+	if dir, err := StateDir(); err == nil {
+		cfg.SessionDB = filepath.Join(dir, "sessions.db")
+		cfg.SessionDir = filepath.Join(dir, "sessions")
+		cfg.HistoryFile = filepath.Join(dir, "history")
+		cfg.LogFile = filepath.Join(dir, "logs", "coding-agent.log")
+	}
+	return cfg
+}
+
+// BindFlags は設定項目に対応するコマンドラインフラグを登録する
+func BindFlags(fs *pflag.FlagSet) {
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		if f.key == "debug" {
+			fs.Bool(f.flag, false, f.usage)
+			continue
+		}
+		fs.String(f.flag, "", f.usage)
+	}
+}
+
+// LoadOptions は設定の読み込み元を指定する
+type LoadOptions struct {
+	UserPath    string                          // ユーザー単位の設定ファイル（空の場合は読み込まない）
+	ProjectPath string                          // ワークスペース単位の設定ファイル（空の場合は読み込まない）
+	LookupEnv   func(key string) (string, bool) // 環境変数の参照（nil の場合は os.LookupEnv）
+	Flags       *pflag.FlagSet                  // BindFlags で登録したフラグ（nil の場合は参照しない）
+}
+
+// Load は設定を読み込む
+// 優先順位は 既定値 < ユーザー設定ファイル < ワークスペース設定ファイル < 環境変数 < コマンドラインフラグ
+func Load(opts LoadOptions) (*Config, error) {
+	cfg := defaultConfig()
+
+	for _, file := range []struct {
+		path    string
+		label   string
+		project bool
+	}{
+		{opts.UserPath, "user file", false},
+		{opts.ProjectPath, "project file", true},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if err := cfg.applyFile(file.path, file.label, file.project); err != nil {
+			return nil, err
+		}
+	}
+
+	lookupEnv := opts.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	for _, f := range fields {
+		value, ok := lookupEnv(f.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := f.set(cfg, value); err != nil {
+			return nil, fmt.Errorf("invalid value for environment variable %s: %w", f.env, err)
+		}
+		cfg.sources[f.key] = "env (" + f.env + ")"
+	}
+
+	if opts.Flags != nil {
+		for _, f := range fields {
+			if f.flag == "" || !opts.Flags.Changed(f.flag) {
+				continue
+			}
+			value := opts.Flags.Lookup(f.flag).Value.String()
+			if err := f.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("invalid value for flag --%s: %w", f.flag, err)
+			}
+			cfg.sources[f.key] = "flag (--" + f.flag + ")"
+		}
+	}
+
+	return cfg, nil
+}
+
+// applyFile はJSON形式の設定ファイルの値を反映する
+// ファイルが存在しない場合は何もしない。project が true の場合はワークスペース設定ファイルで指定できる項目だけを受け付ける
+func (c *Config) applyFile(path, label string, project bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+
+	// エラーメッセージを安定させるためにキー順で処理する
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f, ok := lookupField(key)
+		if !ok {
+			return fmt.Errorf("unknown key %q in config file %q", key, path)
+		}
+		if project && !f.repo {
+			return fmt.Errorf("key %q is not allowed in project config file %q; set it in the user config file or environment", key, path)
+		}
+		if values[key] == nil {
+			continue
+		}
+		// 文字列以外の値（数値・真偽値・配列）はJSONの表記で渡す
+		value, ok := values[key].(string)
+		if !ok {
+			data, err := json.Marshal(values[key])
+			if err != nil {
+				return fmt.Errorf("invalid value for %q in config file %q: %w", key, path, err)
+			}
+			value = string(data)
+		}
+		if err := f.set(c, value); err != nil {
+			return fmt.Errorf("invalid value for %q in config file %q: %w", key, path, err)
+		}
+		c.sources[key] = label + " (" + path + ")"
+	}
+
+	return nil
+}
+
+func lookupField(key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// parseDays は期間を解析する
+// time.ParseDuration の形式に加えて、日数を "90d" のように指定できる。負の期間はエラーにする
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if s == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %q must not be negative", s)
+	}
+	return d, nil
+}
+
+// formatDays は期間を parseDays で解析できる形式で返す（日単位で割り切れる場合は日数で表す）
+func formatDays(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d%day == 0 {
+		return strconv.Itoa(int(d/day)) + "d"
+	}
+	return d.String()
+}
+
+// parseList は文字列の一覧を解析する
+// JSONの配列（["a", "b"]）か、カンマ区切りの文字列を受け付ける。カンマを含む値は配列で指定する
+func parseList(s string) ([]string, error) {
+	if strings.HasPrefix(strings.TrimSpace(s), "[") {
+		var list []string
+		if err := json.Unmarshal([]byte(s), &list); err != nil {
+			return nil, fmt.Errorf("invalid list %q: %w", s, err)
+		}
+		return list, nil
+	}
+
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
+
+// formatList は文字列の一覧を parseList で解析できるJSONの配列で返す
+func formatList(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+// maskSecret は秘密情報の末尾4文字以外を伏せる
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return "********"
+	}
+	return "********" + s[len(s)-4:]
+}
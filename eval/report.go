@@ -0,0 +1,132 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+// Result は1つのタスクの実行結果
+type Result struct {
+	Task          string        `json:"task"`                   // タスク名
+	Passed        bool          `json:"passed"`                 // チェックコマンドが成功したか
+	Error         string        `json:"error,omitempty"`        // エージェントまたはチェックコマンドの実行エラー
+	CheckOutput   string        `json:"check_output,omitempty"` // チェックコマンドの出力（末尾のみ）
+	Turns         int           `json:"turns"`                  // モデルの呼び出し回数
+	ToolCalls     int           `json:"tool_calls"`             // ツールの呼び出し回数
+	Usage         session.Usage `json:"usage"`                  // トークン使用量
+	AgentDuration time.Duration `json:"agent_duration_ns"`      // エージェントの実行時間
+	Duration      time.Duration `json:"duration_ns"`            // チェックを含む全体の実行時間
+}
+
+// Report は評価全体の結果
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Results    []Result  `json:"results"`
+}
+
+// Summary は評価結果の集計
+type Summary struct {
+	Tasks     int           `json:"tasks"`
+	Passed    int           `json:"passed"`
+	PassRate  float64       `json:"pass_rate"`
+	Turns     int           `json:"turns"`
+	ToolCalls int           `json:"tool_calls"`
+	Usage     session.Usage `json:"usage"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// Summary は結果を集計する
+func (r *Report) Summary() Summary {
+	var s Summary
+	for _, result := range r.Results {
+		s.Tasks++
+		if result.Passed {
+			s.Passed++
+		}
+		s.Turns += result.Turns
+		s.ToolCalls += result.ToolCalls
+		s.Usage.Add(result.Usage)
+		s.Duration += result.Duration
+	}
+	if s.Tasks > 0 {
+		s.PassRate = float64(s.Passed) / float64(s.Tasks)
+	}
+	return s
+}
+
+// WriteJSON はレポートをJSON形式で書き出す
+func (r *Report) WriteJSON(w io.Writer) error {
+	out := struct {
+		*Report
+		Summary Summary `json:"summary"`
+	}{r, r.Summary()}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
+	}
+	return nil
+}
+
+// WriteMarkdown はレポートをMarkdown形式で書き出す
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	s := r.Summary()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Evaluation Report\n\n")
+	fmt.Fprintf(&b, "- Started: %s\n", r.StartedAt.Format(time.RFC3339))
+	if s.Usage.Model != "" {
+		fmt.Fprintf(&b, "- Model: %s\n", s.Usage.Model)
+	}
+	for _, m := range s.Usage.Models {
+		fmt.Fprintf(&b, "- Model: %s (%d input, %d output, $%.4f)\n", m.Model, m.InputTokens, m.OutputTokens, m.CostUSD)
+	}
+	fmt.Fprintf(&b, "- Pass rate: %d/%d (%.1f%%)\n", s.Passed, s.Tasks, s.PassRate*100)
+	fmt.Fprintf(&b, "- Turns: %d, Tool calls: %d\n", s.Turns, s.ToolCalls)
+	fmt.Fprintf(&b, "- Tokens: %d input (%d cached), %d output (%d reasoning)\n",
+		s.Usage.InputTokens, s.Usage.CachedTokens, s.Usage.OutputTokens, s.Usage.ReasoningTokens)
+	fmt.Fprintf(&b, "- Estimated cost: $%.4f\n", s.Usage.CostUSD)
+	fmt.Fprintf(&b, "- Total time: %s\n\n", s.Duration.Round(time.Millisecond))
+
+	fmt.Fprintf(&b, "| Task | Result | Turns | Tool calls | Input tokens | Output tokens | Cost (USD) | Time |\n")
+	fmt.Fprintf(&b, "|------|--------|------:|-----------:|-------------:|--------------:|-----------:|-----:|\n")
+	for _, result := range r.Results {
+		status := "✅ pass"
+		if !result.Passed {
+			status = "❌ fail"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %d | %.4f | %s |\n",
+			escapeTableCell(result.Task), status, result.Turns, result.ToolCalls,
+			result.Usage.InputTokens, result.Usage.OutputTokens, result.Usage.CostUSD,
+			result.Duration.Round(time.Millisecond))
+	}
+
+	for _, result := range r.Results {
+		if result.Passed {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", result.Task)
+		if result.Error != "" {
+			fmt.Fprintf(&b, "Error: %s\n\n", result.Error)
+		}
+		if result.CheckOutput != "" {
+			fmt.Fprintf(&b, "```\n%s\n```\n", strings.TrimRight(result.CheckOutput, "\n"))
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write Markdown report: %w", err)
+	}
+	return nil
+}
+
+func escapeTableCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,179 @@
+// Package eval はコーディングタスクを実行してエージェントの性能を測定する評価ハーネスを提供する
+//
+// 各タスクはフィクスチャを一時ディレクトリにコピーし、そのディレクトリを作業ディレクトリとして
+// エージェントに指示を与え、最後にチェックコマンドで成否を判定する。
+// ツールは作業ディレクトリからの相対パスで動作するため、タスクは1つずつ順番に実行する
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinford/coding-agent-example/ai"
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// maxCheckOutput はレポートに残すチェックコマンドの出力の最大バイト数
+const maxCheckOutput = 4096
+
+// Runner はタスクを実行する
+type Runner struct {
+	APIKey        string          // APIキー
+	ClientOptions []ai.OptionFunc // OpenAIClient のオプション（モデル設定や接続先など）
+	Progress      io.Writer       // 進捗の出力先（nil の場合は出力しない）
+}
+
+// Run は全てのタスクを順番に実行してレポートを返す
+func (r *Runner) Run(ctx context.Context, tasks []*Task) (*Report, error) {
+	report := &Report{StartedAt: time.Now()}
+
+	for i, task := range tasks {
+		r.progressf("[%d/%d] %s ... ", i+1, len(tasks), task.Name)
+
+		result, err := r.runTask(ctx, task)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, *result)
+
+		if result.Passed {
+			r.progressf("PASS (%s)\n", result.Duration.Round(time.Millisecond))
+		} else {
+			r.progressf("FAIL (%s)\n", result.Duration.Round(time.Millisecond))
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// runTask は1つのタスクを実行する
+// タスク自体の失敗は Result に記録し、評価を継続できない場合のみエラーを返す
+func (r *Runner) runTask(ctx context.Context, task *Task) (*Result, error) {
+	result := &Result{Task: task.Name}
+
+	workDir, err := os.MkdirTemp("", "coding-agent-eval-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	if task.Fixture != "" {
+		if err := os.CopyFS(workDir, os.DirFS(task.FixtureDir())); err != nil {
+			return nil, fmt.Errorf("failed to copy fixture for %q: %w", task.Name, err)
+		}
+	}
+
+	// ツールは作業ディレクトリからの相対パスで動作するため、タスクの間だけ移動する
+	origDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	if err := os.Chdir(workDir); err != nil {
+		return nil, fmt.Errorf("failed to change directory: %w", err)
+	}
+	defer os.Chdir(origDir)
+
+	timeout := time.Duration(task.Timeout)
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// ユーザー単位の指示ファイルは読み込まず、フィクスチャの AGENTS.md のみを使う
+	instructions, err := ai.LoadInstructions(workDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var apiCalls atomic.Int64
+	countCalls := func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/responses") {
+			apiCalls.Add(1)
+		}
+		return next(req)
+	}
+
+	store := session.NewInMemoryStore()
+	opts := append([]ai.OptionFunc{ai.WithInstructions(instructions)}, r.ClientOptions...)
+	// タイトルの生成はタスクの評価に関係しないため、API呼び出しの回数や使用量に含めない
+	opts = append(opts, ai.WithTitleModel(""), ai.WithRequestOptions(option.WithMiddleware(countCalls)))
+	client := ai.NewOpenAIClient(r.APIKey, store, opts...)
+	sessionID := session.NewSessionID()
+
+	start := time.Now()
+	if _, err := client.GenerateResponse(ctx, task.Instruction, sessionID); err != nil {
+		result.Error = err.Error()
+	}
+	result.AgentDuration = time.Since(start)
+
+	if result.Error == "" {
+		passed, output, err := runCheck(ctx, workDir, task.Check)
+		result.Passed = passed
+		result.CheckOutput = output
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+	result.Duration = time.Since(start)
+	result.Turns = int(apiCalls.Load())
+
+	turns, err := store.List(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, turn := range turns {
+		result.ToolCalls += len(turn.ToolCalls)
+	}
+	result.Usage = session.SumUsage(turns)
+
+	return result, nil
+}
+
+// runCheck はチェックコマンドを実行し、終了コードが0なら成功とする
+func runCheck(ctx context.Context, dir, command string) (passed bool, output string, err error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	runErr := cmd.Run()
+	output = tail(buf.String(), maxCheckOutput)
+
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+		return true, output, nil
+	case errors.As(runErr, &exitErr):
+		return false, output, nil
+	default:
+		return false, output, fmt.Errorf("failed to run check command: %w", runErr)
+	}
+}
+
+// tail は文字列の末尾 n バイトを返す（テストの失敗内容は出力の末尾に現れることが多いため）
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+func (r *Runner) progressf(format string, args ...any) {
+	if r.Progress != nil {
+		fmt.Fprintf(r.Progress, format, args...)
+	}
+}
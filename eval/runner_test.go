@@ -0,0 +1,101 @@
+package eval_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jinford/coding-agent-example/ai"
+	"github.com/jinford/coding-agent-example/ai/aitest"
+	"github.com/jinford/coding-agent-example/eval"
+	"github.com/openai/openai-go/v3/option"
+)
+
+func TestRunner_Run(t *testing.T) {
+	tasks, err := eval.LoadTasks("testdata/tasks")
+	if err != nil {
+		t.Fatalf("LoadTasks returned error: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Name != "greeting" || tasks[1].Name != "untouched" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+
+	// OpenAI互換のローカルサーバーとして偽モデルを起動する
+	model := aitest.NewModel(
+		// greeting: ファイルを書き換えて成功する
+		aitest.CallTool("read_file", map[string]any{"path": "greeting.txt"}),
+		aitest.CallTool("write_file", map[string]any{"path": "greeting.txt", "content": "Hello, eval!\n"}),
+		aitest.Reply("変更しました"),
+		// untouched: 何もせずに回答して失敗する
+		aitest.Reply("できませんでした"),
+	)
+	server := httptest.NewServer(model)
+	defer server.Close()
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &eval.Runner{
+		APIKey: "test-api-key",
+		ClientOptions: []ai.OptionFunc{
+			ai.WithRequestOptions(option.WithBaseURL(server.URL+"/v1"), option.WithMaxRetries(0)),
+		},
+	}
+	report, err := runner.Run(context.Background(), tasks)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	// 作業ディレクトリが元に戻り、フィクスチャが変更されていないこと
+	if dir, _ := os.Getwd(); dir != origDir {
+		t.Errorf("working directory was not restored: %s", dir)
+	}
+	if content, _ := os.ReadFile("testdata/tasks/greeting/repo/greeting.txt"); string(content) != "Hello\n" {
+		t.Errorf("fixture was modified: %q", content)
+	}
+
+	if len(report.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(report.Results))
+	}
+	greeting, untouched := report.Results[0], report.Results[1]
+	if !greeting.Passed || greeting.Turns != 3 || greeting.ToolCalls != 2 || greeting.Usage.InputTokens != 300 {
+		t.Errorf("unexpected greeting result: %+v", greeting)
+	}
+	if untouched.Passed || untouched.Turns != 1 || untouched.ToolCalls != 0 {
+		t.Errorf("unexpected untouched result: %+v", untouched)
+	}
+
+	summary := report.Summary()
+	if summary.Tasks != 2 || summary.Passed != 1 || summary.PassRate != 0.5 || summary.ToolCalls != 2 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	var md bytes.Buffer
+	if err := report.WriteMarkdown(&md); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(md.String(), "Pass rate: 1/2 (50.0%)") || !strings.Contains(md.String(), "## untouched") {
+		t.Errorf("unexpected markdown report:\n%s", md.String())
+	}
+
+	var js bytes.Buffer
+	if err := report.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Summary eval.Summary  `json:"summary"`
+		Results []eval.Result `json:"results"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if decoded.Summary.Passed != 1 || len(decoded.Results) != 2 {
+		t.Errorf("unexpected JSON report: %s", js.String())
+	}
+}
@@ -0,0 +1,145 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TaskFileName はディレクトリを指定した場合に読み込むタスク定義ファイルの名前
+const TaskFileName = "task.json"
+
+// Task は評価用のコーディングタスク
+type Task struct {
+	Name        string   `json:"name"`              // タスク名
+	Fixture     string   `json:"fixture"`           // 初期状態のリポジトリ（タスク定義ファイルからの相対パス）
+	Instruction string   `json:"instruction"`       // エージェントへの指示
+	Check       string   `json:"check"`             // 成否を判定するコマンド（作業ディレクトリで sh -c により実行し、終了コード0で成功）
+	Timeout     Duration `json:"timeout,omitempty"` // タスク全体のタイムアウト（省略時は DefaultTimeout）
+
+	dir string // タスク定義ファイルのあるディレクトリ
+}
+
+// DefaultTimeout はタスクのタイムアウトの既定値
+const DefaultTimeout = 10 * time.Minute
+
+// FixtureDir はフィクスチャディレクトリの絶対パスを返す
+func (t *Task) FixtureDir() string {
+	if filepath.IsAbs(t.Fixture) {
+		return t.Fixture
+	}
+	return filepath.Join(t.dir, t.Fixture)
+}
+
+// Validate はタスク定義が有効か検証する
+func (t *Task) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("task name is empty")
+	}
+	if t.Instruction == "" {
+		return fmt.Errorf("task %q: instruction is empty", t.Name)
+	}
+	if t.Check == "" {
+		return fmt.Errorf("task %q: check command is empty", t.Name)
+	}
+	if t.Fixture != "" {
+		info, err := os.Stat(t.FixtureDir())
+		if err != nil {
+			return fmt.Errorf("task %q: fixture: %w", t.Name, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("task %q: fixture %q is not a directory", t.Name, t.FixtureDir())
+		}
+	}
+	return nil
+}
+
+// LoadTasks はタスク定義を読み込む
+// ディレクトリを指定した場合は、その配下の全ての task.json を読み込む
+func LoadTasks(paths ...string) ([]*Task, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %q: %w", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && d.Name() == TaskFileName {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %q: %w", path, err)
+		}
+	}
+	sort.Strings(files)
+
+	tasks := make([]*Task, 0, len(files))
+	for _, file := range files {
+		task, err := loadTask(file)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+func loadTask(path string) (*Task, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task %q: %w", path, err)
+	}
+
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("failed to parse task %q: %w", path, err)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve task path %q: %w", path, err)
+	}
+	task.dir = filepath.Dir(abs)
+
+	if err := task.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid task %q: %w", path, err)
+	}
+
+	return &task, nil
+}
+
+// Duration は "5m" のような文字列で表す期間
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	// DefaultMaxSize はログファイルをローテーションするサイズ
+	DefaultMaxSize = 10 * 1024 * 1024
+	// DefaultMaxBackups は保持する古いログファイルの数
+	DefaultMaxBackups = 5
+)
+
+// ParseLevel はログレベルの文字列（debug, info, warn, error）を解析する
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: %w", s, err)
+	}
+	return level, nil
+}
+
+// NewLogger はJSON形式で出力するロガーを作成する
+// 文字列の属性に含まれる秘密情報は伏せて出力する
+func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}))
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretPatterns はログに残してはならない秘密情報のパターン
+var secretPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// OpenAI のAPIキー
+	{regexp.MustCompile(`sk-[A-Za-z0-9_\-]{16,}`), redacted},
+	// Authorization ヘッダー
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._\-~+/=]+`), "${1}" + redacted},
+	// JSON中の秘密情報らしきキー
+	{regexp.MustCompile(`(?i)("(?:api_?key|password|secret|token|access_token|refresh_token)"\s*:\s*)"[^"]*"`), `${1}"` + redacted + `"`},
+}
+
+// secretHeaders は値を伏せるHTTPヘッダー（小文字）
+var secretHeaders = map[string]bool{
+	"authorization":       true,
+	"api-key":             true,
+	"openai-organization": true,
+	"openai-project":      true,
+	"set-cookie":          true,
+	"cookie":              true,
+}
+
+// secretAttrKeys は値を伏せるログ属性のキー（小文字）
+var secretAttrKeys = map[string]bool{
+	"api_key":       true,
+	"apikey":        true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+}
+
+// Redact は文字列中の秘密情報を伏せる
+func Redact(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// IsSecretHeader はHTTPヘッダーの値を伏せるべきか判定する
+func IsSecretHeader(name string) bool {
+	return secretHeaders[strings.ToLower(name)]
+}
+
+// redactAttr は slog.HandlerOptions.ReplaceAttr として秘密情報を伏せる
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if secretAttrKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, Redact(a.Value.String()))
+	}
+	return a
+}
@@ -0,0 +1,571 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// 暗号化に関するエラー
+var (
+	// ErrEncryptionKeyRequired は暗号化されたデータベースを鍵を指定せずに開いた場合のエラー
+	ErrEncryptionKeyRequired = errors.New("session database is encrypted; configure session_encryption to open it")
+	// ErrNotEncrypted は暗号化されていない会話履歴があるデータベースを鍵を指定して開いた場合のエラー
+	ErrNotEncrypted = errors.New("session database contains unencrypted sessions; run `coding-agent sessions encrypt` first")
+	// ErrWrongEncryptionKey は鍵がデータベースの暗号化に使った鍵と一致しない場合のエラー
+	ErrWrongEncryptionKey = errors.New("encryption key does not match the session database")
+	// ErrEncryptionKeyNotFound は暗号化されたデータベースの鍵が保存されていない場合のエラー
+	ErrEncryptionKeyNotFound = errors.New("encryption key is not found")
+)
+
+// 暗号化した値の先頭に付ける印（暗号文の形式のバージョン）
+// 値が暗号文かどうかは印ではなくデータベースの暗号化の状態で判断する。
+// 暗号化したデータベースの値は全て暗号文で、暗号化していないデータベースの値は印で始まっていても平文として扱う
+const (
+	legacyEncryptedPrefix = "enc:v1:" // 関連データを使わずに暗号化した値（開いたときに sealedPrefix に移行する）
+	sealedPrefix          = "enc:v2:" // 保存場所を関連データとして暗号化した値
+)
+
+// keyCheckPlaintext は鍵が正しいかを確認するために暗号化して保存する値
+const keyCheckPlaintext = "coding-agent session key check"
+
+// keyCheckAAD は鍵の確認用の値の関連データ
+var keyCheckAAD = []byte("encryption.key_check")
+
+// 暗号化するカラム（関連データに含める名前）
+const (
+	turnContentColumn   = "conversation_turns.content"
+	turnMetadataColumn  = "conversation_turns.metadata"
+	toolArgumentsColumn = "tool_calls.arguments"
+	toolResultColumn    = "tool_calls.result"
+	metadataValueColumn = "session_metadata.value"
+)
+
+// fieldAAD は暗号化する値の保存場所を表す関連データを返す
+// 暗号文を別のセッション・ターン・カラムにコピーしても復号できないよう、保存場所と結び付けて暗号化する。
+// scope はターンのカラムではターンのID、セッション単位のメタデータではキー
+func fieldAAD(column, sessionID, scope string) []byte {
+	return []byte(column + "\x00" + sessionID + "\x00" + scope)
+}
+
+// turnAAD はターンとそのツール呼び出しのカラムの関連データを返す
+func turnAAD(column string, sessionID SessionID, turnID int64) []byte {
+	return fieldAAD(column, sessionID.String(), strconv.FormatInt(turnID, 10))
+}
+
+// metadataAAD はセッション単位のメタデータの値の関連データを返す
+func metadataAAD(sessionID SessionID, key string) []byte {
+	return fieldAAD(metadataValueColumn, sessionID.String(), key)
+}
+
+// KeySource はデータベースを暗号化する鍵の取得元
+type KeySource interface {
+	// Key はデータベースごとのソルトから32バイトの鍵を返す
+	Key(salt []byte) ([]byte, error)
+}
+
+// KeyCreator は鍵が保存されていない場合に新しく作成できる KeySource が実装する
+// 暗号化を有効にするときだけ使い、暗号化されたデータベースを開くときは Key で保存済みの鍵だけを取得する
+type KeyCreator interface {
+	// CreateKey は保存済みの鍵を返し、保存されていない場合は新しい鍵を作成して保存する
+	CreateKey(salt []byte) ([]byte, error)
+}
+
+// PassphraseFile はファイルに保存したパスフレーズから鍵を導出する
+type PassphraseFile struct {
+	Path string // パスフレーズを1行で保存したファイル
+}
+
+// passphraseIterations はパスフレーズから鍵を導出する PBKDF2 の反復回数
+const passphraseIterations = 600_000
+
+// Key はパスフレーズとソルトから PBKDF2-SHA256 で鍵を導出する
+func (p PassphraseFile) Key(salt []byte) ([]byte, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	passphrase := strings.TrimSpace(string(data))
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase file %s is empty", p.Path)
+	}
+	return pbkdf2.Key(sha256.New, passphrase, salt, passphraseIterations, 32)
+}
+
+// Keyring はOSのキーリング（macOS のキーチェーン、Secret Service、Windows の資格情報マネージャー）に鍵を保存する
+type Keyring struct {
+	Service string // キーリングのサービス名
+	User    string // キーリングのアカウント名
+}
+
+// Key はキーリングから鍵を取得する（ソルトは使わない）
+// 鍵が保存されていない場合は ErrEncryptionKeyNotFound を返す。暗号化されたデータベースに別の鍵を作らないよう、ここでは作成しない
+func (k Keyring) Key(_ []byte) ([]byte, error) {
+	encoded, err := keyring.Get(k.Service, k.User)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("keyring (%s/%s): %w", k.Service, k.User, ErrEncryptionKeyNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key from keyring: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("encryption key in keyring (%s/%s) is malformed", k.Service, k.User)
+	}
+	return key, nil
+}
+
+// CreateKey はキーリングから鍵を取得し、保存されていない場合はランダムな鍵を生成して保存する
+func (k Keyring) CreateKey(salt []byte) ([]byte, error) {
+	key, err := k.Key(salt)
+	if !errors.Is(err, ErrEncryptionKeyNotFound) {
+		return key, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	if err := keyring.Set(k.Service, k.User, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to save encryption key to keyring: %w", err)
+	}
+	return key, nil
+}
+
+// fieldCipher はカラムの値を AES-256-GCM で暗号化・復号する
+type fieldCipher struct {
+	aead cipher.AEAD
+}
+
+func newFieldCipher(key []byte) (*fieldCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return &fieldCipher{aead: aead}, nil
+}
+
+// seal は値を保存場所の関連データと結び付けて暗号化する
+func (c *fieldCipher) seal(plaintext string, aad []byte) string {
+	nonce := make([]byte, c.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), aad)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// open は seal で暗号化した値を復号する
+func (c *fieldCipher) open(value string, aad []byte) (string, error) {
+	if !strings.HasPrefix(value, sealedPrefix) {
+		return "", fmt.Errorf("unsupported encrypted value")
+	}
+	return c.openSealed(strings.TrimPrefix(value, sealedPrefix), aad)
+}
+
+// openLegacy は関連データを使わずに暗号化した値（legacyEncryptedPrefix）を復号する
+// 移行の前に保存した値を読むときだけ使う
+func (c *fieldCipher) openLegacy(value string) (string, error) {
+	if !strings.HasPrefix(value, legacyEncryptedPrefix) {
+		return "", fmt.Errorf("unsupported encrypted value")
+	}
+	return c.openSealed(strings.TrimPrefix(value, legacyEncryptedPrefix), nil)
+}
+
+// openSealed は印を除いた暗号文を復号する
+func (c *fieldCipher) openSealed(encoded string, aad []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return "", ErrWrongEncryptionKey
+	}
+	return string(plaintext), nil
+}
+
+// seal は暗号化が有効な場合に値を暗号化する
+func (s *SQLiteStore) seal(value string, aad []byte) string {
+	if s.cipher == nil {
+		return value
+	}
+	return s.cipher.seal(value, aad)
+}
+
+// sealNull は NULL でない値を暗号化する
+func (s *SQLiteStore) sealNull(value sql.NullString, aad []byte) sql.NullString {
+	if !value.Valid {
+		return value
+	}
+	return sql.NullString{String: s.seal(value.String, aad), Valid: true}
+}
+
+// open は暗号化が有効な場合に値を復号する
+// aad は暗号化したときの保存場所の関連データで、別の場所からコピーした暗号文は復号できない。
+// 空の値は値がないこと（COALESCE で補った値）を表すため、そのまま返す
+func (s *SQLiteStore) open(value string, aad []byte) (string, error) {
+	if s.cipher == nil || value == "" {
+		return value, nil
+	}
+	return s.cipher.open(value, aad)
+}
+
+// Encrypted はデータベースが暗号化されているかを返す
+func (s *SQLiteStore) Encrypted() bool {
+	return s.cipher != nil
+}
+
+// initEncryption はデータベースの暗号化の状態を確認し、鍵を設定する
+// 鍵を指定しない場合、暗号化されたデータベースは開けない。
+// 鍵を指定した場合、会話履歴のないデータベースは暗号化を有効にし、平文の会話履歴がある場合は sessions encrypt を求める
+func (s *SQLiteStore) initEncryption(ctx context.Context) error {
+	var (
+		salt     []byte
+		keyCheck string
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT salt, key_check FROM encryption WHERE id = 1`).Scan(&salt, &keyCheck)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if s.keySource == nil {
+			return nil
+		}
+		var turns int
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM conversation_turns`).Scan(&turns); err != nil {
+			return fmt.Errorf("failed to count turns: %w", err)
+		}
+		if turns > 0 {
+			return ErrNotEncrypted
+		}
+		return s.Encrypt(ctx, s.keySource)
+	case err != nil:
+		return fmt.Errorf("failed to query encryption settings: %w", err)
+	}
+
+	if s.keySource == nil {
+		return ErrEncryptionKeyRequired
+	}
+	key, err := s.keySource.Key(salt)
+	if err != nil {
+		return err
+	}
+	c, err := newFieldCipher(key)
+	if err != nil {
+		return err
+	}
+
+	legacy := strings.HasPrefix(keyCheck, legacyEncryptedPrefix)
+	var check string
+	if legacy {
+		check, err = c.openLegacy(keyCheck)
+	} else {
+		check, err = c.open(keyCheck, keyCheckAAD)
+	}
+	if err != nil || check != keyCheckPlaintext {
+		return ErrWrongEncryptionKey
+	}
+
+	// 関連データを使わずに暗号化したデータベースは、保存場所と結び付けて暗号化し直す
+	if legacy {
+		if err := s.upgradeEncryption(ctx, c); err != nil {
+			return err
+		}
+	}
+	s.cipher = c
+	return nil
+}
+
+// upgradeEncryption は関連データを使わずに暗号化した値を全て、保存場所を関連データとして暗号化し直す
+func (s *SQLiteStore) upgradeEncryption(ctx context.Context, c *fieldCipher) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, column := range encryptedColumns {
+		if err := sealColumn(ctx, tx, c, column, true); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE encryption SET key_check = ? WHERE id = 1`,
+		c.seal(keyCheckPlaintext, keyCheckAAD)); err != nil {
+		return fmt.Errorf("failed to update encryption settings: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.logger.InfoContext(ctx, "session store encryption upgraded", "version", sealedPrefix)
+	return nil
+}
+
+// Encrypt はデータベースの暗号化を有効にし、保存済みの発言内容・ツール呼び出し・メタデータを暗号化する
+// 暗号化した値は全文検索できないため、検索インデックスは削除する。
+// 平文が未使用の領域に残らないよう、暗号化の後に VACUUM する
+func (s *SQLiteStore) Encrypt(ctx context.Context, source KeySource) error {
+	if s.cipher != nil {
+		return fmt.Errorf("session database is already encrypted")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	// 暗号化を有効にするときだけ、保存されていない鍵を作成する
+	var (
+		key []byte
+		err error
+	)
+	if creator, ok := source.(KeyCreator); ok {
+		key, err = creator.CreateKey(salt)
+	} else {
+		key, err = source.Key(salt)
+	}
+	if err != nil {
+		return err
+	}
+	c, err := newFieldCipher(key)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO encryption (id, salt, key_check)
+		VALUES (1, ?, ?)
+	`, salt, c.seal(keyCheckPlaintext, keyCheckAAD)); err != nil {
+		return fmt.Errorf("failed to save encryption settings: %w", err)
+	}
+
+	for _, column := range encryptedColumns {
+		if err := sealColumn(ctx, tx, c, column, false); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS turn_search`); err != nil {
+		return fmt.Errorf("failed to drop search index: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.cipher = c
+	s.searchModule = ""
+
+	if _, err := s.vacuum(ctx); err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "session store encrypted")
+	return nil
+}
+
+// encryptedColumn は暗号化するカラム
+type encryptedColumn struct {
+	table   string
+	key     string // 行を特定するカラム
+	column  string
+	session string // 関連データに含めるセッションIDの式
+	scope   string // 関連データに含めるターンのIDまたはメタデータのキーの式
+}
+
+// encryptedColumns は暗号化するカラムの一覧
+var encryptedColumns = []encryptedColumn{
+	{"conversation_turns", "id", "content", "session_id", "id"},
+	{"conversation_turns", "id", "metadata", "session_id", "id"},
+	{"tool_calls", "id", "arguments", "(SELECT session_id FROM conversation_turns WHERE id = tool_calls.turn_id)", "turn_id"},
+	{"tool_calls", "id", "result", "(SELECT session_id FROM conversation_turns WHERE id = tool_calls.turn_id)", "turn_id"},
+	{"session_metadata", "rowid", "value", "session_id", "key"},
+}
+
+// sealColumn はカラムの全ての値を保存場所と結び付けて暗号化する
+// legacy が false の場合は全ての値を平文として、true の場合は関連データを使わずに暗号化した値として扱う
+func sealColumn(ctx context.Context, tx *sql.Tx, c *fieldCipher, col encryptedColumn, legacy bool) error {
+	name := col.table + "." + col.column
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s, %s, %s, %s FROM %s
+		WHERE %s IS NOT NULL
+	`, col.key, col.column, col.session, col.scope, col.table, col.column))
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	type row struct {
+		id        int64
+		value     string
+		sessionID string
+		scope     string
+	}
+	var values []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.value, &r.sessionID, &r.scope); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		values = append(values, r)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	for _, r := range values {
+		if legacy {
+			if r.value, err = c.openLegacy(r.value); err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, col.table, col.column, col.key),
+			c.seal(r.value, fieldAAD(name, r.sessionID, r.scope)), r.id); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// resealFork は分岐したセッションにコピーした暗号文を、コピー先のセッションとターンに結び付けて暗号化し直す
+// 暗号文は保存場所と結び付けているため、コピーしたままでは復号できない
+func (s *SQLiteStore) resealFork(ctx context.Context, tx *sql.Tx, sessionID, forkID SessionID) error {
+	// コピー先のターンのIDからコピー元のターンのIDへの対応
+	sources := make(map[int64]int64)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT src.id, dst.id
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n
+			FROM conversation_turns
+			WHERE session_id = ?
+		) src
+		JOIN (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n
+			FROM conversation_turns
+			WHERE session_id = ?
+		) dst ON dst.n = src.n
+	`, sessionID.String(), forkID.String())
+	if err != nil {
+		return fmt.Errorf("failed to query forked turns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var src, dst int64
+		if err := rows.Scan(&src, &dst); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		sources[dst] = src
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	reseal := func(value string, from, to []byte) (string, error) {
+		plaintext, err := s.open(value, from)
+		if err != nil {
+			return "", err
+		}
+		return s.seal(plaintext, to), nil
+	}
+
+	// ターンとツール呼び出しのカラム
+	for _, col := range encryptedColumns {
+		if col.table == "session_metadata" {
+			continue
+		}
+		name := col.table + "." + col.column
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+			SELECT %s, %s, %s FROM %s
+			WHERE %s IS NOT NULL AND %s = ?
+		`, col.key, col.scope, col.column, col.table, col.column, col.session), forkID.String())
+		if err != nil {
+			return fmt.Errorf("failed to query %s: %w", name, err)
+		}
+		type row struct {
+			id, turnID int64
+			value      string
+		}
+		var values []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.turnID, &r.value); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			values = append(values, r)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to iterate rows: %w", err)
+		}
+		rows.Close()
+
+		for _, r := range values {
+			sealed, err := reseal(r.value, turnAAD(name, sessionID, sources[r.turnID]), turnAAD(name, forkID, r.turnID))
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", name, err)
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, col.table, col.column, col.key),
+				sealed, r.id); err != nil {
+				return fmt.Errorf("failed to encrypt %s: %w", name, err)
+			}
+		}
+	}
+
+	// セッション単位のメタデータ
+	rows, err = tx.QueryContext(ctx, `
+		SELECT key, value FROM session_metadata
+		WHERE session_id = ?
+	`, forkID.String())
+	if err != nil {
+		return fmt.Errorf("failed to query session metadata: %w", err)
+	}
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		metadata[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	for key, value := range metadata {
+		sealed, err := reseal(value, metadataAAD(sessionID, key), metadataAAD(forkID, key))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt session metadata: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE session_metadata SET value = ?
+			WHERE session_id = ? AND key = ?
+		`, sealed, forkID.String(), key); err != nil {
+			return fmt.Errorf("failed to encrypt session metadata: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,424 @@
+package session_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/jinford/coding-agent-example/session/storetest"
+	"github.com/zalando/go-keyring"
+)
+
+// staticKey はテスト用の固定の鍵
+type staticKey byte
+
+func (k staticKey) Key(_ []byte) ([]byte, error) {
+	return bytes.Repeat([]byte{byte(k)}, 32), nil
+}
+
+func TestSQLiteStore_Encrypted(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) session.Store {
+		store, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"), session.WithEncryption(staticKey(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+const secret = "sk-secret-value-0123456789"
+
+// appendSecret は発言内容・ツール呼び出し・メタデータに秘密情報を含むセッションを保存する
+func appendSecret(t *testing.T, store *session.SQLiteStore, sessionID session.SessionID) {
+	t.Helper()
+	appendTurns(t, store, sessionID,
+		&session.ConversationTurn{Role: "user", Content: "token is " + secret},
+		&session.ConversationTurn{
+			Role:      "assistant",
+			Content:   "ok",
+			ToolCalls: []session.ToolCall{{Name: "read_file", Arguments: `{"path":".env"}`, Result: "TOKEN=" + secret}},
+			Metadata:  map[string]string{"note": secret},
+		},
+	)
+	if err := store.SetMetadata(context.Background(), sessionID, map[string]string{"title": secret}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertNoPlaintext はデータベースファイルに秘密情報が平文で含まれていないことを確認する
+func assertNoPlaintext(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(secret)) {
+		t.Error("database file contains the secret in plaintext")
+	}
+}
+
+func TestSQLiteStore_EncryptionKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := session.NewSQLiteStore(path, session.WithEncryption(staticKey(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := session.NewSessionID()
+	appendSecret(t, store, sessionID)
+	store.Close()
+
+	assertNoPlaintext(t, path)
+
+	if _, err := session.NewSQLiteStore(path); !errors.Is(err, session.ErrEncryptionKeyRequired) {
+		t.Errorf("opening without a key: expected ErrEncryptionKeyRequired, got %v", err)
+	}
+	if _, err := session.NewSQLiteStore(path, session.WithEncryption(staticKey(2))); !errors.Is(err, session.ErrWrongEncryptionKey) {
+		t.Errorf("opening with a wrong key: expected ErrWrongEncryptionKey, got %v", err)
+	}
+
+	store, err = session.NewSQLiteStore(path, session.WithEncryption(staticKey(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	assertSecretReadable(t, store, sessionID)
+}
+
+// assertSecretReadable は暗号化した値が復号して読めることを確認する
+func assertSecretReadable(t *testing.T, store *session.SQLiteStore, sessionID session.SessionID) {
+	t.Helper()
+	ctx := context.Background()
+
+	turns, err := store.List(ctx, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 || turns[0].Content != "token is "+secret ||
+		turns[1].ToolCalls[0].Result != "TOKEN="+secret || turns[1].Metadata["note"] != secret {
+		t.Errorf("unexpected turns: %+v", turns)
+	}
+	if metadata, err := store.GetMetadata(ctx, sessionID); err != nil || metadata["title"] != secret {
+		t.Errorf("GetMetadata = %v, %v", metadata, err)
+	}
+	if sessions, err := store.Sessions(ctx); err != nil || len(sessions) != 1 || sessions[0].Preview != "token is "+secret {
+		t.Errorf("Sessions = %+v, %v", sessions, err)
+	}
+	if _, err := store.Search(ctx, "token", 10); !errors.Is(err, session.ErrSearchUnavailable) {
+		t.Errorf("search must be unavailable on an encrypted database, got %v", err)
+	}
+}
+
+func TestSQLiteStore_EncryptExistingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := session.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := session.NewSessionID()
+	appendSecret(t, store, sessionID)
+	store.Close()
+
+	// 平文の会話履歴があるデータベースは暗号化するまで鍵を指定して開けない
+	if _, err := session.NewSQLiteStore(path, session.WithEncryption(staticKey(1))); !errors.Is(err, session.ErrNotEncrypted) {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+
+	store, err = session.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Encrypt(context.Background(), staticKey(1)); err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	if err := store.Encrypt(context.Background(), staticKey(1)); err == nil {
+		t.Error("encrypting twice must fail")
+	}
+	store.Close()
+
+	assertNoPlaintext(t, path)
+
+	store, err = session.NewSQLiteStore(path, session.WithEncryption(staticKey(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	assertSecretReadable(t, store, sessionID)
+}
+
+func TestSQLiteStore_MarkerLikePlaintext(t *testing.T) {
+	// 暗号文の印で始まる平文も、暗号化の有無にかかわらずそのまま読めること
+	values := []string{"enc:hello", "enc:v1:AAAA", "enc:v2:AAAA"}
+	appendValues := func(t *testing.T, store *session.SQLiteStore, sessionID session.SessionID) {
+		t.Helper()
+		for _, value := range values {
+			appendTurns(t, store, sessionID, &session.ConversationTurn{
+				Role:      "user",
+				Content:   value,
+				ToolCalls: []session.ToolCall{{Name: "read_file", Arguments: value, Result: value}},
+				Metadata:  map[string]string{"note": value},
+			})
+		}
+		if err := store.SetMetadata(context.Background(), sessionID, map[string]string{"title": values[0]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertValues := func(t *testing.T, store *session.SQLiteStore, sessionID session.SessionID) {
+		t.Helper()
+		ctx := context.Background()
+		turns, err := store.List(ctx, sessionID)
+		if err != nil {
+			t.Fatalf("List returned error: %v", err)
+		}
+		for i, turn := range turns {
+			if turn.Content != values[i] || turn.ToolCalls[0].Arguments != values[i] ||
+				turn.ToolCalls[0].Result != values[i] || turn.Metadata["note"] != values[i] {
+				t.Errorf("turn %d = %+v", i, turn)
+			}
+		}
+		sessions, err := store.Sessions(ctx)
+		if err != nil || len(sessions) != 1 || sessions[0].Title != values[0] || sessions[0].Preview != values[0] {
+			t.Errorf("Sessions = %+v, %v", sessions, err)
+		}
+	}
+
+	t.Run("unencrypted", func(t *testing.T) {
+		store, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		sessionID := session.NewSessionID()
+		appendValues(t, store, sessionID)
+		assertValues(t, store, sessionID)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		store, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"), session.WithEncryption(staticKey(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		sessionID := session.NewSessionID()
+		appendValues(t, store, sessionID)
+		assertValues(t, store, sessionID)
+	})
+
+	t.Run("encrypt existing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sessions.db")
+		store, err := session.NewSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionID := session.NewSessionID()
+		appendValues(t, store, sessionID)
+		if err := store.Encrypt(context.Background(), staticKey(1)); err != nil {
+			t.Fatalf("Encrypt returned error: %v", err)
+		}
+		store.Close()
+
+		store, err = session.NewSQLiteStore(path, session.WithEncryption(staticKey(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		assertValues(t, store, sessionID)
+	})
+}
+
+func TestPassphraseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(path, []byte("correct horse battery staple\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := session.PassphraseFile{Path: path}
+
+	a, err := source.Key([]byte("salt-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := source.Key([]byte("salt-a"))
+	other, _ := source.Key([]byte("salt-b"))
+	if len(a) != 32 || !bytes.Equal(a, again) || bytes.Equal(a, other) {
+		t.Error("keys must be derived deterministically from the passphrase and salt")
+	}
+
+	if err := os.WriteFile(path, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Key([]byte("salt-a")); err == nil {
+		t.Error("an empty passphrase must be rejected")
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	keyring.MockInit()
+	source := session.Keyring{Service: "coding-agent-test", User: "sessions"}
+
+	// 鍵が保存されていない場合、Key は鍵を作成せずに失敗すること
+	if _, err := source.Key(nil); !errors.Is(err, session.ErrEncryptionKeyNotFound) {
+		t.Fatalf("expected ErrEncryptionKeyNotFound, got %v", err)
+	}
+
+	// CreateKey は初回に鍵を生成して保存し、以降は同じ鍵を返すこと
+	first, err := source.CreateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := source.Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := source.CreateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 32 || !bytes.Equal(first, second) || !bytes.Equal(first, again) {
+		t.Error("keyring must return the stored key")
+	}
+}
+
+func TestSQLiteStore_EncryptedValueBoundToLocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := session.NewSQLiteStore(path, session.WithEncryption(staticKey(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, target := session.NewSessionID(), session.NewSessionID()
+	appendSecret(t, store, source)
+	appendTurns(t, store, target, &session.ConversationTurn{Role: "user", Content: "hello"})
+	store.Close()
+
+	// 別のセッションのターンに暗号文をコピーする
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		UPDATE conversation_turns
+		SET content = (SELECT content FROM conversation_turns WHERE session_id = ? ORDER BY id LIMIT 1)
+		WHERE session_id = ?
+	`, source.String(), target.String()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err = session.NewSQLiteStore(path, session.WithEncryption(staticKey(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.List(context.Background(), target); !errors.Is(err, session.ErrWrongEncryptionKey) {
+		t.Errorf("a value copied from another session must not decrypt, got %v", err)
+	}
+	if turns, err := store.List(context.Background(), source); err != nil || turns[0].Content != "token is "+secret {
+		t.Errorf("List = %+v, %v", turns, err)
+	}
+}
+
+func TestSQLiteStore_UpgradeLegacyEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := session.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := session.NewSessionID()
+	appendSecret(t, store, sessionID)
+	store.Close()
+
+	// 関連データを使わない以前の形式で暗号化する
+	key, _ := staticKey(1).Key(nil)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealLegacy := func(plaintext string) string {
+		nonce := make([]byte, aead.NonceSize())
+		rand.Read(nonce)
+		return "enc:v1:" + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plaintext), nil))
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO encryption (id, salt, key_check) VALUES (1, ?, ?)`,
+		[]byte("salt"), sealLegacy("coding-agent session key check")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DROP TABLE IF EXISTS turn_search`); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []struct{ table, key, column string }{
+		{"conversation_turns", "id", "content"},
+		{"conversation_turns", "id", "metadata"},
+		{"tool_calls", "id", "arguments"},
+		{"tool_calls", "id", "result"},
+		{"session_metadata", "rowid", "value"},
+	} {
+		rows, err := db.Query(fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s IS NOT NULL`,
+			column.key, column.column, column.table, column.column))
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := make(map[int64]string)
+		for rows.Next() {
+			var (
+				id    int64
+				value string
+			)
+			if err := rows.Scan(&id, &value); err != nil {
+				t.Fatal(err)
+			}
+			values[id] = value
+		}
+		rows.Close()
+		for id, value := range values {
+			if _, err := db.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, column.table, column.column, column.key),
+				sealLegacy(value), id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	db.Close()
+
+	// 開いたときに保存場所と結び付けた形式に暗号化し直すこと
+	store, err = session.NewSQLiteStore(path, session.WithEncryption(staticKey(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSecretReadable(t, store, sessionID)
+	store.Close()
+
+	db, err = sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var legacy int
+	if err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM conversation_turns WHERE content LIKE 'enc:v1:%' OR metadata LIKE 'enc:v1:%')
+			+ (SELECT COUNT(*) FROM tool_calls WHERE arguments LIKE 'enc:v1:%' OR result LIKE 'enc:v1:%')
+			+ (SELECT COUNT(*) FROM session_metadata WHERE value LIKE 'enc:v1:%')
+			+ (SELECT COUNT(*) FROM encryption WHERE key_check LIKE 'enc:v1:%')
+	`).Scan(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy != 0 {
+		t.Errorf("legacy encrypted values must be upgraded, %d remain", legacy)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package session
+
+import (
+	"errors"
+	"os"
+)
+
+// fileLockSupported はこのプラットフォームでファイルロックを使えるか
+// ロックできない環境では複数のプロセスの追記が混ざるため、JSONLStore を開かない
+const fileLockSupported = false
+
+// lockFile はファイルロックに対応していないことを返す
+func lockFile(f *os.File, exclusive bool) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package session
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fileLockSupported はこのプラットフォームでファイルロックを使えるか
+const fileLockSupported = true
+
+// lockFile はファイル全体のロックを取得する（取得できるまで待つ）
+// ロックはファイルを閉じると解放される
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package session
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileLockSupported はこのプラットフォームでファイルロックを使えるか
+const fileLockSupported = true
+
+// lockFile はファイル全体のロックを取得する（取得できるまで待つ）
+// ロックはファイルを閉じると解放される
+func lockFile(f *os.File, exclusive bool) error {
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	return windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, ^uint32(0), ^uint32(0), new(windows.Overlapped))
+}
@@ -0,0 +1,489 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// jsonlExt はセッションファイルの拡張子
+const jsonlExt = ".jsonl"
+
+// jsonlRecord はセッションファイルの1行
+// ファイルには追記のみを行い、読み込み時に先頭から順に適用して現在の状態を復元する
+type jsonlRecord struct {
+	Type     string            `json:"type"`                // "session", "turn", "metadata" のいずれか
+	ParentID SessionID         `json:"parent_id,omitempty"` // 分岐元のセッションID（"session" の場合）
+	Turn     *ConversationTurn `json:"turn,omitempty"`      // 追加したターン（"turn" の場合）
+	Metadata map[string]string `json:"metadata,omitempty"`  // 更新したメタデータ（"metadata" の場合。値が空文字列のキーは削除）
+
+	// 複数のレコードをまとめて追記した場合のみ設定する。
+	// 書き込みが途中で中断すると先頭の一部のレコードだけが残るため、読み込み時に全て揃ったまとまりだけを適用する
+	Batch     string `json:"batch,omitempty"`      // まとめて追記したレコードに共通の識別子
+	BatchSize int    `json:"batch_size,omitempty"` // まとめて追記したレコードの数
+}
+
+// JSONLStore はセッションごとに1つのJSONLファイルへ追記して保存する実装
+// ファイルは grep や diff でそのまま扱え、バージョン管理にコミットすることもできる。
+// 複数のプロセスから同じディレクトリを使えるよう、ファイルの読み書きはファイルロックで排他する
+type JSONLStore struct {
+	dir    string
+	logger *slog.Logger
+}
+
+// NewJSONLStore は新しいJSONLStoreを作成する
+// ディレクトリが存在しない場合は作成する
+func NewJSONLStore(dir string, opts ...JSONLOption) (*JSONLStore, error) {
+	s := &JSONLStore{dir: dir, logger: slog.Default()}
+	for _, f := range opts {
+		f(s)
+	}
+
+	// ファイルロックで排他できないと複数のプロセスの追記が混ざって壊れるため、開かない
+	if !fileLockSupported {
+		return nil, fmt.Errorf("jsonl session store is not supported on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create session dir: %w", err)
+	}
+
+	s.logger.Debug("session store opened", "dir", dir)
+
+	return s, nil
+}
+
+// JSONLOption は JSONLStore のオプション
+type JSONLOption func(*JSONLStore)
+
+// WithJSONLLogger はログの出力先を指定する
+func WithJSONLLogger(logger *slog.Logger) JSONLOption {
+	return func(s *JSONLStore) {
+		s.logger = logger
+	}
+}
+
+// path はセッションファイルのパスを返す
+// セッションIDはファイル名になるため、ディレクトリの外を指せないことを確認する
+func (s *JSONLStore) path(sessionID SessionID) (string, error) {
+	id := sessionID.String()
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid session id: %q", id)
+	}
+	return filepath.Join(s.dir, id+jsonlExt), nil
+}
+
+// jsonlSession はセッションファイルから復元したセッション
+type jsonlSession struct {
+	parentID SessionID
+	turns    []*ConversationTurn
+	metadata map[string]string
+}
+
+// List はセッションIDから会話履歴を取得する
+func (s *JSONLStore) List(ctx context.Context, sessionID SessionID) ([]*ConversationTurn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.read(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return sess.turns, nil
+}
+
+// Append は会話履歴に新しいターンを追加する
+// 全てのターンを1回の書き込みで追記するため、他のプロセスの追記と混ざらない
+func (s *JSONLStore) Append(ctx context.Context, sessionID SessionID, turns ...*ConversationTurn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(turns) == 0 {
+		return nil
+	}
+
+	records := make([]jsonlRecord, 0, len(turns))
+	for _, turn := range turns {
+		// 発言日時を設定したコピーを保存する（呼び出し元のデータを変更しない）
+		stored := *turn
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = time.Now()
+		}
+		records = append(records, jsonlRecord{Type: "turn", Turn: &stored})
+	}
+
+	if err := s.append(sessionID, records); err != nil {
+		return fmt.Errorf("failed to append turns: %w", err)
+	}
+
+	s.logger.Debug("turns appended", "session_id", sessionID, "turns", len(turns))
+
+	return nil
+}
+
+// Delete はセッションを削除する
+func (s *JSONLStore) Delete(ctx context.Context, sessionID SessionID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := s.path(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// 追記中のプロセスがいれば書き込みが終わるのを待ってから削除する
+	f, err := openLocked(path, os.O_RDWR, true)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open session file: %w", err)
+	}
+	// Windows では開いているファイルを削除できないため、ロックを解放してファイルを閉じてから削除する
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close session file: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete session file: %w", err)
+	}
+	return nil
+}
+
+// Sessions は保存されている全セッションの概要を更新日時の新しい順に返す
+func (s *JSONLStore) Sessions(ctx context.Context) ([]SessionInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session dir: %w", err)
+	}
+
+	var sessions []SessionInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, jsonlExt) {
+			continue
+		}
+
+		id := SessionID(strings.TrimSuffix(name, jsonlExt))
+		sess, err := s.read(id)
+		if err != nil {
+			return nil, err
+		}
+		// メタデータのみのセッションは会話履歴がないため一覧に含めない
+		if len(sess.turns) == 0 {
+			continue
+		}
+
+		info := SessionInfo{
+			ID:        id,
+			ParentID:  sess.parentID,
+			Title:     sess.metadata[TitleMetadataKey],
+			TurnCount: len(sess.turns),
+			CreatedAt: sess.turns[0].CreatedAt,
+			UpdatedAt: sess.turns[len(sess.turns)-1].CreatedAt,
+		}
+		for _, turn := range sess.turns {
+			if turn.Role == "user" {
+				info.Preview = turn.Content
+				break
+			}
+		}
+		sessions = append(sessions, info)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// GetMetadata はセッション単位のメタデータを取得する
+func (s *JSONLStore) GetMetadata(ctx context.Context, sessionID SessionID) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.read(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return sess.metadata, nil
+}
+
+// SetMetadata はセッション単位のメタデータを更新する
+func (s *JSONLStore) SetMetadata(ctx context.Context, sessionID SessionID, metadata map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	if err := s.append(sessionID, []jsonlRecord{{Type: "metadata", Metadata: metadata}}); err != nil {
+		return fmt.Errorf("failed to set metadata: %w", err)
+	}
+	return nil
+}
+
+// Fork はセッションの先頭から turns 件のターンとメタデータを新しいセッションにコピーする
+func (s *JSONLStore) Fork(ctx context.Context, sessionID SessionID, turns int) (SessionID, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	source, err := s.read(sessionID)
+	if err != nil {
+		return "", err
+	}
+	n, err := forkTurnCount(sessionID, len(source.turns), turns)
+	if err != nil {
+		return "", err
+	}
+
+	records := []jsonlRecord{{Type: "session", ParentID: sessionID}}
+	if len(source.metadata) > 0 {
+		records = append(records, jsonlRecord{Type: "metadata", Metadata: source.metadata})
+	}
+	for _, turn := range source.turns[:n] {
+		records = append(records, jsonlRecord{Type: "turn", Turn: turn})
+	}
+
+	forkID := NewSessionID()
+	if err := s.append(forkID, records); err != nil {
+		return "", fmt.Errorf("failed to fork session: %w", err)
+	}
+
+	return forkID, nil
+}
+
+// read はセッションファイルを読み込んで現在の状態を復元する
+// ファイルが存在しない場合は空のセッションを返す
+func (s *JSONLStore) read(sessionID SessionID) (*jsonlSession, error) {
+	sess := &jsonlSession{
+		turns:    []*ConversationTurn{},
+		metadata: make(map[string]string),
+	}
+
+	path, err := s.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := openLocked(path, os.O_RDONLY, false)
+	if errors.Is(err, os.ErrNotExist) {
+		return sess, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session file: %w", err)
+	}
+	defer f.Close()
+
+	// pending は読み込み途中のまとまりのレコード
+	var pending []jsonlRecord
+	dropPending := func(lineNo int) {
+		if len(pending) > 0 {
+			s.logger.Warn("ignoring incomplete batch in session file", "path", path, "line", lineNo, "records", len(pending), "batch_size", pending[0].BatchSize)
+			pending = nil
+		}
+	}
+
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// 改行で終わっていない行は書き込み途中で中断した追記の残りなので読み飛ばす
+			if len(bytes.TrimSpace(line)) > 0 {
+				s.logger.Warn("ignoring incomplete record in session file", "path", path, "line", lineNo)
+			}
+			dropPending(lineNo)
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session file: %w", err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var record jsonlRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("failed to decode %s:%d: %w", path, lineNo, err)
+		}
+
+		// 中断したまとまりの後には別の追記が続くため、識別子が変わった時点で読み込み途中のまとまりを捨てる
+		if len(pending) > 0 && record.Batch != pending[0].Batch {
+			dropPending(lineNo)
+		}
+		if record.Batch == "" {
+			if err := sess.apply(record); err != nil {
+				return nil, fmt.Errorf("%w at %s:%d", err, path, lineNo)
+			}
+			continue
+		}
+		pending = append(pending, record)
+		if len(pending) < record.BatchSize {
+			continue
+		}
+		for _, record := range pending {
+			if err := sess.apply(record); err != nil {
+				return nil, fmt.Errorf("%w at %s:%d", err, path, lineNo)
+			}
+		}
+		pending = nil
+	}
+
+	return sess, nil
+}
+
+// apply はレコードをセッションに適用する
+func (sess *jsonlSession) apply(record jsonlRecord) error {
+	switch record.Type {
+	case "session":
+		sess.parentID = record.ParentID
+	case "turn":
+		if record.Turn != nil {
+			sess.turns = append(sess.turns, record.Turn)
+		}
+	case "metadata":
+		for key, value := range record.Metadata {
+			if value == "" {
+				delete(sess.metadata, key)
+				continue
+			}
+			sess.metadata[key] = value
+		}
+	default:
+		return fmt.Errorf("unknown record type %q", record.Type)
+	}
+	return nil
+}
+
+// append はレコードをセッションファイルに追記する
+// レコードはまとめて1回の書き込みで追記し、ファイルがなければ作成する。
+// 複数のレコードは1つのまとまりとして識別子と数を付け、一部だけが書き込まれた場合は読み込み時に捨てる
+func (s *JSONLStore) append(sessionID SessionID, records []jsonlRecord) error {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return err
+	}
+
+	var batch string
+	if len(records) > 1 {
+		batch = uuid.NewString()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if batch != "" {
+			record.Batch, record.BatchSize = batch, len(records)
+		}
+		// 呼び出し元のマップを変更しないようコピーしてから書き込む
+		record.Metadata = maps.Clone(record.Metadata)
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+	}
+
+	f, err := openLocked(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, true)
+	if err != nil {
+		return fmt.Errorf("failed to open session file: %w", err)
+	}
+	defer f.Close()
+
+	if err := s.repairTail(f, path); err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	return nil
+}
+
+// repairTail は書き込み途中で中断した追記の残りを切り詰める
+// 残りの後ろに追記すると次のレコードまで読めなくなるため、最後の改行までに戻す
+func (s *JSONLStore) repairTail(f *os.File, path string) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat session file: %w", err)
+	}
+	size := stat.Size()
+	if size == 0 {
+		return nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return fmt.Errorf("failed to read session file: %w", err)
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return fmt.Errorf("failed to read session file: %w", err)
+	}
+	keep := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if err := f.Truncate(keep); err != nil {
+		return fmt.Errorf("failed to truncate incomplete record: %w", err)
+	}
+
+	s.logger.Warn("truncated incomplete record in session file", "path", path, "bytes", size-keep)
+	return nil
+}
+
+// openLocked はファイルを開いてロックを取得する
+// exclusive が true の場合は排他ロック、false の場合は共有ロックを取得する。
+// ロックを待つ間に他のプロセスがファイルを削除した場合は、削除後のファイルに書き込まないよう開き直す
+func openLocked(path string, flag int, exclusive bool) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, flag, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		if err := lockFile(f, exclusive); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		opened, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(opened, current) {
+			return f, nil
+		}
+		f.Close()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if flag&os.O_CREATE == 0 && errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
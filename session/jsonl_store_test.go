@@ -0,0 +1,140 @@
+package session_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/jinford/coding-agent-example/session/storetest"
+)
+
+func TestJSONLStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) session.Store {
+		return newJSONLStore(t, t.TempDir())
+	})
+}
+
+func newJSONLStore(t *testing.T, dir string) *session.JSONLStore {
+	t.Helper()
+	store, err := session.NewJSONLStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestJSONLStore_SharedDirectory(t *testing.T) {
+	// 同じディレクトリを開いた別のストア（別のプロセスに相当）から追記した内容が見えること
+	dir := t.TempDir()
+	a, b := newJSONLStore(t, dir), newJSONLStore(t, dir)
+	sessionID := session.NewSessionID()
+
+	appendTurns(t, a, sessionID, &session.ConversationTurn{Role: "user", Content: "from a"})
+	appendTurns(t, b, sessionID, &session.ConversationTurn{Role: "assistant", Content: "from b"})
+
+	turns, err := a.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 || turns[0].Content != "from a" || turns[1].Content != "from b" {
+		t.Errorf("unexpected turns: %+v", turns)
+	}
+}
+
+func TestJSONLStore_IncompleteRecord(t *testing.T) {
+	dir := t.TempDir()
+	store := newJSONLStore(t, dir)
+	sessionID := session.NewSessionID()
+	appendTurns(t, store, sessionID, &session.ConversationTurn{Role: "user", Content: "hello"})
+
+	// 書き込み途中で中断した追記を再現する
+	path := filepath.Join(dir, sessionID.String()+".jsonl")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"type":"turn","turn":{"role":"assis`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	turns, err := store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("List must ignore the incomplete record: %v", err)
+	}
+	if len(turns) != 1 {
+		t.Fatalf("expected 1 turn, got %+v", turns)
+	}
+
+	// 次の追記で中断した追記の残りが切り詰められること
+	appendTurns(t, store, sessionID, &session.ConversationTurn{Role: "assistant", Content: "hi"})
+	turns, err = store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 || turns[1].Content != "hi" {
+		t.Errorf("unexpected turns: %+v", turns)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), "\n") != 2 {
+		t.Errorf("incomplete record was not truncated:\n%s", data)
+	}
+}
+
+func TestJSONLStore_IncompleteBatch(t *testing.T) {
+	dir := t.TempDir()
+	store := newJSONLStore(t, dir)
+	sessionID := session.NewSessionID()
+	appendTurns(t, store, sessionID,
+		&session.ConversationTurn{Role: "user", Content: "hello"},
+		&session.ConversationTurn{Role: "assistant", Content: "hi"},
+	)
+
+	// まとめて追記したレコードの先頭だけが書き込まれた状態を再現する
+	path := filepath.Join(dir, sessionID.String()+".jsonl")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"type":"turn","turn":{"role":"user","content":"lost"},"batch":"interrupted","batch_size":2}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	turns, err := store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 || turns[1].Content != "hi" {
+		t.Fatalf("incomplete batch must be ignored: %+v", turns)
+	}
+
+	// 後に続く追記は読み込めること
+	appendTurns(t, store, sessionID,
+		&session.ConversationTurn{Role: "user", Content: "again"},
+		&session.ConversationTurn{Role: "assistant", Content: "ok"},
+	)
+	turns, err = store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 4 || turns[2].Content != "again" || turns[3].Content != "ok" {
+		t.Errorf("unexpected turns: %+v", turns)
+	}
+}
+
+func TestJSONLStore_InvalidSessionID(t *testing.T) {
+	store := newJSONLStore(t, t.TempDir())
+	for _, id := range []session.SessionID{"../escape", "a/b", ".."} {
+		if _, err := store.List(context.Background(), id); err == nil {
+			t.Errorf("List(%q) must fail", id)
+		}
+	}
+}
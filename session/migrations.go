@@ -0,0 +1,302 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// migration はスキーマの移行手順
+// 移行はバージョン順に1つずつトランザクション内で実行し、適用したバージョンを schema_version に記録する
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations はスキーマの移行手順の一覧（バージョン順）
+// schema_version が導入される前のデータベースは、どこまでのスキーマを持っているか分からないため、
+// バージョン3までの移行は既に適用済みでも失敗しないように書く
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create conversation_turns",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS conversation_turns (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					session_id TEXT NOT NULL,
+					role TEXT NOT NULL,
+					content TEXT NOT NULL,
+					tool_calls TEXT,
+					metadata TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+				CREATE INDEX IF NOT EXISTS idx_session_id ON conversation_turns(session_id);
+			`)
+			return err
+		},
+	},
+	{
+		version:     2,
+		description: "add usage columns to conversation_turns",
+		up: func(tx *sql.Tx) error {
+			for _, column := range usageColumns {
+				if err := addColumnIfNotExists(tx, "conversation_turns", column.name, column.definition); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     3,
+		description: "create session_metadata",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS session_metadata (
+					session_id TEXT NOT NULL,
+					key TEXT NOT NULL,
+					value TEXT NOT NULL,
+					PRIMARY KEY (session_id, key)
+				);
+			`)
+			return err
+		},
+	},
+	{
+		version:     4,
+		description: "create sessions",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				CREATE TABLE sessions (
+					id TEXT PRIMARY KEY,
+					parent_id TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+				CREATE INDEX idx_sessions_parent_id ON sessions(parent_id);
+				INSERT INTO sessions (id, created_at)
+				SELECT session_id, MIN(created_at)
+				FROM conversation_turns
+				GROUP BY session_id;
+			`)
+			return err
+		},
+	},
+	{
+		version:     5,
+		description: "move tool calls to tool_calls",
+		up: func(tx *sql.Tx) error {
+			// 既存のツール呼び出しには呼び出しIDや実行時間が記録されていないため、
+			// エラーかどうかは実行結果の形式（"Error: ..."）から判定する
+			_, err := tx.Exec(`
+				CREATE TABLE tool_calls (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					turn_id INTEGER NOT NULL REFERENCES conversation_turns(id),
+					call_id TEXT NOT NULL DEFAULT '',
+					name TEXT NOT NULL,
+					arguments TEXT NOT NULL,
+					result TEXT NOT NULL,
+					is_error INTEGER NOT NULL DEFAULT 0,
+					started_at DATETIME,
+					duration_ms INTEGER,
+					bytes INTEGER NOT NULL DEFAULT 0
+				);
+				CREATE INDEX idx_tool_calls_turn_id ON tool_calls(turn_id);
+				CREATE INDEX idx_tool_calls_name ON tool_calls(name);
+				WITH calls AS (
+					SELECT
+						t.id AS turn_id,
+						j.key AS position,
+						COALESCE(json_extract(j.value, '$.name'), '') AS name,
+						COALESCE(json_extract(j.value, '$.arguments'), '') AS arguments,
+						COALESCE(json_extract(j.value, '$.result'), '') AS result
+					FROM conversation_turns t, json_each(t.tool_calls) j
+					WHERE t.tool_calls IS NOT NULL AND t.tool_calls != ''
+				)
+				INSERT INTO tool_calls (turn_id, name, arguments, result, is_error, bytes)
+				SELECT turn_id, name, arguments, result, result LIKE 'Error: %', length(CAST(result AS BLOB))
+				FROM calls
+				ORDER BY turn_id, position;
+				ALTER TABLE conversation_turns DROP COLUMN tool_calls;
+			`)
+			return err
+		},
+	},
+	{
+		version:     6,
+		description: "create encryption",
+		up: func(tx *sql.Tx) error {
+			// 行が存在する場合はデータベースが暗号化されている
+			_, err := tx.Exec(`
+				CREATE TABLE encryption (
+					id INTEGER PRIMARY KEY CHECK (id = 1),
+					salt BLOB NOT NULL,
+					key_check TEXT NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+			`)
+			return err
+		},
+	},
+	{
+		version:     7,
+		description: "rebuild fts4 search index with CJK segmentation",
+		up: func(tx *sql.Tx) error {
+			// 日本語を区切らずに登録した FTS4 のインデックスは、initSearchIndex で作り直す
+			var ddl string
+			err := tx.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'turn_search'`).Scan(&ddl)
+			if errors.Is(err, sql.ErrNoRows) || (err == nil && !strings.Contains(strings.ToLower(ddl), "using fts4")) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`DROP TABLE turn_search`)
+			return err
+		},
+	},
+}
+
+// LatestSchemaVersion はこのビルドが対応しているスキーマのバージョン
+var LatestSchemaVersion = migrations[len(migrations)-1].version
+
+// usageColumns はトークン使用量を記録するカラムの定義
+var usageColumns = []struct {
+	name       string
+	definition string
+}{
+	{"model", "TEXT"},
+	{"input_tokens", "INTEGER"},
+	{"cached_tokens", "INTEGER"},
+	{"output_tokens", "INTEGER"},
+	{"reasoning_tokens", "INTEGER"},
+	{"cost_usd", "REAL"},
+}
+
+// migrate はデータベースのスキーマを最新のバージョンに移行する
+func migrate(db *sql.DB, logger *slog.Logger) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, LatestSchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		applied, err := applyMigration(db, m)
+		if err != nil {
+			return err
+		}
+		if applied {
+			logger.Info("session store migrated", "version", m.version, "description", m.description)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration は1つの移行をトランザクション内で実行し、適用したかを返す
+// トランザクションは書き込みのロックを取得して開始する（_txlock=immediate）ため、ロックを取得した後にバージョンを読み直し、
+// 同時に起動した別のプロセスが適用済みの場合は何もしない
+func applyMigration(db *sql.DB, m migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return false, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if current >= m.version {
+		return false, nil
+	}
+
+	if err := m.up(tx); err != nil {
+		return false, fmt.Errorf("failed to migrate to version %d (%s): %w", m.version, m.description, err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO schema_version (version, description)
+		VALUES (?, ?)
+	`, m.version, m.description); err != nil {
+		return false, fmt.Errorf("failed to record schema version %d: %w", m.version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit migration to version %d: %w", m.version, err)
+	}
+	return true, nil
+}
+
+// schemaVersion は適用済みのスキーマのバージョンを返す（未適用の場合は0）
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// SchemaVersion は適用済みのスキーマのバージョンを返す
+func (s *SQLiteStore) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// addColumnIfNotExists はカラムが存在しない場合のみ追加する
+func addColumnIfNotExists(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to get table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate table info: %w", err)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s: %w", column, err)
+	}
+
+	return nil
+}
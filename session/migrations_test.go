@@ -0,0 +1,175 @@
+package session_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+// openFixtureDB は testdata/schema のSQLから古いスキーマのデータベースを作成する
+func openFixtureDB(t *testing.T, fixture string) string {
+	t.Helper()
+
+	script, err := os.ReadFile(filepath.Join("testdata", "schema", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(string(script)); err != nil {
+		t.Fatalf("failed to load fixture %s: %v", fixture, err)
+	}
+	return path
+}
+
+func TestSQLiteStore_MigratesOlderDatabases(t *testing.T) {
+	for _, fixture := range []string{"initial.sql", "usage.sql"} {
+		t.Run(fixture, func(t *testing.T) {
+			path := openFixtureDB(t, fixture)
+
+			store, err := session.NewSQLiteStore(path)
+			if err != nil {
+				t.Fatalf("failed to open %s: %v", fixture, err)
+			}
+			defer store.Close()
+
+			version, err := store.SchemaVersion(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != session.LatestSchemaVersion {
+				t.Errorf("schema version = %d, want %d", version, session.LatestSchemaVersion)
+			}
+
+			// 既存の会話履歴が読めること
+			turns, err := store.List(context.Background(), "legacy-session")
+			if err != nil {
+				t.Fatalf("failed to list legacy turns: %v", err)
+			}
+			if len(turns) != 2 || turns[1].ToolCalls[0].Result != "package main" || turns[1].Metadata["previous_response_id"] != "resp_legacy" {
+				t.Fatalf("unexpected legacy turns: %+v", turns)
+			}
+			if turns[0].CreatedAt.IsZero() {
+				t.Error("created_at was not read")
+			}
+			if call := turns[1].ToolCalls[0]; call.Name != "read_file" || call.Arguments != `{"path":"main.go"}` || call.IsError || call.Bytes != len("package main") {
+				t.Errorf("unexpected migrated tool call: %+v", call)
+			}
+
+			// 新しいスキーマの機能が使えること
+			if err := store.Append(context.Background(), "legacy-session", &session.ConversationTurn{
+				Role:    "assistant",
+				Content: "追記",
+				Usage:   &session.Usage{Model: "gpt-4.1", InputTokens: 10, OutputTokens: 1},
+			}); err != nil {
+				t.Fatalf("failed to append to migrated database: %v", err)
+			}
+			if err := store.SetMetadata(context.Background(), "legacy-session", map[string]string{"model.temperature": "0.2"}); err != nil {
+				t.Fatalf("failed to set metadata on migrated database: %v", err)
+			}
+			usage, err := store.SessionUsage(context.Background(), "legacy-session")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if usage.InputTokens < 10 {
+				t.Errorf("unexpected usage: %+v", usage)
+			}
+		})
+	}
+}
+
+func TestSQLiteStore_MigrationIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+
+	for range 2 {
+		store, err := session.NewSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Close()
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != session.LatestSchemaVersion {
+		t.Errorf("schema_version has %d rows, want %d", count, session.LatestSchemaVersion)
+	}
+}
+
+func TestSQLiteStore_RejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+
+	store, err := session.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_version (version, description) VALUES (?, 'from the future')`, session.LatestSchemaVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if store, err := session.NewSQLiteStore(path); err == nil {
+		store.Close()
+		t.Fatal("opening a database with a newer schema must fail")
+	}
+}
+
+func TestSQLiteStore_ConcurrentMigration(t *testing.T) {
+	// 複数のプロセスが同時に古いデータベースを開いても、移行が衝突せずに1回だけ適用されること
+	path := openFixtureDB(t, "initial.sql")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store, err := session.NewSQLiteStore(path)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = store.Close()
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("store %d: %v", i, err)
+		}
+	}
+
+	store, err := session.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if version, err := store.SchemaVersion(context.Background()); err != nil || version != session.LatestSchemaVersion {
+		t.Errorf("SchemaVersion = %d, %v", version, err)
+	}
+}
@@ -0,0 +1,275 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// PinnedMetadataKey は保持ポリシーの対象外にするセッションのメタデータのキー（値は "true"）
+const PinnedMetadataKey = "pinned"
+
+// IsPinned はセッション単位のメタデータが固定されたセッションを表すかを返す
+func IsPinned(metadata map[string]string) bool {
+	return metadata[PinnedMetadataKey] == "true"
+}
+
+// minTruncateBytes は切り詰めた後の実行結果の最小バイト数
+// 省略の注記より小さくすると、切り詰めた結果が次の実行で再び切り詰められてしまう
+const minTruncateBytes = 256
+
+// RetentionPolicy はセッションの保持ポリシー
+// 期間・件数が0の条件は適用しない。固定したセッションはどの条件の対象にもならない
+type RetentionPolicy struct {
+	MaxAge        time.Duration // 最終更新からこの期間を過ぎたセッションを削除する
+	MaxSessions   int           // 新しい順にこの件数を超えたセッションを削除する
+	TruncateAfter time.Duration // この期間を過ぎたターンのツールの実行結果を切り詰める
+	TruncateBytes int           // 切り詰めた後の実行結果の最大バイト数
+}
+
+// IsZero は適用する条件が1つもないかを返す
+func (p RetentionPolicy) IsZero() bool {
+	return p.MaxAge <= 0 && p.MaxSessions <= 0 && (p.TruncateAfter <= 0 || p.TruncateBytes <= 0)
+}
+
+// PruneResult は保持ポリシーを適用した結果
+type PruneResult struct {
+	Sessions         []SessionInfo // 削除したセッション
+	TruncatedResults int           // 切り詰めたツールの実行結果の件数
+	TruncatedBytes   int64         // 切り詰めで削減したバイト数
+	ReclaimedBytes   int64         // VACUUM で縮小したデータベースのバイト数
+}
+
+// Prune は保持ポリシーに従って古いセッションを削除し、ツールの実行結果を切り詰めたあと VACUUM する
+// dryRun が true の場合はデータベースを変更せず、適用した場合の結果だけを返す
+func (s *SQLiteStore) Prune(ctx context.Context, policy RetentionPolicy, dryRun bool) (*PruneResult, error) {
+	sessions, err := s.Sessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := s.pinnedSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{}
+	now := time.Now()
+
+	// Sessions は更新日時の新しい順なので、固定していないセッションを先頭から数えて件数の上限を判定する
+	deleted := make(map[SessionID]bool)
+	kept := 0
+	for _, info := range sessions {
+		if pinned[info.ID] {
+			continue
+		}
+		expired := policy.MaxAge > 0 && info.UpdatedAt.Before(now.Add(-policy.MaxAge))
+		overflow := policy.MaxSessions > 0 && kept >= policy.MaxSessions
+		if !expired && !overflow {
+			kept++
+			continue
+		}
+		result.Sessions = append(result.Sessions, info)
+		deleted[info.ID] = true
+	}
+
+	if !dryRun {
+		for _, info := range result.Sessions {
+			// 他のプロセスが先に削除した場合は削除済みとして扱う
+			if err := s.Delete(ctx, info.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+				return nil, err
+			}
+		}
+	}
+
+	if policy.TruncateAfter > 0 && policy.TruncateBytes > 0 {
+		if err := s.truncateToolResults(ctx, policy, now, deleted, pinned, dryRun, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if !dryRun {
+		reclaimed, err := s.vacuum(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.ReclaimedBytes = reclaimed
+	}
+
+	s.logger.InfoContext(ctx, "sessions pruned",
+		"dry_run", dryRun,
+		"deleted_sessions", len(result.Sessions),
+		"truncated_results", result.TruncatedResults,
+		"truncated_bytes", result.TruncatedBytes,
+		"reclaimed_bytes", result.ReclaimedBytes,
+	)
+
+	return result, nil
+}
+
+// pinnedSessions は固定したセッションのIDを返す
+func (s *SQLiteStore) pinnedSessions(ctx context.Context) (map[SessionID]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT session_id, value
+		FROM session_metadata
+		WHERE key = ?
+	`, PinnedMetadataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pinned sessions: %w", err)
+	}
+	defer rows.Close()
+
+	pinned := make(map[SessionID]bool)
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		// 暗号化されている場合があるため、値は復号してから比較する
+		if value, err = s.open(value, metadataAAD(SessionID(id), PinnedMetadataKey)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt metadata: %w", err)
+		}
+		if IsPinned(map[string]string{PinnedMetadataKey: value}) {
+			pinned[SessionID(id)] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return pinned, nil
+}
+
+// truncatedResult は切り詰めるツールの実行結果
+type truncatedResult struct {
+	id        int64
+	turnID    int64
+	sessionID SessionID
+	result    string
+}
+
+// truncateToolResults は保持期間を過ぎたターンの大きなツールの実行結果を切り詰める
+// 全文検索インデックスも切り詰めた内容で登録し直す
+func (s *SQLiteStore) truncateToolResults(ctx context.Context, policy RetentionPolicy, now time.Time,
+	deleted, pinned map[SessionID]bool, dryRun bool, result *PruneResult) error {
+	limit := max(policy.TruncateBytes, minTruncateBytes)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.turn_id, t.session_id, c.result
+		FROM tool_calls c
+		JOIN conversation_turns t ON t.id = c.turn_id
+		WHERE t.created_at < ? AND length(CAST(c.result AS BLOB)) > ?
+		ORDER BY c.id ASC
+	`, now.Add(-policy.TruncateAfter).UTC().Format(time.DateTime), limit)
+	if err != nil {
+		return fmt.Errorf("failed to query tool results: %w", err)
+	}
+	defer rows.Close()
+
+	var targets []truncatedResult
+	for rows.Next() {
+		var target truncatedResult
+		if err := rows.Scan(&target.id, &target.turnID, &target.sessionID, &target.result); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		// 削除するセッションは切り詰めの件数に含めない（dry-run ではまだ残っている）
+		if deleted[target.sessionID] || pinned[target.sessionID] {
+			continue
+		}
+		// 暗号化されている場合は暗号文の大きさで絞り込んでいるため、復号してから判定する
+		if target.result, err = s.open(target.result, turnAAD(toolResultColumn, target.sessionID, target.turnID)); err != nil {
+			return fmt.Errorf("failed to decrypt tool result: %w", err)
+		}
+		if len(target.result) <= limit {
+			continue
+		}
+		truncated := truncateToolResult(target.result, limit)
+		result.TruncatedResults++
+		result.TruncatedBytes += int64(len(target.result) - len(truncated))
+		target.result = truncated
+		targets = append(targets, target)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	if dryRun || len(targets) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	turns := make(map[int64]bool)
+	for _, target := range targets {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE tool_calls
+			SET result = ?
+			WHERE id = ?
+		`, s.seal(target.result, turnAAD(toolResultColumn, target.sessionID, target.turnID)), target.id); err != nil {
+			return fmt.Errorf("failed to truncate tool result: %w", err)
+		}
+		turns[target.turnID] = true
+	}
+
+	if s.searchModule != "" {
+		for turnID := range turns {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM turn_search WHERE rowid = ?`, turnID); err != nil {
+				return fmt.Errorf("failed to delete search index: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, indexTurnsQuery(s.searchModule)+" WHERE id = ?", turnID); err != nil {
+				return fmt.Errorf("failed to index turn: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// truncateToolResult はツールの実行結果を limit バイト以内に切り詰め、省略したことを末尾に記す
+func truncateToolResult(result string, limit int) string {
+	note := fmt.Sprintf("\n…（保持期間を過ぎたため切り詰めました。元の大きさ: %d バイト）", len(result))
+	keep := max(limit-len(note), 0)
+	// マルチバイト文字の途中で切らない
+	for keep > 0 && !utf8.RuneStart(result[keep]) {
+		keep--
+	}
+	return result[:keep] + note
+}
+
+// vacuum はデータベースを再構築して未使用の領域を解放し、縮小したバイト数を返す
+func (s *SQLiteStore) vacuum(ctx context.Context) (int64, error) {
+	before, err := s.databaseSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return 0, fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	after, err := s.databaseSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return before - after, nil
+}
+
+// databaseSize はデータベースのバイト数を返す
+func (s *SQLiteStore) databaseSize(ctx context.Context) (int64, error) {
+	var size int64
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT page_count * page_size
+		FROM pragma_page_count(), pragma_page_size()
+	`).Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to get database size: %w", err)
+	}
+	return size, nil
+}
@@ -0,0 +1,126 @@
+package session_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+// appendExchange は指定した日時の1往復をセッションに追加する
+func appendExchange(t *testing.T, store session.Store, sessionID session.SessionID, at time.Time, calls ...session.ToolCall) {
+	t.Helper()
+	appendTurns(t, store, sessionID,
+		&session.ConversationTurn{Role: "user", Content: "question", CreatedAt: at},
+		&session.ConversationTurn{Role: "assistant", Content: "answer", ToolCalls: calls, CreatedAt: at},
+	)
+}
+
+func TestSQLiteStore_Prune(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t).(*session.SQLiteStore)
+	now := time.Now()
+
+	old, pinned := session.NewSessionID(), session.NewSessionID()
+	recent := []session.SessionID{session.NewSessionID(), session.NewSessionID(), session.NewSessionID()}
+	appendExchange(t, store, old, now.Add(-100*24*time.Hour))
+	appendExchange(t, store, pinned, now.Add(-200*24*time.Hour))
+	for i, id := range recent {
+		appendExchange(t, store, id, now.Add(-time.Duration(len(recent)-i)*time.Hour))
+	}
+	if err := store.SetMetadata(ctx, pinned, map[string]string{session.PinnedMetadataKey: "true"}); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := session.RetentionPolicy{MaxAge: 30 * 24 * time.Hour, MaxSessions: 2}
+
+	// dry-run では削除対象を返すだけで削除しないこと
+	result, err := store.Prune(ctx, policy, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prunedIDs(result); len(got) != 2 || !got[old] || !got[recent[0]] {
+		t.Fatalf("unexpected sessions to prune: %+v", result.Sessions)
+	}
+	if sessions, _ := store.Sessions(ctx); len(sessions) != 5 {
+		t.Fatalf("dry-run deleted sessions: %d left", len(sessions))
+	}
+
+	if _, err := store.Prune(ctx, policy, false); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := store.Sessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := make(map[session.SessionID]bool)
+	for _, info := range sessions {
+		remaining[info.ID] = true
+	}
+	if len(remaining) != 3 || !remaining[pinned] || !remaining[recent[1]] || !remaining[recent[2]] {
+		t.Errorf("unexpected remaining sessions: %+v", sessions)
+	}
+}
+
+func prunedIDs(result *session.PruneResult) map[session.SessionID]bool {
+	ids := make(map[session.SessionID]bool)
+	for _, info := range result.Sessions {
+		ids[info.ID] = true
+	}
+	return ids
+}
+
+func TestSQLiteStore_PruneTruncatesToolResults(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t).(*session.SQLiteStore)
+	now := time.Now()
+
+	large := "先頭の内容 " + strings.Repeat("あ", 2000) + " tailmarker"
+	old, recent := session.NewSessionID(), session.NewSessionID()
+	appendExchange(t, store, old, now.Add(-60*24*time.Hour), session.ToolCall{Name: "read_file", Result: large, Bytes: len(large)})
+	appendExchange(t, store, recent, now, session.ToolCall{Name: "read_file", Result: large, Bytes: len(large)})
+
+	policy := session.RetentionPolicy{TruncateAfter: 30 * 24 * time.Hour, TruncateBytes: 1024}
+	result, err := store.Prune(ctx, policy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TruncatedResults != 1 || result.TruncatedBytes <= 0 || len(result.Sessions) != 0 {
+		t.Fatalf("unexpected prune result: %+v", result)
+	}
+
+	turns, err := store.List(ctx, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := turns[1].ToolCalls[0]
+	if len(call.Result) > 1024 || !strings.HasPrefix(call.Result, "先頭の内容") || strings.Contains(call.Result, "tailmarker") {
+		t.Errorf("tool result was not truncated: %d bytes", len(call.Result))
+	}
+	if call.Bytes != len(large) {
+		t.Errorf("original size must be kept: %d", call.Bytes)
+	}
+	if turns, _ := store.List(ctx, recent); turns[1].ToolCalls[0].Result != large {
+		t.Error("recent tool result must not be truncated")
+	}
+
+	// 切り詰めた内容は検索インデックスにも反映されること
+	if results, err := store.Search(ctx, "tailmarker", 10); err == nil {
+		for _, r := range results {
+			if r.SessionID == old {
+				t.Errorf("truncated content is still searchable: %+v", r)
+			}
+		}
+	}
+
+	// 切り詰めた結果は再び切り詰めないこと
+	again, err := store.Prune(ctx, policy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.TruncatedResults != 0 {
+		t.Errorf("truncated results were truncated again: %+v", again)
+	}
+}
@@ -0,0 +1,471 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrSearchUnavailable はSQLiteが全文検索に対応していない場合のエラー
+var ErrSearchUnavailable = errors.New("full-text search is not available")
+
+// DefaultSearchLimit は検索結果の件数の既定値
+const DefaultSearchLimit = 20
+
+// スニペット中で検索語を囲む記号
+// 発言内容やコードに現れない制御文字を使う。表示するときは強調表示に置き換えるか StripSnippetMarkers で取り除く
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// StripSnippetMarkers はスニペットから検索語を囲む記号を取り除く
+func StripSnippetMarkers(snippet string) string {
+	return strings.NewReplacer(SnippetMatchStart, "", SnippetMatchEnd, "").Replace(snippet)
+}
+
+// SearchResult は全文検索に一致したターン
+type SearchResult struct {
+	SessionID SessionID // セッションID（そのまま再開に使える）
+	Title     string    // セッションのタイトル（未設定の場合は空）
+	Role      string    // ターンのロール
+	Snippet   string    // 一致箇所の抜粋（検索語を SnippetMatchStart と SnippetMatchEnd で囲む）
+	CreatedAt time.Time // ターンの日時
+	Score     float64   // 関連度（大きいほど関連が高い）
+}
+
+// Searcher は過去のセッションを全文検索できる Store が実装する
+type Searcher interface {
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
+
+// searchIndexes は全文検索インデックスの定義（優先順）
+// FTS5 はビルドタグ sqlite_fts5 を指定した場合のみ利用できるため、使えなければ FTS4 にフォールバックする。
+// trigram トークナイザは日本語のように空白で区切らない文章も部分一致で検索できる（3文字未満の検索語は LIKE で走査する）。
+// FTS4 の unicode61 トークナイザは空白で区切らない文章を1語として扱うため、登録する文章と検索語を segmentCJK で区切る
+var searchIndexes = []struct {
+	module string
+	ddl    string
+}{
+	{"fts5", `CREATE VIRTUAL TABLE turn_search USING fts5(content, tool_results, tokenize = 'trigram')`},
+	{"fts4", `CREATE VIRTUAL TABLE turn_search USING fts4(content, tool_results, tokenize = unicode61)`},
+}
+
+// indexTurnsQuery はターンの発言内容とツールの実行結果を検索インデックスに登録するクエリを返す
+// 検索インデックスの rowid は conversation_turns の id と一致させる
+func indexTurnsQuery(module string) string {
+	content := "content"
+	toolResults := `COALESCE((
+			SELECT group_concat(result, char(10))
+			FROM tool_calls
+			WHERE turn_id = conversation_turns.id
+		), '')`
+	if module == "fts4" {
+		content, toolResults = "segment_cjk("+content+")", "segment_cjk("+toolResults+")"
+	}
+	return `
+		INSERT INTO turn_search (rowid, content, tool_results)
+		SELECT id, ` + content + `, ` + toolResults + `
+		FROM conversation_turns
+	`
+}
+
+// cjkSeparator は segmentCJK が文字の間に挿入する区切り
+// unicode61 トークナイザが区切りとして扱い、元の文章にはまず現れないゼロ幅スペースを使う
+const cjkSeparator = "\u200b"
+
+// segmentCJK は漢字・ひらがな・カタカナ・ハングルを1文字ずつ区切る
+// 検索語も同じように区切ってフレーズとして検索することで、FTS4 でも日本語を部分一致で検索できる
+func segmentCJK(text string) string {
+	var (
+		b    strings.Builder
+		prev bool
+	)
+	for i, r := range text {
+		cjk := isCJK(r)
+		if i > 0 && (cjk || prev) {
+			b.WriteString(cjkSeparator)
+		}
+		b.WriteRune(r)
+		prev = cjk
+	}
+	return b.String()
+}
+
+// isCJK は空白で区切らずに書く文字かを返す
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー'
+}
+
+// initSearchIndex は全文検索インデックスを作成し、既存のターンを登録する
+// 全文検索が使えない環境でもセッションの保存は継続できるよう、警告を出して検索のみ無効にする
+func (s *SQLiteStore) initSearchIndex() error {
+	// 検索インデックスには平文が保存されるため、暗号化したデータベースでは作成しない
+	if s.cipher != nil {
+		return nil
+	}
+
+	var ddl string
+	err := s.db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'turn_search'`).Scan(&ddl)
+	switch {
+	case err == nil:
+		// 別のビルドで作成したインデックスはモジュールが使えない場合がある
+		if _, err := s.db.Exec(`SELECT rowid FROM turn_search LIMIT 0`); err != nil {
+			s.logger.Warn("search index is not usable; full-text search is disabled", "error", err)
+			return nil
+		}
+		s.searchModule = "fts4"
+		if strings.Contains(strings.ToLower(ddl), "using fts5") {
+			s.searchModule = "fts5"
+		}
+		s.logSearchModule()
+		return nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("failed to check search index: %w", err)
+	}
+
+	for _, index := range searchIndexes {
+		if _, err := s.db.Exec(index.ddl); err != nil {
+			s.logger.Debug("search index module is not available", "module", index.module, "error", err)
+			continue
+		}
+		if _, err := s.db.Exec(indexTurnsQuery(index.module)); err != nil {
+			return fmt.Errorf("failed to build search index: %w", err)
+		}
+		s.searchModule = index.module
+		s.logSearchModule()
+		return nil
+	}
+
+	s.logger.Warn("SQLite does not support FTS5 or FTS4; full-text search is disabled")
+	return nil
+}
+
+// logSearchModule は全文検索に使うモジュールを記録する
+func (s *SQLiteStore) logSearchModule() {
+	if s.searchModule == "fts4" {
+		s.logger.Info("full-text search engine selected", "module", s.searchModule, "hint", "build with -tags sqlite_fts5 to use FTS5")
+		return
+	}
+	s.logger.Info("full-text search engine selected", "module", s.searchModule)
+}
+
+// Search は過去のセッションの発言内容とツールの実行結果を全文検索し、関連度の高い順に返す
+// 空白で区切った検索語は全て含むターンに一致する
+func (s *SQLiteStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	if s.searchModule == "" {
+		return nil, ErrSearchUnavailable
+	}
+
+	if s.searchModule == "fts4" {
+		query = segmentCJK(query)
+	}
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("search query is empty")
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	var (
+		results []SearchResult
+		err     error
+	)
+	switch {
+	case s.searchModule == "fts5" && hasShortTerm(query):
+		// trigram トークナイザは3文字未満の検索語に一致しないため、LIKE で全件を走査する
+		results, err = s.searchLike(ctx, strings.Fields(query), limit)
+	case s.searchModule == "fts5":
+		results, err = s.searchFTS5(ctx, match, limit)
+	default:
+		results, err = s.searchFTS4(ctx, match, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		snippet := results[i].Snippet
+		if s.searchModule == "fts4" {
+			// segmentCJK で挿入した区切りを除き、1文字ずつ囲まれた一致箇所をまとめる
+			snippet = strings.ReplaceAll(snippet, cjkSeparator, "")
+			snippet = strings.ReplaceAll(snippet, SnippetMatchEnd+SnippetMatchStart, "")
+		}
+		results[i].Snippet = strings.Join(strings.Fields(snippet), " ")
+	}
+	return results, nil
+}
+
+// searchFTS5 は FTS5 で検索する
+// trigram トークナイザではトークンがほぼ1文字に相当するため、スニペットのトークン数を多めにとる
+func (s *SQLiteStore) searchFTS5(ctx context.Context, match string, limit int) ([]SearchResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.session_id, COALESCE(m.value, ''), t.role, t.created_at,
+			snippet(turn_search, -1, ?, ?, '…', 48), -bm25(turn_search)
+		FROM turn_search
+		JOIN conversation_turns t ON t.id = turn_search.rowid
+		LEFT JOIN session_metadata m ON m.session_id = t.session_id AND m.key = ?
+		WHERE turn_search MATCH ?
+		ORDER BY bm25(turn_search)
+		LIMIT ?
+	`, SnippetMatchStart, SnippetMatchEnd, TitleMetadataKey, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search turns: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var (
+			result    SearchResult
+			id        string
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&id, &result.Title, &result.Role, &createdAt, &result.Snippet, &result.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result.SessionID = SessionID(id)
+		result.CreatedAt = createdAt.Time
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// minTrigramTermRunes は trigram トークナイザで検索できる検索語の最小の文字数
+const minTrigramTermRunes = 3
+
+// hasShortTerm は trigram トークナイザで検索できない短い検索語を含むかを返す
+func hasShortTerm(query string) bool {
+	for _, term := range strings.Fields(query) {
+		if utf8.RuneCountInString(term) < minTrigramTermRunes {
+			return true
+		}
+	}
+	return false
+}
+
+// searchLike は LIKE で全てのターンを走査して検索する（FTS5 で短い検索語を含む場合に使う）
+// 関連度は計算できないため新しいターンから順に返し、スニペットは一致箇所の前後を切り出して作る
+func (s *SQLiteStore) searchLike(ctx context.Context, terms []string, limit int) ([]SearchResult, error) {
+	var (
+		where []string
+		args  = []any{TitleMetadataKey}
+	)
+	for _, term := range terms {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		where = append(where, `(turn_search.content LIKE ? ESCAPE '\' OR turn_search.tool_results LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.session_id, COALESCE(m.value, ''), t.role, t.created_at, turn_search.content, turn_search.tool_results
+		FROM turn_search
+		JOIN conversation_turns t ON t.id = turn_search.rowid
+		LEFT JOIN session_metadata m ON m.session_id = t.session_id AND m.key = ?
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY t.id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search turns: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var (
+			result      SearchResult
+			id          string
+			createdAt   sql.NullTime
+			content     string
+			toolResults string
+		)
+		if err := rows.Scan(&id, &result.Title, &result.Role, &createdAt, &content, &toolResults); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		text := content
+		if indexFold(content, terms[0]) < 0 {
+			text = toolResults
+		}
+		result.SessionID = SessionID(id)
+		result.CreatedAt = createdAt.Time
+		result.Snippet = likeSnippet(text, terms)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// likeEscaper は LIKE のパターンで特別な意味を持つ文字をエスケープする
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likeSnippetRunes は searchLike のスニペットに含める一致箇所の前後の文字数
+const likeSnippetRunes = 24
+
+// likeSnippet は最初の検索語の一致箇所の前後を切り出し、検索語を SnippetMatchStart と SnippetMatchEnd で囲む
+func likeSnippet(text string, terms []string) string {
+	start := max(indexFold(text, terms[0]), 0)
+	runes := []rune(text)
+	at := utf8.RuneCountInString(text[:start])
+	from, to := max(at-likeSnippetRunes, 0), min(at+utf8.RuneCountInString(terms[0])+likeSnippetRunes, len(runes))
+
+	snippet := string(runes[from:to])
+	for _, term := range terms {
+		var b strings.Builder
+		for {
+			i := indexFold(snippet, term)
+			if i < 0 {
+				break
+			}
+			b.WriteString(snippet[:i] + SnippetMatchStart + snippet[i:i+len(term)] + SnippetMatchEnd)
+			snippet = snippet[i+len(term):]
+		}
+		snippet = b.String() + snippet
+	}
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// indexFold は大文字と小文字を区別せずに substr の位置を返す（LIKE と同じく ASCII の文字だけを同一視する）
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if asciiEqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// asciiEqualFold は ASCII の大文字と小文字を区別せずに a と b が等しいかを返す
+func asciiEqualFold(a, b string) bool {
+	for i := range len(a) {
+		x, y := a[i], b[i]
+		if 'A' <= x && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if 'A' <= y && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// searchFTS4 は FTS4 で検索する
+// FTS4 には順位付けの関数がないため、matchinfo から BM25 を計算して並べ替える
+// 日本語は1文字が1トークンになるため、スニペットのトークン数を多めにとる
+func (s *SQLiteStore) searchFTS4(ctx context.Context, match string, limit int) ([]SearchResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.session_id, COALESCE(m.value, ''), t.role, t.created_at,
+			snippet(turn_search, ?, ?, '…', -1, 32), matchinfo(turn_search, 'pcnalx')
+		FROM turn_search
+		JOIN conversation_turns t ON t.id = turn_search.rowid
+		LEFT JOIN session_metadata m ON m.session_id = t.session_id AND m.key = ?
+		WHERE turn_search MATCH ?
+	`, SnippetMatchStart, SnippetMatchEnd, TitleMetadataKey, match)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search turns: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var (
+			result    SearchResult
+			id        string
+			createdAt sql.NullTime
+			matchInfo []byte
+		)
+		if err := rows.Scan(&id, &result.Title, &result.Role, &createdAt, &result.Snippet, &matchInfo); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result.SessionID = SessionID(id)
+		result.CreatedAt = createdAt.Time
+		result.Score = bm25(matchInfo)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// bm25 は matchinfo(..., 'pcnalx') の結果からBM25のスコアを計算する
+func bm25(matchInfo []byte) float64 {
+	const (
+		k1 = 1.2
+		b  = 0.75
+	)
+
+	info := make([]float64, len(matchInfo)/4)
+	for i := range info {
+		info[i] = float64(binary.NativeEndian.Uint32(matchInfo[i*4:]))
+	}
+	if len(info) < 3 {
+		return 0
+	}
+
+	phrases, columns, docs := int(info[0]), int(info[1]), info[2]
+	if len(info) < 3+2*columns+3*phrases*columns {
+		return 0
+	}
+	avgLength := info[3 : 3+columns]
+	length := info[3+columns : 3+2*columns]
+	hits := info[3+2*columns:]
+
+	var score float64
+	for p := range phrases {
+		for c := range columns {
+			base := 3 * (p*columns + c)
+			tf, df := hits[base], hits[base+2]
+			if tf == 0 || avgLength[c] == 0 {
+				continue
+			}
+			// 件数の少ないデータベースでも負にならないよう 1 を加えたIDFを使う
+			idf := math.Log(1 + (docs-df+0.5)/(df+0.5))
+			score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*length[c]/avgLength[c]))
+		}
+	}
+	return score
+}
+
+// ftsQuery は入力を全文検索のクエリに変換する
+// 記号がクエリ構文として解釈されないよう、空白で区切った各語をフレーズとして引用する
+func ftsQuery(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,191 @@
+package session_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+func TestSQLiteStore_Search(t *testing.T) {
+	store, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	deploy := session.NewSessionID()
+	other := session.NewSessionID()
+	appendTurns(t, store, deploy,
+		&session.ConversationTurn{Role: "user", Content: "deploy script fails with permission denied"},
+		&session.ConversationTurn{
+			Role:      "assistant",
+			Content:   "Fixed the script",
+			ToolCalls: []session.ToolCall{{Name: "read_file", Arguments: `{"path":"run.sh"}`, Result: "chmod +x run.sh && ./run.sh"}},
+		},
+	)
+	appendTurns(t, store, other,
+		&session.ConversationTurn{Role: "user", Content: "how do I deploy, deploy, deploy?"},
+		&session.ConversationTurn{Role: "assistant", Content: "Run make release"},
+	)
+	if err := store.SetMetadata(context.Background(), deploy, map[string]string{session.TitleMetadataKey: "デプロイの修正"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// ツールの実行結果も検索対象になること
+	results, err := store.Search(context.Background(), "chmod", 0)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].SessionID != deploy || results[0].Role != "assistant" || results[0].Title != "デプロイの修正" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if !strings.Contains(results[0].Snippet, session.SnippetMatchStart+"chmod"+session.SnippetMatchEnd) {
+		t.Errorf("snippet does not mark the match: %q", results[0].Snippet)
+	}
+	if plain := session.StripSnippetMarkers(results[0].Snippet); strings.ContainsAny(plain, session.SnippetMatchStart+session.SnippetMatchEnd) || !strings.Contains(plain, "chmod") {
+		t.Errorf("markers were not stripped: %q", plain)
+	}
+
+	// 検索語を多く含むターンが上位になること
+	results, err = store.Search(context.Background(), "deploy", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].SessionID != other {
+		t.Fatalf("unexpected ranking: %+v", results)
+	}
+
+	// 全ての検索語を含むターンのみ一致し、記号はクエリ構文として解釈されないこと
+	results, err = store.Search(context.Background(), `permission "denied" -x`, 0)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	// 削除したセッションは検索されないこと
+	if err := store.Delete(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	results, err = store.Search(context.Background(), "deploy", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.SessionID == other {
+			t.Errorf("deleted session was found: %+v", result)
+		}
+	}
+}
+
+func TestSQLiteStore_SearchJapanese(t *testing.T) {
+	store, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	id := session.NewSessionID()
+	appendTurns(t, store, id,
+		&session.ConversationTurn{Role: "user", Content: "データベースの接続に失敗しました。設定を見直してください"},
+		&session.ConversationTurn{Role: "assistant", Content: "接続先のホスト名を修正しました"},
+	)
+
+	// 空白で区切らない文章も部分一致で検索できること
+	results, err := store.Search(context.Background(), "接続に失敗", 0)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Role != "user" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if !strings.Contains(results[0].Snippet, session.SnippetMatchStart+"接続に失敗"+session.SnippetMatchEnd) {
+		t.Errorf("snippet does not mark the match: %q", results[0].Snippet)
+	}
+	if plain := session.StripSnippetMarkers(results[0].Snippet); !strings.Contains(plain, "データベースの接続に失敗しました。") {
+		t.Errorf("snippet does not keep the original text: %q", plain)
+	}
+}
+
+func TestSQLiteStore_SearchIndexesExistingTurns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+
+	// 検索インデックスがなかった頃のデータベースを再現する
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE conversation_turns (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id TEXT NOT NULL,
+			role TEXT NOT NULL,
+			content TEXT NOT NULL,
+			tool_calls TEXT,
+			metadata TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO conversation_turns (session_id, role, content, tool_calls)
+		VALUES ('legacy', 'assistant', 'done', '[{"name":"grep_file","arguments":"{}","result":"found legacyToken here"}]');
+	`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := session.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	results, err := store.Search(context.Background(), "legacyToken", 0)
+	if errors.Is(err, session.ErrSearchUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].SessionID != "legacy" {
+		t.Errorf("existing turns were not indexed: %+v", results)
+	}
+}
+
+func TestSQLiteStore_SearchShortTerms(t *testing.T) {
+	store, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	id := session.NewSessionID()
+	appendTurns(t, store, id,
+		&session.ConversationTurn{Role: "user", Content: "データベースの接続に失敗しました"},
+		&session.ConversationTurn{Role: "assistant", Content: "Go 100% done"},
+	)
+
+	// trigram トークナイザで一致しない3文字未満の検索語でも検索できること
+	results, err := store.Search(context.Background(), "接続", 0)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Role != "user" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if !strings.Contains(results[0].Snippet, session.SnippetMatchStart+"接続") {
+		t.Errorf("snippet does not mark the match: %q", results[0].Snippet)
+	}
+
+	results, err = store.Search(context.Background(), "go", 0)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Role != "assistant" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
@@ -1,8 +1,13 @@
 package session
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -31,9 +36,28 @@ var ErrSessionNotFound = errors.New("session not found")
 
 // ToolCall はツール呼び出し情報を表す
 type ToolCall struct {
-	Name      string `json:"name"`      // ツール名
-	Arguments string `json:"arguments"` // 引数（JSON文字列）
-	Result    string `json:"result"`    // 実行結果
+	CallID    string        `json:"call_id,omitempty"`   // APIが割り当てた呼び出しID
+	Name      string        `json:"name"`                // ツール名
+	Arguments string        `json:"arguments"`           // 引数（JSON文字列）
+	Result    string        `json:"result"`              // 実行結果（エラーの場合はエラーメッセージ）
+	IsError   bool          `json:"is_error,omitempty"`  // ツールの実行に失敗したか
+	StartedAt time.Time     `json:"started_at,omitzero"` // 実行を開始した日時
+	Duration  time.Duration `json:"duration,omitempty"`  // 実行にかかった時間
+	Bytes     int           `json:"bytes,omitempty"`     // 実行結果のバイト数
+}
+
+// ToolEventType はツールの実行イベントの種類
+type ToolEventType string
+
+const (
+	ToolStarted  ToolEventType = "started"  // ツールの実行を開始した
+	ToolFinished ToolEventType = "finished" // ツールの実行が終わった
+)
+
+// ToolEvent は応答の生成中のツールの実行状況を表す
+type ToolEvent struct {
+	Type ToolEventType
+	Call ToolCall // ToolStarted の場合は実行結果（Result, IsError, Duration, Bytes）が空
 }
 
 // ConversationTurn は会話のターン（ユーザーまたはアシスタントの発言）を表す
@@ -42,35 +66,101 @@ type ConversationTurn struct {
 	Content   string            `json:"content"`              // 発言内容
 	ToolCalls []ToolCall        `json:"tool_calls,omitempty"` // ツール呼び出し（assistantロールの場合）
 	Metadata  map[string]string `json:"metadata,omitempty"`   // ベンダー固有のメタデータ
+	Usage     *Usage            `json:"usage,omitempty"`      // トークン使用量（assistantロールの場合）
+	CreatedAt time.Time         `json:"created_at,omitzero"`  // 発言日時（ゼロ値の場合は保存時に現在日時を設定する）
+}
+
+// TitleMetadataKey はセッションのタイトルを保存するセッション単位のメタデータのキー
+const TitleMetadataKey = "title"
+
+// TruncateRunes は文字列を n 文字以内に切り詰め、切り詰めた場合は末尾に … を付ける
+// タイトルやプレビューなどを表示・保存する前に長さを揃えるのに使う
+func TruncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// SessionInfo はセッションの概要を表す
+type SessionInfo struct {
+	ID        SessionID // セッションID
+	ParentID  SessionID // 分岐元のセッションID（分岐していない場合は空）
+	Title     string    // タイトル（未設定の場合は空）
+	TurnCount int       // ターン数
+	Preview   string    // 最初のユーザー発言
+	CreatedAt time.Time // 最初のターンの日時
+	UpdatedAt time.Time // 最後のターンの日時
 }
 
 // Store はセッションデータを保存・取得するインターフェース
 type Store interface {
 	// List はセッションIDから会話履歴を取得する
-	List(sessionID SessionID) ([]*ConversationTurn, error)
+	List(ctx context.Context, sessionID SessionID) ([]*ConversationTurn, error)
 
 	// Append は会話履歴に新しいターンを追加する
-	Append(sessionID SessionID, turn *ConversationTurn) error
+	// 複数のターンを指定した場合は全て追加するか、エラーの場合は1つも追加しない
+	Append(ctx context.Context, sessionID SessionID, turns ...*ConversationTurn) error
 
 	// Delete はセッションを削除する
-	Delete(sessionID SessionID) error
+	// セッションが存在しない場合は ErrSessionNotFound を返す
+	Delete(ctx context.Context, sessionID SessionID) error
+
+	// Sessions は保存されている全セッションの概要を更新日時の新しい順に返す
+	Sessions(ctx context.Context) ([]SessionInfo, error)
+
+	// GetMetadata はセッション単位のメタデータを取得する
+	GetMetadata(ctx context.Context, sessionID SessionID) (map[string]string, error)
+
+	// SetMetadata はセッション単位のメタデータを更新する
+	// 指定したキーのみを上書きし、値が空文字列のキーは削除する
+	SetMetadata(ctx context.Context, sessionID SessionID, metadata map[string]string) error
+
+	// Fork はセッションの先頭から turns 件のターンとメタデータを新しいセッションにコピーし、
+	// 分岐元を記録する。turns が0以下の場合は全てのターンをコピーする
+	Fork(ctx context.Context, sessionID SessionID, turns int) (SessionID, error)
+}
+
+// forkTurnCount はコピーするターン数を検証して返す
+func forkTurnCount(sessionID SessionID, total, turns int) (int, error) {
+	if total == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if turns <= 0 {
+		return total, nil
+	}
+	if turns > total {
+		return 0, fmt.Errorf("cannot fork at turn %d: session %s has only %d turns", turns, sessionID, total)
+	}
+	return turns, nil
 }
 
 // InMemoryStore はメモリ内にセッションを保存する実装
 type InMemoryStore struct {
-	mu   sync.RWMutex
-	data map[SessionID][]*ConversationTurn
+	mu       sync.RWMutex
+	data     map[SessionID][]*ConversationTurn
+	metadata map[SessionID]map[string]string
+	times    map[SessionID][2]time.Time // 作成日時と更新日時
+	parents  map[SessionID]SessionID    // 分岐元のセッションID
 }
 
 // NewInMemoryStore は新しいInMemoryStoreを作成する
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
-		data: make(map[SessionID][]*ConversationTurn),
+		data:     make(map[SessionID][]*ConversationTurn),
+		metadata: make(map[SessionID]map[string]string),
+		times:    make(map[SessionID][2]time.Time),
+		parents:  make(map[SessionID]SessionID),
 	}
 }
 
 // List はセッションIDから会話履歴を取得する
-func (s *InMemoryStore) List(sessionID SessionID) ([]*ConversationTurn, error) {
+func (s *InMemoryStore) List(ctx context.Context, sessionID SessionID) ([]*ConversationTurn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -88,19 +178,158 @@ func (s *InMemoryStore) List(sessionID SessionID) ([]*ConversationTurn, error) {
 }
 
 // Append は会話履歴に新しいターンを追加する
-func (s *InMemoryStore) Append(sessionID SessionID, turn *ConversationTurn) error {
+func (s *InMemoryStore) Append(ctx context.Context, sessionID SessionID, turns ...*ConversationTurn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.data[sessionID] = append(s.data[sessionID], turn)
+	for _, turn := range turns {
+		// 発言日時を設定したコピーを保存する（呼び出し元のデータを変更しない）
+		stored := *turn
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = time.Now()
+		}
+		s.data[sessionID] = append(s.data[sessionID], &stored)
+
+		times, ok := s.times[sessionID]
+		if !ok {
+			times[0] = stored.CreatedAt
+		}
+		times[1] = stored.CreatedAt
+		s.times[sessionID] = times
+	}
+
 	return nil
 }
 
 // Delete はセッションを削除する
-func (s *InMemoryStore) Delete(sessionID SessionID) error {
+func (s *InMemoryStore) Delete(ctx context.Context, sessionID SessionID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	_, hasTurns := s.data[sessionID]
+	_, hasMetadata := s.metadata[sessionID]
+	if !hasTurns && !hasMetadata {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
 	delete(s.data, sessionID)
+	delete(s.metadata, sessionID)
+	delete(s.times, sessionID)
+	delete(s.parents, sessionID)
+	return nil
+}
+
+// Sessions は保存されている全セッションの概要を更新日時の新しい順に返す
+func (s *InMemoryStore) Sessions(ctx context.Context) ([]SessionInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]SessionInfo, 0, len(s.data))
+	for id, turns := range s.data {
+		info := SessionInfo{
+			ID:        id,
+			ParentID:  s.parents[id],
+			Title:     s.metadata[id][TitleMetadataKey],
+			TurnCount: len(turns),
+			CreatedAt: s.times[id][0],
+			UpdatedAt: s.times[id][1],
+		}
+		for _, turn := range turns {
+			if turn.Role == "user" {
+				info.Preview = turn.Content
+				break
+			}
+		}
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UpdatedAt.After(result[j].UpdatedAt)
+	})
+
+	return result, nil
+}
+
+// GetMetadata はセッション単位のメタデータを取得する
+func (s *InMemoryStore) GetMetadata(ctx context.Context, sessionID SessionID) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// コピーを返す（元のデータを保護）
+	result := make(map[string]string, len(s.metadata[sessionID]))
+	maps.Copy(result, s.metadata[sessionID])
+
+	return result, nil
+}
+
+// SetMetadata はセッション単位のメタデータを更新する
+func (s *InMemoryStore) SetMetadata(ctx context.Context, sessionID SessionID, metadata map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.metadata[sessionID]
+	if current == nil {
+		current = make(map[string]string, len(metadata))
+		s.metadata[sessionID] = current
+	}
+
+	for key, value := range metadata {
+		if value == "" {
+			delete(current, key)
+			continue
+		}
+		current[key] = value
+	}
+
 	return nil
 }
+
+// Fork はセッションの先頭から turns 件のターンとメタデータを新しいセッションにコピーする
+func (s *InMemoryStore) Fork(ctx context.Context, sessionID SessionID, turns int) (SessionID, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source := s.data[sessionID]
+	n, err := forkTurnCount(sessionID, len(source), turns)
+	if err != nil {
+		return "", err
+	}
+
+	forkID := NewSessionID()
+	s.data[forkID] = append([]*ConversationTurn(nil), source[:n]...)
+	// メタデータのないセッションでも後から SetMetadata できるよう、空のマップを用意する
+	s.metadata[forkID] = maps.Clone(s.metadata[sessionID])
+	if s.metadata[forkID] == nil {
+		s.metadata[forkID] = make(map[string]string)
+	}
+	s.parents[forkID] = sessionID
+
+	now := time.Now()
+	s.times[forkID] = [2]time.Time{now, now}
+
+	return forkID, nil
+}
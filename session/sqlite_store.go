@@ -1,44 +1,102 @@
 package session
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// sqliteDriverName は全文検索用の関数を登録したSQLiteのドライバの名前
+const sqliteDriverName = "sqlite3_session"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("segment_cjk", segmentCJK, true)
+		},
+	})
+}
+
 // SQLiteStore はSQLiteを使用してセッションを保存する実装
 type SQLiteStore struct {
-	db *sql.DB
+	db           *sql.DB
+	logger       *slog.Logger
+	searchModule string       // 全文検索インデックスのモジュール（"fts5" または "fts4"。使えない場合は空）
+	keySource    KeySource    // 暗号化の鍵の取得元（暗号化しない場合は nil）
+	cipher       *fieldCipher // 暗号化が有効な場合のみ設定する
+}
+
+// SQLiteOption は SQLiteStore のオプション
+type SQLiteOption func(*SQLiteStore)
+
+// WithLogger はログの出力先を指定する
+func WithLogger(logger *slog.Logger) SQLiteOption {
+	return func(s *SQLiteStore) {
+		s.logger = logger
+	}
+}
+
+// WithEncryption は発言内容・ツール呼び出し・メタデータを指定した鍵で暗号化して保存する
+func WithEncryption(source KeySource) SQLiteOption {
+	return func(s *SQLiteStore) {
+		s.keySource = source
+	}
+}
+
+// sqliteDSN はデータベースのパスにトランザクションを BEGIN IMMEDIATE で開始する指定を加える
+func sqliteDSN(dbPath string) string {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return dbPath + sep + "_txlock=immediate"
 }
 
 // NewSQLiteStore は新しいSQLiteStoreを作成する
-func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+func NewSQLiteStore(dbPath string, opts ...SQLiteOption) (*SQLiteStore, error) {
+	s := &SQLiteStore{logger: slog.Default()}
+	for _, f := range opts {
+		f(s)
+	}
+
+	// 書き込むトランザクションは開始時にロックを取得する（複数のプロセスが同時に移行・書き込みしても、
+	// 読み込んだ後の書き込みで SQLITE_BUSY にならず、ロックが解放されるのを待つ）
+	db, err := sql.Open(sqliteDriverName, sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// テーブルを作成
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS conversation_turns (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			session_id TEXT NOT NULL,
-			role TEXT NOT NULL,
-			content TEXT NOT NULL,
-			tool_calls TEXT,
-			metadata TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE INDEX IF NOT EXISTS idx_session_id ON conversation_turns(session_id);
-	`)
-	if err != nil {
+	// スキーマを最新のバージョンに移行
+	if err := migrate(db, s.logger); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.db = db
+
+	if err := s.initEncryption(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// 全文検索インデックスは利用できるモジュールがビルドによって異なり、会話履歴から再構築できるため、
+	// スキーマの移行とは別に作成する
+	if err := s.initSearchIndex(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create table: %w", err)
+		return nil, err
 	}
 
-	return &SQLiteStore{db: db}, nil
+	s.logger.Debug("session store opened", "path", dbPath, "search", s.searchModule, "encrypted", s.Encrypted())
+
+	return s, nil
 }
 
 // Close はデータベース接続を閉じる
@@ -47,9 +105,10 @@ func (s *SQLiteStore) Close() error {
 }
 
 // List はセッションIDから会話履歴を取得する
-func (s *SQLiteStore) List(sessionID SessionID) ([]*ConversationTurn, error) {
-	rows, err := s.db.Query(`
-		SELECT role, content, tool_calls, metadata
+func (s *SQLiteStore) List(ctx context.Context, sessionID SessionID) ([]*ConversationTurn, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, role, content, metadata, created_at,
+			model, input_tokens, cached_tokens, output_tokens, reasoning_tokens, cost_usd
 		FROM conversation_turns
 		WHERE session_id = ?
 		ORDER BY id ASC
@@ -60,28 +119,34 @@ func (s *SQLiteStore) List(sessionID SessionID) ([]*ConversationTurn, error) {
 	defer rows.Close()
 
 	var turns []*ConversationTurn
+	turnsByID := make(map[int64]*ConversationTurn)
 	for rows.Next() {
 		var (
-			role         string
-			content      string
-			toolCallsStr sql.NullString
-			metadataStr  sql.NullString
+			id          int64
+			role        string
+			content     string
+			metadataStr sql.NullString
+			createdAt   sql.NullTime
+			usage       nullUsage
 		)
 
-		if err := rows.Scan(&role, &content, &toolCallsStr, &metadataStr); err != nil {
+		if err := rows.Scan(&id, &role, &content, &metadataStr, &createdAt,
+			&usage.model, &usage.inputTokens, &usage.cachedTokens, &usage.outputTokens, &usage.reasoningTokens, &usage.costUSD); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		turn := &ConversationTurn{
-			Role:    role,
-			Content: content,
+		if content, err = s.open(content, turnAAD(turnContentColumn, sessionID, id)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt content: %w", err)
+		}
+		if metadataStr.String, err = s.open(metadataStr.String, turnAAD(turnMetadataColumn, sessionID, id)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt metadata: %w", err)
 		}
 
-		// ToolCallsをデシリアライズ
-		if toolCallsStr.Valid && toolCallsStr.String != "" {
-			if err := json.Unmarshal([]byte(toolCallsStr.String), &turn.ToolCalls); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal tool_calls: %w", err)
-			}
+		turn := &ConversationTurn{
+			Role:      role,
+			Content:   content,
+			Usage:     usage.toUsage(),
+			CreatedAt: createdAt.Time,
 		}
 
 		// Metadataをデシリアライズ
@@ -92,27 +157,56 @@ func (s *SQLiteStore) List(sessionID SessionID) ([]*ConversationTurn, error) {
 		}
 
 		turns = append(turns, turn)
+		turnsByID[id] = turn
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("failed to iterate rows: %w", err)
 	}
+	rows.Close()
+
+	if err := s.loadToolCalls(ctx, sessionID, turnsByID); err != nil {
+		return nil, err
+	}
 
 	return turns, nil
 }
 
 // Append は会話履歴に新しいターンを追加する
-func (s *SQLiteStore) Append(sessionID SessionID, turn *ConversationTurn) error {
-	// ToolCallsをシリアライズ
-	var toolCallsStr sql.NullString
-	if len(turn.ToolCalls) > 0 {
-		toolCallsJSON, err := json.Marshal(turn.ToolCalls)
-		if err != nil {
-			return fmt.Errorf("failed to marshal tool_calls: %w", err)
+// 複数のターンは1つのトランザクションで追加する
+func (s *SQLiteStore) Append(ctx context.Context, sessionID SessionID, turns ...*ConversationTurn) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO sessions (id)
+		VALUES (?)
+	`, sessionID.String()); err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+
+	for _, turn := range turns {
+		if err := s.insertTurn(ctx, tx, sessionID, turn); err != nil {
+			return err
 		}
-		toolCallsStr = sql.NullString{String: string(toolCallsJSON), Valid: true}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, turn := range turns {
+		s.logger.DebugContext(ctx, "turn appended", "session_id", sessionID, "role", turn.Role, "tool_calls", len(turn.ToolCalls))
+	}
+
+	return nil
+}
+
+// insertTurn はトランザクション内でターンを1件追加し、全文検索インデックスに登録する
+func (s *SQLiteStore) insertTurn(ctx context.Context, tx *sql.Tx, sessionID SessionID, turn *ConversationTurn) error {
 	// Metadataをシリアライズ
 	var metadataStr sql.NullString
 	if len(turn.Metadata) > 0 {
@@ -123,26 +217,516 @@ func (s *SQLiteStore) Append(sessionID SessionID, turn *ConversationTurn) error
 		metadataStr = sql.NullString{String: string(metadataJSON), Valid: true}
 	}
 
-	_, err := s.db.Exec(`
-		INSERT INTO conversation_turns (session_id, role, content, tool_calls, metadata)
-		VALUES (?, ?, ?, ?, ?)
-	`, sessionID.String(), turn.Role, turn.Content, toolCallsStr, metadataStr)
+	usage := newNullUsage(turn.Usage)
+
+	// 発言日時の指定がない場合はデータベースの現在日時を使う
+	// 指定がある場合も CURRENT_TIMESTAMP と同じ形式で保存し、日時の比較や集計に影響しないようにする
+	var createdAt sql.NullString
+	if !turn.CreatedAt.IsZero() {
+		createdAt = sql.NullString{String: turn.CreatedAt.UTC().Format(time.DateTime), Valid: true}
+	}
+
+	// 暗号化する場合は関連データにターンのIDを含めるため、追加してIDが決まってから内容を保存する
+	content, metadata := turn.Content, metadataStr
+	if s.cipher != nil {
+		content, metadata = "", sql.NullString{}
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO conversation_turns (
+			session_id, role, content, metadata, created_at,
+			model, input_tokens, cached_tokens, output_tokens, reasoning_tokens, cost_usd
+		)
+		VALUES (?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?, ?, ?, ?, ?, ?)
+	`, sessionID.String(), turn.Role, content, metadata, createdAt,
+		usage.model, usage.inputTokens, usage.cachedTokens, usage.outputTokens, usage.reasoningTokens, usage.costUSD)
 	if err != nil {
 		return fmt.Errorf("failed to insert turn: %w", err)
 	}
 
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get turn id: %w", err)
+	}
+	if s.cipher != nil {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE conversation_turns SET content = ?, metadata = ?
+			WHERE id = ?
+		`, s.seal(turn.Content, turnAAD(turnContentColumn, sessionID, id)),
+			s.sealNull(metadataStr, turnAAD(turnMetadataColumn, sessionID, id)), id); err != nil {
+			return fmt.Errorf("failed to insert turn: %w", err)
+		}
+	}
+	if err := s.insertToolCalls(ctx, tx, sessionID, id, turn.ToolCalls); err != nil {
+		return err
+	}
+
+	// 全文検索インデックスに登録（ツールの実行結果も含めるため、ツール呼び出しの追加後に行う）
+	if s.searchModule != "" {
+		if _, err := tx.ExecContext(ctx, indexTurnsQuery(s.searchModule)+" WHERE id = ?", id); err != nil {
+			return fmt.Errorf("failed to index turn: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // Delete はセッションを削除する
-func (s *SQLiteStore) Delete(sessionID SessionID) error {
-	_, err := s.db.Exec(`
-		DELETE FROM conversation_turns
+func (s *SQLiteStore) Delete(ctx context.Context, sessionID SessionID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if s.searchModule != "" {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM turn_search
+			WHERE rowid IN (SELECT id FROM conversation_turns WHERE session_id = ?)
+		`, sessionID.String()); err != nil {
+			return fmt.Errorf("failed to delete search index: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM tool_calls
+		WHERE turn_id IN (SELECT id FROM conversation_turns WHERE session_id = ?)
+	`, sessionID.String()); err != nil {
+		return fmt.Errorf("failed to delete tool calls: %w", err)
+	}
+
+	// ターン、メタデータ、分岐元のいずれも削除しなかった場合はセッションが存在しない
+	var deleted int64
+	for _, stmt := range []struct{ query, name string }{
+		{`DELETE FROM conversation_turns WHERE session_id = ?`, "session"},
+		{`DELETE FROM session_metadata WHERE session_id = ?`, "session metadata"},
+		{`DELETE FROM sessions WHERE id = ?`, "session"},
+	} {
+		result, err := tx.ExecContext(ctx, stmt.query, sessionID.String())
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", stmt.name, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		deleted += n
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Sessions は保存されている全セッションの概要を更新日時の新しい順に返す
+func (s *SQLiteStore) Sessions(ctx context.Context) ([]SessionInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			t.session_id,
+			COALESCE(s.parent_id, ''),
+			COALESCE((
+				SELECT value FROM session_metadata
+				WHERE session_id = t.session_id AND key = ?
+			), ''),
+			COUNT(*),
+			COALESCE((
+				SELECT content FROM conversation_turns
+				WHERE session_id = t.session_id AND role = 'user'
+				ORDER BY id ASC LIMIT 1
+			), ''),
+			COALESCE((
+				SELECT id FROM conversation_turns
+				WHERE session_id = t.session_id AND role = 'user'
+				ORDER BY id ASC LIMIT 1
+			), 0),
+			MIN(t.created_at),
+			MAX(t.created_at)
+		FROM conversation_turns t
+		LEFT JOIN sessions s ON s.id = t.session_id
+		GROUP BY t.session_id
+		ORDER BY MAX(t.id) DESC
+	`, TitleMetadataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []SessionInfo
+	for rows.Next() {
+		var (
+			info          SessionInfo
+			id            string
+			parentID      string
+			previewTurnID int64
+			createdAt     string
+			updatedAt     string
+		)
+		if err := rows.Scan(&id, &parentID, &info.Title, &info.TurnCount, &info.Preview, &previewTurnID, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if info.Title, err = s.open(info.Title, metadataAAD(SessionID(id), TitleMetadataKey)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt title: %w", err)
+		}
+		if info.Preview, err = s.open(info.Preview, turnAAD(turnContentColumn, SessionID(id), previewTurnID)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt preview: %w", err)
+		}
+		info.ID = SessionID(id)
+		info.ParentID = SessionID(parentID)
+		if info.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, err
+		}
+		if info.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Fork はセッションの先頭から turns 件のターンとメタデータを新しいセッションにコピーする
+// 発言日時やトークン使用量もそのままコピーする
+func (s *SQLiteStore) Fork(ctx context.Context, sessionID SessionID, turns int) (SessionID, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var total int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM conversation_turns
+		WHERE session_id = ?
+	`, sessionID.String()).Scan(&total); err != nil {
+		return "", fmt.Errorf("failed to count turns: %w", err)
+	}
+	n, err := forkTurnCount(sessionID, total, turns)
+	if err != nil {
+		return "", err
+	}
+
+	forkID := NewSessionID()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO sessions (id, parent_id)
+		VALUES (?, ?)
+	`, forkID.String(), sessionID.String()); err != nil {
+		return "", fmt.Errorf("failed to insert session: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO conversation_turns (
+			session_id, role, content, metadata, created_at,
+			model, input_tokens, cached_tokens, output_tokens, reasoning_tokens, cost_usd
+		)
+		SELECT ?, role, content, metadata, created_at,
+			model, input_tokens, cached_tokens, output_tokens, reasoning_tokens, cost_usd
+		FROM conversation_turns
+		WHERE session_id = ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, forkID.String(), sessionID.String(), n); err != nil {
+		return "", fmt.Errorf("failed to copy turns: %w", err)
+	}
+
+	// コピー元とコピー先のターンを順番で対応付けて、ツール呼び出しをコピーする
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO tool_calls (
+			turn_id, call_id, name, arguments, result, is_error, started_at, duration_ms, bytes
+		)
+		SELECT dst.id, c.call_id, c.name, c.arguments, c.result, c.is_error, c.started_at, c.duration_ms, c.bytes
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n
+			FROM conversation_turns
+			WHERE session_id = ?
+		) src
+		JOIN (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n
+			FROM conversation_turns
+			WHERE session_id = ?
+		) dst ON dst.n = src.n
+		JOIN tool_calls c ON c.turn_id = src.id
+		ORDER BY c.id ASC
+	`, sessionID.String(), forkID.String()); err != nil {
+		return "", fmt.Errorf("failed to copy tool calls: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO session_metadata (session_id, key, value)
+		SELECT ?, key, value
+		FROM session_metadata
+		WHERE session_id = ?
+	`, forkID.String(), sessionID.String()); err != nil {
+		return "", fmt.Errorf("failed to copy session metadata: %w", err)
+	}
+
+	// 暗号文はコピー元のセッションとターンに結び付いているため、コピー先に合わせて暗号化し直す
+	if s.cipher != nil {
+		if err := s.resealFork(ctx, tx, sessionID, forkID); err != nil {
+			return "", err
+		}
+	}
+
+	if s.searchModule != "" {
+		if _, err := tx.ExecContext(ctx, indexTurnsQuery(s.searchModule)+" WHERE session_id = ?", forkID.String()); err != nil {
+			return "", fmt.Errorf("failed to index turns: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.logger.DebugContext(ctx, "session forked", "session_id", sessionID, "fork_id", forkID, "turns", n)
+
+	return forkID, nil
+}
+
+// parseTimestamp はSQLiteのCURRENT_TIMESTAMP形式（UTC）の日時を解析する
+func parseTimestamp(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(time.DateTime, s, time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse timestamp %q: %w", s, err)
+	}
+	return t, nil
+}
+
+// GetMetadata はセッション単位のメタデータを取得する
+func (s *SQLiteStore) GetMetadata(ctx context.Context, sessionID SessionID) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT key, value
+		FROM session_metadata
 		WHERE session_id = ?
 	`, sessionID.String())
 	if err != nil {
-		return fmt.Errorf("failed to delete session: %w", err)
+		return nil, fmt.Errorf("failed to query session metadata: %w", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if value, err = s.open(value, metadataAAD(sessionID, key)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt metadata: %w", err)
+		}
+		metadata[key] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// SetMetadata はセッション単位のメタデータを更新する
+func (s *SQLiteStore) SetMetadata(ctx context.Context, sessionID SessionID, metadata map[string]string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range metadata {
+		if value == "" {
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM session_metadata
+				WHERE session_id = ? AND key = ?
+			`, sessionID.String(), key); err != nil {
+				return fmt.Errorf("failed to delete session metadata: %w", err)
+			}
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO session_metadata (session_id, key, value)
+			VALUES (?, ?, ?)
+			ON CONFLICT (session_id, key) DO UPDATE SET value = excluded.value
+		`, sessionID.String(), key, s.seal(value, metadataAAD(sessionID, key))); err != nil {
+			return fmt.Errorf("failed to upsert session metadata: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return nil
 }
+
+// SessionUsage はセッション全体のトークン使用量を集計する
+// タイトルの生成に使ったトークン（TitleUsageMetadataKey）も含め、複数のモデルを使った場合はモデルごとの内訳を返す
+func (s *SQLiteStore) SessionUsage(ctx context.Context, sessionID SessionID) (*Usage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT model, SUM(input_tokens), SUM(cached_tokens), SUM(output_tokens), SUM(reasoning_tokens), SUM(cost_usd)
+		FROM conversation_turns
+		WHERE session_id = ?
+		GROUP BY model
+		ORDER BY MIN(id) ASC
+	`, sessionID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session usage: %w", err)
+	}
+	defer rows.Close()
+
+	var total Usage
+	for rows.Next() {
+		var usage nullUsage
+		if err := rows.Scan(
+			&usage.model, &usage.inputTokens, &usage.cachedTokens, &usage.outputTokens, &usage.reasoningTokens, &usage.costUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if u := usage.toUsage(); u != nil {
+			total.Add(*u)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	titles, err := s.titleUsages(ctx, `session_id = ?`, sessionID.String())
+	if err != nil {
+		return nil, err
+	}
+	for _, title := range titles {
+		total.Add(title)
+	}
+	return &total, nil
+}
+
+// UsageByModel は指定時刻以降の全セッションのトークン使用量をモデルごとに集計する
+// タイトルの生成に使ったトークンは、セッションの最初のターンが期間に含まれる場合に含める。
+// sinceがゼロ値の場合は全期間を対象とする
+func (s *SQLiteStore) UsageByModel(ctx context.Context, since time.Time) ([]Usage, error) {
+	sinceValue := since.UTC().Format(time.DateTime)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT model, SUM(input_tokens), SUM(cached_tokens), SUM(output_tokens), SUM(reasoning_tokens), SUM(cost_usd)
+		FROM conversation_turns
+		WHERE model IS NOT NULL AND created_at >= ?
+		GROUP BY model
+	`, sinceValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage by model: %w", err)
+	}
+	defer rows.Close()
+
+	var result []Usage
+	for rows.Next() {
+		var usage nullUsage
+		if err := rows.Scan(
+			&usage.model, &usage.inputTokens, &usage.cachedTokens, &usage.outputTokens, &usage.reasoningTokens, &usage.costUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if u := usage.toUsage(); u != nil {
+			result = append(result, *u)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	rows.Close()
+
+	titles, err := s.titleUsages(ctx, `
+		(SELECT MIN(created_at) FROM conversation_turns WHERE session_id = session_metadata.session_id) >= ?
+	`, sinceValue)
+	if err != nil {
+		return nil, err
+	}
+	for _, title := range titles {
+		if title.Model == "" {
+			continue
+		}
+		i := slices.IndexFunc(result, func(u Usage) bool { return u.Model == title.Model })
+		if i < 0 {
+			result = append(result, title)
+			continue
+		}
+		result[i].addTokens(title)
+	}
+
+	slices.SortStableFunc(result, func(a, b Usage) int { return cmp.Compare(b.CostUSD, a.CostUSD) })
+	return result, nil
+}
+
+// titleUsages は条件に一致するセッションのタイトルの生成に使ったトークン使用量を返す
+// メタデータの値は暗号化されている場合があるため、SQL では集計せずに復号してから読み込む
+func (s *SQLiteStore) titleUsages(ctx context.Context, where string, args ...any) ([]Usage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT session_id, value
+		FROM session_metadata
+		WHERE key = ? AND `+where+`
+		ORDER BY rowid ASC
+	`, append([]any{TitleUsageMetadataKey}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query title usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usages []Usage
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if value, err = s.open(value, metadataAAD(SessionID(id), TitleUsageMetadataKey)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt metadata: %w", err)
+		}
+		if usage := TitleUsage(map[string]string{TitleUsageMetadataKey: value}); usage != nil {
+			usages = append(usages, *usage)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+	return usages, nil
+}
+
+// nullUsage はNULLを許容するトークン使用量のカラム値
+type nullUsage struct {
+	model           sql.NullString
+	inputTokens     sql.NullInt64
+	cachedTokens    sql.NullInt64
+	outputTokens    sql.NullInt64
+	reasoningTokens sql.NullInt64
+	costUSD         sql.NullFloat64
+}
+
+func newNullUsage(u *Usage) nullUsage {
+	if u == nil {
+		return nullUsage{}
+	}
+	return nullUsage{
+		model:           sql.NullString{String: u.Model, Valid: u.Model != ""},
+		inputTokens:     sql.NullInt64{Int64: u.InputTokens, Valid: true},
+		cachedTokens:    sql.NullInt64{Int64: u.CachedTokens, Valid: true},
+		outputTokens:    sql.NullInt64{Int64: u.OutputTokens, Valid: true},
+		reasoningTokens: sql.NullInt64{Int64: u.ReasoningTokens, Valid: true},
+		costUSD:         sql.NullFloat64{Float64: u.CostUSD, Valid: true},
+	}
+}
+
+// toUsage はカラム値をUsageに変換する（使用量が記録されていない場合はnil）
+func (n nullUsage) toUsage() *Usage {
+	if !n.inputTokens.Valid && !n.outputTokens.Valid {
+		return nil
+	}
+	return &Usage{
+		Model:           n.model.String,
+		InputTokens:     n.inputTokens.Int64,
+		CachedTokens:    n.cachedTokens.Int64,
+		OutputTokens:    n.outputTokens.Int64,
+		ReasoningTokens: n.reasoningTokens.Int64,
+		CostUSD:         n.costUSD.Float64,
+	}
+}
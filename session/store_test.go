@@ -0,0 +1,111 @@
+package session_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/jinford/coding-agent-example/session/storetest"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) session.Store {
+		return session.NewInMemoryStore()
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, newSQLiteStore)
+}
+
+func newSQLiteStore(t *testing.T) session.Store {
+	store, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func appendTurns(t *testing.T, store session.Store, sessionID session.SessionID, turns ...*session.ConversationTurn) {
+	t.Helper()
+	if err := store.Append(context.Background(), sessionID, turns...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteStore_AppendIsAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := session.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// 2件目のターンの追加を失敗させる
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`
+		CREATE TRIGGER fail_insert BEFORE INSERT ON conversation_turns
+		WHEN NEW.content = 'boom'
+		BEGIN
+			SELECT RAISE(ABORT, 'boom');
+		END
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	sessionID := session.NewSessionID()
+	err = store.Append(context.Background(), sessionID,
+		&session.ConversationTurn{Role: "user", Content: "hello"},
+		&session.ConversationTurn{Role: "assistant", Content: "boom"},
+	)
+	if err == nil {
+		t.Fatal("Append must fail")
+	}
+
+	turns, err := store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 0 {
+		t.Errorf("partial append was committed: %+v", turns)
+	}
+}
+
+func TestSQLiteStore_ToolStats(t *testing.T) {
+	store := newSQLiteStore(t).(*session.SQLiteStore)
+	appendTurns(t, store, session.NewSessionID(), &session.ConversationTurn{
+		Role:    "assistant",
+		Content: "done",
+		ToolCalls: []session.ToolCall{
+			{Name: "read_file", Result: "ok", Duration: 10 * time.Millisecond, Bytes: 2},
+			{Name: "read_file", Result: "ok", Duration: 30 * time.Millisecond, Bytes: 2},
+			{Name: "grep_file", Result: "Error: x", IsError: true, Duration: 5 * time.Millisecond, Bytes: 8},
+		},
+	})
+
+	stats, err := store.ToolStats(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 tools, got %+v", stats)
+	}
+
+	// 失敗した回数の多い順に並ぶこと
+	if stats[0].Name != "grep_file" || stats[0].Errors != 1 || stats[0].ErrorRate() != 1 {
+		t.Errorf("unexpected grep_file stat: %+v", stats[0])
+	}
+	read := stats[1]
+	if read.Name != "read_file" || read.Calls != 2 || read.Errors != 0 ||
+		read.AvgDuration != 20*time.Millisecond || read.MaxDuration != 30*time.Millisecond || read.TotalBytes != 4 {
+		t.Errorf("unexpected read_file stat: %+v", read)
+	}
+}
@@ -0,0 +1,504 @@
+// Package storetest は session.Store の実装が満たすべき振る舞いを検証する共通のテストを提供する
+//
+// 独自の Store を実装した場合は、テストから Run を呼び出す
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) session.Store {
+//			return NewMyStore(t.TempDir())
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+// Factory はテストごとに空の Store を作成する
+// 後片付けが必要な場合は t.Cleanup に登録する
+type Factory func(t *testing.T) session.Store
+
+// Run は全ての共通テストをサブテストとして実行する
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store session.Store)
+	}{
+		{"AppendAndList", testAppendAndList},
+		{"Ordering", testOrdering},
+		{"Isolation", testIsolation},
+		{"ToolCallRoundTrip", testToolCallRoundTrip},
+		{"Metadata", testMetadata},
+		{"Delete", testDelete},
+		{"Sessions", testSessions},
+		{"Fork", testFork},
+		{"NotFound", testNotFound},
+		{"ConcurrentAppend", testConcurrentAppend},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func appendTurns(t *testing.T, store session.Store, sessionID session.SessionID, turns ...*session.ConversationTurn) {
+	t.Helper()
+	if err := store.Append(context.Background(), sessionID, turns...); err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+}
+
+func listTurns(t *testing.T, store session.Store, sessionID session.SessionID) []*session.ConversationTurn {
+	t.Helper()
+	turns, err := store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	return turns
+}
+
+func testAppendAndList(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	sessionID := session.NewSessionID()
+
+	turns, err := store.List(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("List returned error for a missing session: %v", err)
+	}
+	if len(turns) != 0 {
+		t.Fatalf("expected no turns, got %d", len(turns))
+	}
+
+	user := &session.ConversationTurn{Role: "user", Content: "hello"}
+	assistant := &session.ConversationTurn{
+		Role:      "assistant",
+		Content:   "hi",
+		ToolCalls: []session.ToolCall{{Name: "read_file", Arguments: `{"path":"a.txt"}`, Result: "a"}},
+		Metadata:  map[string]string{"previous_response_id": "resp_1"},
+		Usage:     &session.Usage{Model: "gpt-4.1", InputTokens: 100, OutputTokens: 10, CostUSD: 0.001},
+	}
+	if err := store.Append(ctx, sessionID, user, assistant); err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+	if !user.CreatedAt.IsZero() {
+		t.Error("Append must not modify the caller's turn")
+	}
+
+	turns, err = store.List(ctx, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 || turns[0].Content != "hello" || turns[1].Content != "hi" {
+		t.Fatalf("unexpected turns: %+v", turns)
+	}
+	got := turns[1]
+	if len(got.ToolCalls) != 1 || got.ToolCalls[0] != assistant.ToolCalls[0] {
+		t.Errorf("tool calls = %+v", got.ToolCalls)
+	}
+	if got.Metadata["previous_response_id"] != "resp_1" {
+		t.Errorf("metadata = %v", got.Metadata)
+	}
+	if got.Usage == nil || !reflect.DeepEqual(*got.Usage, *assistant.Usage) {
+		t.Errorf("usage = %+v", got.Usage)
+	}
+	if turns[0].CreatedAt.IsZero() {
+		t.Error("created_at was not set")
+	}
+}
+
+func testDelete(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	deleted, kept := session.NewSessionID(), session.NewSessionID()
+	appendTurns(t, store, deleted, &session.ConversationTurn{Role: "user", Content: "a"})
+	appendTurns(t, store, kept, &session.ConversationTurn{Role: "user", Content: "b"})
+	if err := store.SetMetadata(ctx, deleted, map[string]string{"model": "gpt-4.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(ctx, deleted); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if err := store.Delete(ctx, deleted); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("second Delete: expected ErrSessionNotFound, got %v", err)
+	}
+
+	if turns, _ := store.List(ctx, deleted); len(turns) != 0 {
+		t.Errorf("turns were not deleted: %+v", turns)
+	}
+	if metadata, _ := store.GetMetadata(ctx, deleted); len(metadata) != 0 {
+		t.Errorf("metadata was not deleted: %v", metadata)
+	}
+	if turns, _ := store.List(ctx, kept); len(turns) != 1 {
+		t.Errorf("other session was affected: %+v", turns)
+	}
+}
+
+func testSessions(t *testing.T, store session.Store) {
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	older, newer := session.NewSessionID(), session.NewSessionID()
+
+	appendTurns(t, store, older,
+		&session.ConversationTurn{Role: "user", Content: "first\nquestion", CreatedAt: base},
+		&session.ConversationTurn{Role: "assistant", Content: "answer", CreatedAt: base.Add(time.Second)},
+	)
+	appendTurns(t, store, newer, &session.ConversationTurn{Role: "user", Content: "other", CreatedAt: base.Add(2 * time.Second)})
+	if err := store.SetMetadata(context.Background(), older, map[string]string{session.TitleMetadataKey: "最初の質問"}); err != nil {
+		t.Fatalf("SetMetadata returned error: %v", err)
+	}
+
+	sessions, err := store.Sessions(context.Background())
+	if err != nil {
+		t.Fatalf("Sessions returned error: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != newer || sessions[1].ID != older {
+		t.Fatalf("sessions are not ordered by last update: %+v", sessions)
+	}
+
+	info := sessions[1]
+	if info.TurnCount != 2 || info.Preview != "first\nquestion" || info.Title != "最初の質問" || sessions[0].Title != "" {
+		t.Errorf("unexpected session info: %+v", info)
+	}
+	if !info.CreatedAt.Equal(base) || !info.UpdatedAt.Equal(base.Add(time.Second)) {
+		t.Errorf("created_at = %v, updated_at = %v", info.CreatedAt, info.UpdatedAt)
+	}
+}
+
+func testMetadata(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	sessionID := session.NewSessionID()
+
+	metadata, err := store.GetMetadata(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("GetMetadata returned error for a missing session: %v", err)
+	}
+	if len(metadata) != 0 {
+		t.Fatalf("expected no metadata, got %v", metadata)
+	}
+
+	if err := store.SetMetadata(ctx, sessionID, map[string]string{"model": "gpt-4.1", "model.temperature": "0.2"}); err != nil {
+		t.Fatal(err)
+	}
+	// 指定したキーのみ上書きし、空文字列のキーは削除する
+	if err := store.SetMetadata(ctx, sessionID, map[string]string{"model": "gpt-5", "model.temperature": ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err = store.GetMetadata(ctx, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 || metadata["model"] != "gpt-5" {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+
+	// 返されたマップを変更しても保存内容に影響しないこと
+	metadata["model"] = "changed"
+	if again, _ := store.GetMetadata(ctx, sessionID); again["model"] != "gpt-5" {
+		t.Errorf("stored metadata was modified through the returned map: %v", again)
+	}
+}
+
+func testFork(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	parent := session.NewSessionID()
+	appendTurns(t, store, parent,
+		&session.ConversationTurn{Role: "user", Content: "1"},
+		&session.ConversationTurn{Role: "assistant", Content: "one", Usage: &session.Usage{InputTokens: 10},
+			ToolCalls: []session.ToolCall{{CallID: "call_1", Name: "read_file", Arguments: `{}`, Result: "a"}}},
+		&session.ConversationTurn{Role: "user", Content: "2"},
+		&session.ConversationTurn{Role: "assistant", Content: "two", Usage: &session.Usage{InputTokens: 20},
+			ToolCalls: []session.ToolCall{{CallID: "call_2", Name: "read_file", Arguments: `{}`, Result: "b"}}},
+	)
+	if err := store.SetMetadata(ctx, parent, map[string]string{"model": "gpt-5-mini"}); err != nil {
+		t.Fatal(err)
+	}
+
+	forkID, err := store.Fork(ctx, parent, 2)
+	if err != nil {
+		t.Fatalf("Fork returned error: %v", err)
+	}
+
+	turns, err := store.List(ctx, forkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 || turns[1].Content != "one" || turns[1].Usage == nil || turns[1].Usage.InputTokens != 10 {
+		t.Fatalf("unexpected forked turns: %+v", turns)
+	}
+	if calls := turns[1].ToolCalls; len(calls) != 1 || calls[0].CallID != "call_1" || calls[0].Result != "a" {
+		t.Errorf("tool calls were not copied: %+v", calls)
+	}
+	if metadata, _ := store.GetMetadata(ctx, forkID); metadata["model"] != "gpt-5-mini" {
+		t.Errorf("metadata was not copied: %v", metadata)
+	}
+
+	// 分岐したセッションへの追加は分岐元に影響しないこと
+	appendTurns(t, store, forkID, &session.ConversationTurn{Role: "user", Content: "2'"})
+	if parentTurns, _ := store.List(ctx, parent); len(parentTurns) != 4 {
+		t.Errorf("parent session was modified: %d turns", len(parentTurns))
+	}
+
+	sessions, err := store.Sessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents := make(map[session.SessionID]session.SessionID)
+	for _, info := range sessions {
+		parents[info.ID] = info.ParentID
+	}
+	if len(parents) != 2 || parents[forkID] != parent || parents[parent] != "" {
+		t.Errorf("unexpected parent links: %v", parents)
+	}
+
+	// 全てのターンのコピーと範囲外の指定
+	all, err := store.Fork(ctx, parent, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turns, _ := store.List(ctx, all); len(turns) != 4 {
+		t.Errorf("expected all 4 turns to be copied, got %d", len(turns))
+	}
+	// メタデータのないセッションを分岐しても、分岐先にメタデータを設定できること
+	bare := session.NewSessionID()
+	appendTurns(t, store, bare, &session.ConversationTurn{Role: "user", Content: "bare"})
+	bareFork, err := store.Fork(ctx, bare, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetMetadata(ctx, bareFork, map[string]string{"title": "forked"}); err != nil {
+		t.Fatalf("SetMetadata on a fork returned error: %v", err)
+	}
+	if metadata, _ := store.GetMetadata(ctx, bareFork); metadata["title"] != "forked" {
+		t.Errorf("metadata of the fork = %v", metadata)
+	}
+
+	if _, err := store.Fork(ctx, parent, 5); err == nil {
+		t.Error("forking beyond the last turn must fail")
+	}
+	if _, err := store.Fork(ctx, session.NewSessionID(), 0); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("forking a missing session must return ErrSessionNotFound, got %v", err)
+	}
+}
+
+func testCanceledContext(t *testing.T, store session.Store) {
+	sessionID := session.NewSessionID()
+	appendTurns(t, store, sessionID, &session.ConversationTurn{Role: "user", Content: "hello"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := store.Append(ctx, sessionID, &session.ConversationTurn{Role: "assistant", Content: "hi"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Append: expected context.Canceled, got %v", err)
+	}
+	if _, err := store.List(ctx, sessionID); !errors.Is(err, context.Canceled) {
+		t.Errorf("List: expected context.Canceled, got %v", err)
+	}
+	if _, err := store.Sessions(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sessions: expected context.Canceled, got %v", err)
+	}
+	if err := store.Delete(ctx, sessionID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Delete: expected context.Canceled, got %v", err)
+	}
+
+	// キャンセルされた操作は何も変更しないこと
+	turns, err := store.List(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 1 {
+		t.Errorf("expected 1 turn, got %d", len(turns))
+	}
+}
+
+func testOrdering(t *testing.T, store session.Store) {
+	sessionID := session.NewSessionID()
+
+	// 1件ずつの追加と複数件の追加が混在しても追加した順に返すこと
+	for i := range 5 {
+		appendTurns(t, store, sessionID, &session.ConversationTurn{Role: "user", Content: fmt.Sprint(i)})
+	}
+	appendTurns(t, store, sessionID,
+		&session.ConversationTurn{Role: "assistant", Content: "5"},
+		&session.ConversationTurn{Role: "user", Content: "6"},
+	)
+	// 発言日時が前後していても追加した順を保つこと
+	appendTurns(t, store, sessionID, &session.ConversationTurn{Role: "assistant", Content: "7", CreatedAt: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)})
+
+	turns := listTurns(t, store, sessionID)
+	if len(turns) != 8 {
+		t.Fatalf("expected 8 turns, got %d", len(turns))
+	}
+	for i, turn := range turns {
+		if turn.Content != fmt.Sprint(i) {
+			t.Errorf("turns[%d].Content = %q, want %q", i, turn.Content, fmt.Sprint(i))
+		}
+	}
+}
+
+func testIsolation(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	a, b := session.NewSessionID(), session.NewSessionID()
+
+	appendTurns(t, store, a, &session.ConversationTurn{Role: "user", Content: "a1"})
+	appendTurns(t, store, b, &session.ConversationTurn{Role: "user", Content: "b1"})
+	appendTurns(t, store, a, &session.ConversationTurn{Role: "assistant", Content: "a2"})
+	if err := store.SetMetadata(ctx, a, map[string]string{"model": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetMetadata(ctx, b, map[string]string{"model": "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if turns := listTurns(t, store, a); len(turns) != 2 || turns[0].Content != "a1" || turns[1].Content != "a2" {
+		t.Errorf("unexpected turns in session a: %+v", turns)
+	}
+	if turns := listTurns(t, store, b); len(turns) != 1 || turns[0].Content != "b1" {
+		t.Errorf("unexpected turns in session b: %+v", turns)
+	}
+	if metadata, _ := store.GetMetadata(ctx, a); metadata["model"] != "a" {
+		t.Errorf("unexpected metadata in session a: %v", metadata)
+	}
+
+	// 返されたスライスを変更しても保存内容に影響しないこと
+	turns := listTurns(t, store, a)
+	turns[0] = &session.ConversationTurn{Role: "user", Content: "changed"}
+	if again := listTurns(t, store, a); again[0].Content != "a1" {
+		t.Errorf("stored turns were modified through the returned slice: %+v", again[0])
+	}
+}
+
+func testToolCallRoundTrip(t *testing.T, store session.Store) {
+	sessionID := session.NewSessionID()
+	// 実行日時は秒単位、実行時間はミリ秒単位で保存できればよい
+	startedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	calls := []session.ToolCall{
+		{
+			CallID: "call_1", Name: "write_file", Arguments: `{"path":"main.go","content":"package main\n\nfunc main() {}\n"}`, Result: `{"success":true}`,
+			StartedAt: startedAt, Duration: 1500 * time.Millisecond, Bytes: 16,
+		},
+		{
+			CallID: "call_2", Name: "grep_file", Arguments: `{"path":".","keyword":"日本語 \"quoted\""}`, Result: "Error: 見つかりませんでした\n\t<>&",
+			IsError: true, StartedAt: startedAt.Add(2 * time.Second), Duration: 3 * time.Millisecond, Bytes: 40,
+		},
+		{Name: "list_file", Arguments: `{}`, Result: ""},
+	}
+	appendTurns(t, store, sessionID, &session.ConversationTurn{Role: "assistant", Content: "done", ToolCalls: calls})
+
+	turns := listTurns(t, store, sessionID)
+	if len(turns) != 1 {
+		t.Fatalf("expected 1 turn, got %d", len(turns))
+	}
+	got := turns[0].ToolCalls
+	if len(got) != len(calls) {
+		t.Fatalf("expected %d tool calls, got %d", len(calls), len(got))
+	}
+	for i := range calls {
+		if !sameToolCall(got[i], calls[i]) {
+			t.Errorf("tool call %d:\n got  %+v\n want %+v", i, got[i], calls[i])
+		}
+	}
+
+	// ツール呼び出しのないターンは空のまま返すこと
+	appendTurns(t, store, sessionID, &session.ConversationTurn{Role: "user", Content: "next"})
+	if turns := listTurns(t, store, sessionID); len(turns[1].ToolCalls) != 0 {
+		t.Errorf("unexpected tool calls: %+v", turns[1].ToolCalls)
+	}
+}
+
+// sameToolCall はツール呼び出しが等しいかを返す（実行日時はタイムゾーンの違いを無視して比較する）
+func sameToolCall(a, b session.ToolCall) bool {
+	if !a.StartedAt.Equal(b.StartedAt) {
+		return false
+	}
+	a.StartedAt, b.StartedAt = time.Time{}, time.Time{}
+	return a == b
+}
+
+func testNotFound(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	missing := session.NewSessionID()
+
+	// 存在しないセッションは空として扱い、エラーにしないこと
+	if turns := listTurns(t, store, missing); len(turns) != 0 {
+		t.Errorf("expected no turns, got %+v", turns)
+	}
+	if metadata, err := store.GetMetadata(ctx, missing); err != nil || len(metadata) != 0 {
+		t.Errorf("GetMetadata = %v, %v", metadata, err)
+	}
+	if err := store.Delete(ctx, missing); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("Delete of a missing session: expected ErrSessionNotFound, got %v", err)
+	}
+	if sessions, err := store.Sessions(ctx); err != nil || len(sessions) != 0 {
+		t.Errorf("Sessions = %+v, %v", sessions, err)
+	}
+
+	// 分岐元が存在しない場合は ErrSessionNotFound を返すこと
+	if _, err := store.Fork(ctx, missing, 0); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("Fork: expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func testConcurrentAppend(t *testing.T, store session.Store) {
+	const (
+		writers = 8
+		rounds  = 10
+	)
+	sessionID := session.NewSessionID()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*rounds)
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range rounds {
+				content := fmt.Sprintf("%d-%d", w, r)
+				err := store.Append(context.Background(), sessionID,
+					&session.ConversationTurn{Role: "user", Content: content},
+					&session.ConversationTurn{Role: "assistant", Content: content},
+				)
+				if err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent Append returned error: %v", err)
+	}
+
+	turns := listTurns(t, store, sessionID)
+	if len(turns) != writers*rounds*2 {
+		t.Fatalf("expected %d turns, got %d", writers*rounds*2, len(turns))
+	}
+
+	// 1回の Append で追加したターンは連続し、各書き込み元の順序が保たれること
+	last := make(map[string]int)
+	for i := 0; i < len(turns); i += 2 {
+		user, assistant := turns[i], turns[i+1]
+		if user.Role != "user" || assistant.Role != "assistant" || user.Content != assistant.Content {
+			t.Fatalf("turns of one Append are interleaved at %d: %q/%q, %q/%q", i, user.Role, user.Content, assistant.Role, assistant.Content)
+		}
+		var w, r int
+		if _, err := fmt.Sscanf(user.Content, "%d-%d", &w, &r); err != nil {
+			t.Fatal(err)
+		}
+		key := fmt.Sprint(w)
+		if prev, ok := last[key]; ok && r <= prev {
+			t.Errorf("appends from writer %d are out of order: %d after %d", w, r, prev)
+		}
+		last[key] = r
+	}
+}
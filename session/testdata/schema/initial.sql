@@ -0,0 +1,15 @@
+-- 最初のリリースのスキーマ（トークン使用量とセッションのメタデータがない）
+CREATE TABLE conversation_turns (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	content TEXT NOT NULL,
+	tool_calls TEXT,
+	metadata TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_session_id ON conversation_turns(session_id);
+
+INSERT INTO conversation_turns (session_id, role, content, tool_calls, metadata, created_at) VALUES
+	('legacy-session', 'user', 'main.go を読んで', NULL, NULL, '2025-01-02 03:04:05'),
+	('legacy-session', 'assistant', 'main.go は空です', '[{"name":"read_file","arguments":"{\"path\":\"main.go\"}","result":"package main"}]', '{"previous_response_id":"resp_legacy"}', '2025-01-02 03:04:09');
@@ -0,0 +1,32 @@
+-- トークン使用量を追加した後、schema_version を導入する前のスキーマ
+CREATE TABLE conversation_turns (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	content TEXT NOT NULL,
+	tool_calls TEXT,
+	metadata TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	model TEXT,
+	input_tokens INTEGER,
+	cached_tokens INTEGER,
+	output_tokens INTEGER,
+	reasoning_tokens INTEGER,
+	cost_usd REAL
+);
+CREATE INDEX idx_session_id ON conversation_turns(session_id);
+CREATE TABLE session_metadata (
+	session_id TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (session_id, key)
+);
+
+INSERT INTO conversation_turns (session_id, role, content, tool_calls, metadata, created_at) VALUES
+	('legacy-session', 'user', 'main.go を読んで', NULL, NULL, '2025-01-02 03:04:05');
+INSERT INTO conversation_turns (session_id, role, content, tool_calls, metadata, created_at,
+	model, input_tokens, cached_tokens, output_tokens, reasoning_tokens, cost_usd) VALUES
+	('legacy-session', 'assistant', 'main.go は空です', '[{"name":"read_file","arguments":"{\"path\":\"main.go\"}","result":"package main"}]', '{"previous_response_id":"resp_legacy"}', '2025-01-02 03:04:09',
+	'gpt-4.1', 120, 20, 15, 0, 0.0004);
+INSERT INTO session_metadata (session_id, key, value) VALUES
+	('legacy-session', 'model', 'gpt-4.1');
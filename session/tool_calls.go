@@ -0,0 +1,135 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// insertToolCalls はトランザクション内でターンのツール呼び出しを追加する
+func (s *SQLiteStore) insertToolCalls(ctx context.Context, tx *sql.Tx, sessionID SessionID, turnID int64, calls []ToolCall) error {
+	for _, call := range calls {
+		var startedAt sql.NullString
+		if !call.StartedAt.IsZero() {
+			startedAt = sql.NullString{String: call.StartedAt.UTC().Format(time.DateTime), Valid: true}
+		}
+		var durationMS sql.NullInt64
+		if call.Duration > 0 {
+			durationMS = sql.NullInt64{Int64: call.Duration.Milliseconds(), Valid: true}
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO tool_calls (
+				turn_id, call_id, name, arguments, result, is_error, started_at, duration_ms, bytes
+			)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, turnID, call.CallID, call.Name, s.seal(call.Arguments, turnAAD(toolArgumentsColumn, sessionID, turnID)),
+			s.seal(call.Result, turnAAD(toolResultColumn, sessionID, turnID)), call.IsError, startedAt, durationMS, call.Bytes); err != nil {
+			return fmt.Errorf("failed to insert tool call: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadToolCalls はセッションのツール呼び出しを読み込み、対応するターンに設定する
+func (s *SQLiteStore) loadToolCalls(ctx context.Context, sessionID SessionID, turnsByID map[int64]*ConversationTurn) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.turn_id, c.call_id, c.name, c.arguments, c.result, c.is_error, c.started_at, c.duration_ms, c.bytes
+		FROM tool_calls c
+		JOIN conversation_turns t ON t.id = c.turn_id
+		WHERE t.session_id = ?
+		ORDER BY c.id ASC
+	`, sessionID.String())
+	if err != nil {
+		return fmt.Errorf("failed to query tool calls: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			turnID     int64
+			call       ToolCall
+			startedAt  sql.NullTime
+			durationMS sql.NullInt64
+		)
+		if err := rows.Scan(&turnID, &call.CallID, &call.Name, &call.Arguments, &call.Result,
+			&call.IsError, &startedAt, &durationMS, &call.Bytes); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if call.Arguments, err = s.open(call.Arguments, turnAAD(toolArgumentsColumn, sessionID, turnID)); err != nil {
+			return fmt.Errorf("failed to decrypt tool call arguments: %w", err)
+		}
+		if call.Result, err = s.open(call.Result, turnAAD(toolResultColumn, sessionID, turnID)); err != nil {
+			return fmt.Errorf("failed to decrypt tool result: %w", err)
+		}
+		call.StartedAt = startedAt.Time
+		call.Duration = time.Duration(durationMS.Int64) * time.Millisecond
+
+		if turn, ok := turnsByID[turnID]; ok {
+			turn.ToolCalls = append(turn.ToolCalls, call)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return nil
+}
+
+// ToolStat はツールごとの呼び出し回数と実行時間の集計
+type ToolStat struct {
+	Name        string        // ツール名
+	Calls       int           // 呼び出し回数
+	Errors      int           // 失敗した回数
+	AvgDuration time.Duration // 平均実行時間（実行時間が記録された呼び出しのみ）
+	MaxDuration time.Duration // 最長の実行時間
+	TotalBytes  int64         // 実行結果の合計バイト数
+}
+
+// ErrorRate は呼び出しのうち失敗した割合を返す
+func (t ToolStat) ErrorRate() float64 {
+	if t.Calls == 0 {
+		return 0
+	}
+	return float64(t.Errors) / float64(t.Calls)
+}
+
+// ToolStats は指定時刻以降のツール呼び出しをツールごとに集計し、失敗した回数の多い順に返す
+// sinceがゼロ値の場合は全期間を対象とする
+func (s *SQLiteStore) ToolStats(ctx context.Context, since time.Time) ([]ToolStat, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.name, COUNT(*), SUM(c.is_error), COALESCE(AVG(c.duration_ms), 0), COALESCE(MAX(c.duration_ms), 0), SUM(c.bytes)
+		FROM tool_calls c
+		JOIN conversation_turns t ON t.id = c.turn_id
+		WHERE t.created_at >= ?
+		GROUP BY c.name
+		ORDER BY SUM(c.is_error) DESC, COUNT(*) DESC, c.name ASC
+	`, since.UTC().Format(time.DateTime))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tool stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []ToolStat
+	for rows.Next() {
+		var (
+			stat          ToolStat
+			avgDurationMS float64
+			maxDurationMS int64
+		)
+		if err := rows.Scan(&stat.Name, &stat.Calls, &stat.Errors, &avgDurationMS, &maxDurationMS, &stat.TotalBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		stat.AvgDuration = time.Duration(avgDurationMS * float64(time.Millisecond))
+		stat.MaxDuration = time.Duration(maxDurationMS) * time.Millisecond
+		stats = append(stats, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return stats, nil
+}
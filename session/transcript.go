@@ -0,0 +1,96 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// TranscriptVersion はエクスポート形式のバージョン
+const TranscriptVersion = 1
+
+// Transcript はセッションをエクスポートしたもの
+// JSON形式で書き出したものは ImportTranscript で任意の Store に読み込める
+type Transcript struct {
+	Version    int                 `json:"version"`            // エクスポート形式のバージョン
+	SessionID  SessionID           `json:"session_id"`         // エクスポート元のセッションID
+	ExportedAt time.Time           `json:"exported_at"`        // エクスポート日時
+	Metadata   map[string]string   `json:"metadata,omitempty"` // セッション単位のメタデータ
+	Usage      Usage               `json:"usage"`              // セッション全体のトークン使用量
+	Turns      []*ConversationTurn `json:"turns"`              // 会話履歴
+}
+
+// ExportTranscript はセッションの会話履歴とメタデータを Transcript として取り出す
+func ExportTranscript(ctx context.Context, store Store, sessionID SessionID) (*Transcript, error) {
+	turns, err := store.List(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(turns) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	metadata, err := store.GetMetadata(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transcript{
+		Version:    TranscriptVersion,
+		SessionID:  sessionID,
+		ExportedAt: time.Now(),
+		Metadata:   metadata,
+		Usage:      SumUsage(turns),
+		Turns:      turns,
+	}, nil
+}
+
+// ReadTranscript はJSON形式の Transcript を読み込む
+func ReadTranscript(r io.Reader) (*Transcript, error) {
+	var t Transcript
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, fmt.Errorf("failed to decode transcript: %w", err)
+	}
+	if t.Version != TranscriptVersion {
+		return nil, fmt.Errorf("unsupported transcript version: %d", t.Version)
+	}
+	if len(t.Turns) == 0 {
+		return nil, fmt.Errorf("transcript has no turns")
+	}
+	return &t, nil
+}
+
+// WriteJSON は Transcript をJSON形式で書き出す
+func (t *Transcript) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(t); err != nil {
+		return fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	return nil
+}
+
+// ImportTranscript は Transcript を指定したセッションIDで Store に読み込む
+// 既存のセッションを上書きしないよう、会話履歴が存在するセッションIDにはエラーを返す
+func ImportTranscript(ctx context.Context, store Store, t *Transcript, sessionID SessionID) error {
+	existing, err := store.List(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("session %s already exists", sessionID)
+	}
+
+	if err := store.Append(ctx, sessionID, t.Turns...); err != nil {
+		return fmt.Errorf("failed to import turns: %w", err)
+	}
+	if len(t.Metadata) > 0 {
+		if err := store.SetMetadata(ctx, sessionID, t.Metadata); err != nil {
+			return fmt.Errorf("failed to import metadata: %w", err)
+		}
+	}
+
+	return nil
+}
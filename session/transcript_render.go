@@ -0,0 +1,274 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// transcriptTimeFormat は書き出す日時の形式
+const transcriptTimeFormat = "2006-01-02 15:04:05 MST"
+
+// roleLabels はロールの表示名
+var roleLabels = map[string]string{
+	"user":      "ユーザー",
+	"assistant": "アシスタント",
+	"tool":      "ツール",
+}
+
+// toolCallView は書き出し用に整形したツール呼び出し
+type toolCallView struct {
+	Name      string
+	Arguments string // 整形した引数（JSON）
+	Diff      string // パッチ（patch 引数がある場合のみ。引数からは取り除く）
+	Result    string
+}
+
+// newToolCallView はツール呼び出しを書き出し用に整形する
+func newToolCallView(call ToolCall) toolCallView {
+	view := toolCallView{Name: call.Name, Arguments: call.Arguments, Result: call.Result}
+
+	var args map[string]any
+	if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+		// JSONとして解釈できない引数はそのまま表示する
+		return view
+	}
+	if patch, ok := args["patch"].(string); ok {
+		view.Diff = patch
+		delete(args, "patch")
+	}
+	if formatted, err := json.MarshalIndent(args, "", "  "); err == nil {
+		view.Arguments = string(formatted)
+	}
+	return view
+}
+
+// WriteMarkdown は Transcript をMarkdown形式で書き出す
+func (t *Transcript) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	if title := t.Metadata[TitleMetadataKey]; title != "" {
+		fmt.Fprintf(&b, "# %s\n\n", title)
+		fmt.Fprintf(&b, "- セッションID: %s\n", t.SessionID)
+	} else {
+		fmt.Fprintf(&b, "# セッション %s\n\n", t.SessionID)
+	}
+	if model := t.Metadata["model"]; model != "" {
+		fmt.Fprintf(&b, "- モデル: %s\n", model)
+	}
+	if len(t.Turns) > 0 && !t.Turns[0].CreatedAt.IsZero() {
+		fmt.Fprintf(&b, "- 開始日時: %s\n", formatTranscriptTime(t.Turns[0].CreatedAt))
+	}
+	fmt.Fprintf(&b, "- エクスポート日時: %s\n", formatTranscriptTime(t.ExportedAt))
+	fmt.Fprintf(&b, "- トークン: %s\n\n", formatUsage(t.Usage))
+
+	// 各ターンは空行で終わるため、区切り線の前に空行は不要
+	for _, turn := range t.Turns {
+		b.WriteString("---\n\n")
+		fmt.Fprintf(&b, "## %s", roleLabel(turn.Role))
+		if !turn.CreatedAt.IsZero() {
+			fmt.Fprintf(&b, " (%s)", formatTranscriptTime(turn.CreatedAt))
+		}
+		b.WriteString("\n\n")
+
+		for _, call := range turn.ToolCalls {
+			view := newToolCallView(call)
+			fmt.Fprintf(&b, "### ツール: %s\n\n", view.Name)
+			writeCodeBlock(&b, "json", view.Arguments)
+			if view.Diff != "" {
+				writeCodeBlock(&b, "diff", view.Diff)
+			}
+			b.WriteString("結果:\n\n")
+			writeCodeBlock(&b, "", view.Result)
+		}
+
+		if len(turn.ToolCalls) > 0 && turn.Content != "" {
+			b.WriteString("### 回答\n\n")
+		}
+		if turn.Content != "" {
+			b.WriteString(turn.Content)
+			b.WriteString("\n\n")
+		}
+
+		if turn.Usage != nil {
+			fmt.Fprintf(&b, "_トークン: %s_\n\n", formatUsage(*turn.Usage))
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+// writeCodeBlock は内容に含まれるバッククォートより長いフェンスでコードブロックを書き出す
+func writeCodeBlock(b *strings.Builder, lang, content string) {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%s%s\n%s", fence, lang, content)
+	if !strings.HasSuffix(content, "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, "%s\n\n", fence)
+}
+
+// WriteHTML は Transcript を単体で閲覧できるHTML形式で書き出す
+func (t *Transcript) WriteHTML(w io.Writer) error {
+	type turnView struct {
+		Role      string
+		Label     string
+		CreatedAt string
+		Content   string
+		ToolCalls []toolCallView
+		Usage     string
+	}
+
+	data := struct {
+		SessionID  SessionID
+		Title      string
+		Model      string
+		ExportedAt string
+		Usage      string
+		Turns      []turnView
+	}{
+		SessionID:  t.SessionID,
+		Title:      t.Metadata[TitleMetadataKey],
+		Model:      t.Metadata["model"],
+		ExportedAt: formatTranscriptTime(t.ExportedAt),
+		Usage:      formatUsage(t.Usage),
+	}
+	for _, turn := range t.Turns {
+		view := turnView{Role: turn.Role, Label: roleLabel(turn.Role), Content: turn.Content}
+		if !turn.CreatedAt.IsZero() {
+			view.CreatedAt = formatTranscriptTime(turn.CreatedAt)
+		}
+		for _, call := range turn.ToolCalls {
+			view.ToolCalls = append(view.ToolCalls, newToolCallView(call))
+		}
+		if turn.Usage != nil {
+			view.Usage = formatUsage(*turn.Usage)
+		}
+		data.Turns = append(data.Turns, view)
+	}
+
+	var buf bytes.Buffer
+	if err := transcriptHTML.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to render transcript: %w", err)
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+// diffLine はHTMLで色分けして表示するパッチの1行
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+// splitDiff はパッチを行ごとに分割し、追加・削除・ハンクヘッダーを分類する
+func splitDiff(diff string) []diffLine {
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	result := make([]diffLine, 0, len(lines))
+	for _, line := range lines {
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			class = "file"
+		case strings.HasPrefix(line, "@@"):
+			class = "hunk"
+		case strings.HasPrefix(line, "+"):
+			class = "add"
+		case strings.HasPrefix(line, "-"):
+			class = "del"
+		}
+		result = append(result, diffLine{Class: class, Text: line})
+	}
+	return result
+}
+
+var transcriptHTML = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"splitDiff": splitDiff,
+}).Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<title>{{if .Title}}{{.Title}}{{else}}セッション {{.SessionID}}{{end}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #24292f; }
+header dl { display: grid; grid-template-columns: max-content 1fr; gap: .2em 1em; }
+header dt { font-weight: bold; }
+.turn { border: 1px solid #d0d7de; border-radius: 6px; margin: 1em 0; padding: .5em 1em; }
+.turn.user { background: #f6f8fa; }
+.turn h2 { font-size: 1em; margin: .3em 0; }
+.turn h2 time { font-weight: normal; color: #57606a; margin-left: .5em; }
+.content { white-space: pre-wrap; }
+pre { background: #f6f8fa; padding: .5em; overflow-x: auto; }
+details { margin: .5em 0; }
+summary { cursor: pointer; font-family: monospace; }
+.diff .file { font-weight: bold; }
+.diff .hunk { color: #0550ae; }
+.diff .add { background: #e6ffec; }
+.diff .del { background: #ffebe9; }
+.usage { color: #57606a; font-size: .85em; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{if .Title}}{{.Title}}{{else}}セッション {{.SessionID}}{{end}}</h1>
+<dl>
+{{- if .Title}}<dt>セッションID</dt><dd>{{.SessionID}}</dd>{{end}}
+{{- if .Model}}<dt>モデル</dt><dd>{{.Model}}</dd>{{end}}
+<dt>エクスポート日時</dt><dd>{{.ExportedAt}}</dd>
+<dt>トークン</dt><dd>{{.Usage}}</dd>
+</dl>
+</header>
+{{- range .Turns}}
+<section class="turn {{.Role}}">
+<h2>{{.Label}}{{if .CreatedAt}}<time>{{.CreatedAt}}</time>{{end}}</h2>
+{{- range .ToolCalls}}
+<details>
+<summary>ツール: {{.Name}}</summary>
+<pre>{{.Arguments}}</pre>
+{{- if .Diff}}
+<pre class="diff">{{range splitDiff .Diff}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>
+{{- end}}
+<p>結果:</p>
+<pre>{{.Result}}</pre>
+</details>
+{{- end}}
+{{- if .Content}}
+<div class="content">{{.Content}}</div>
+{{- end}}
+{{- if .Usage}}
+<p class="usage">トークン: {{.Usage}}</p>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+func roleLabel(role string) string {
+	if label, ok := roleLabels[role]; ok {
+		return label
+	}
+	return role
+}
+
+func formatTranscriptTime(t time.Time) string {
+	return t.Local().Format(transcriptTimeFormat)
+}
+
+func formatUsage(u Usage) string {
+	return fmt.Sprintf("入力 %d (キャッシュ %d) / 出力 %d (推論 %d) / $%.4f",
+		u.InputTokens, u.CachedTokens, u.OutputTokens, u.ReasoningTokens, u.CostUSD)
+}
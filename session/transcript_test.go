@@ -0,0 +1,107 @@
+package session_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+func TestTranscript_ExportImportRoundTrip(t *testing.T) {
+	src := session.NewInMemoryStore()
+	id := session.NewSessionID()
+	askedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	turns := []*session.ConversationTurn{
+		{Role: "user", Content: "old を new にして", CreatedAt: askedAt},
+		{
+			Role:    "assistant",
+			Content: "変更しました",
+			ToolCalls: []session.ToolCall{{
+				Name:      "patch_file",
+				Arguments: `{"path":"main.go","patch":"@@ -1 +1 @@\n-old\n+new\n"}`,
+				Result:    `{"success":true}`,
+			}},
+			Metadata:  map[string]string{"previous_response_id": "resp_1"},
+			Usage:     &session.Usage{Model: "gpt-4.1", InputTokens: 100, OutputTokens: 10},
+			CreatedAt: askedAt.Add(3 * time.Second),
+		},
+	}
+	for _, turn := range turns {
+		if err := src.Append(context.Background(), id, turn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.SetMetadata(context.Background(), id, map[string]string{"model": "gpt-4.1", session.TitleMetadataKey: "old を new に置換"}); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := session.ExportTranscript(context.Background(), src, id)
+	if err != nil {
+		t.Fatalf("ExportTranscript returned error: %v", err)
+	}
+
+	var md bytes.Buffer
+	if err := exported.WriteMarkdown(&md); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# old を new に置換\n", "## ユーザー", "### ツール: patch_file", "```diff\n@@ -1 +1 @@\n-old\n+new\n```", "変更しました"} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown does not contain %q:\n%s", want, md.String())
+		}
+	}
+
+	var html bytes.Buffer
+	if err := exported.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), "<h1>old を new に置換</h1>") {
+		t.Errorf("html does not show the title:\n%s", html.String())
+	}
+	if !strings.Contains(html.String(), `<span class="del">-old</span>`) {
+		t.Errorf("html does not highlight the diff:\n%s", html.String())
+	}
+
+	var js bytes.Buffer
+	if err := exported.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := session.ReadTranscript(&js)
+	if err != nil {
+		t.Fatalf("ReadTranscript returned error: %v", err)
+	}
+
+	dst, err := session.NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := session.ImportTranscript(context.Background(), dst, imported, id); err != nil {
+		t.Fatalf("ImportTranscript returned error: %v", err)
+	}
+	if err := session.ImportTranscript(context.Background(), dst, imported, id); err == nil {
+		t.Error("importing into an existing session must fail")
+	}
+
+	got, err := dst.List(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 turns, got %d", len(got))
+	}
+	if !got[0].CreatedAt.Equal(askedAt) || !got[1].CreatedAt.Equal(askedAt.Add(3*time.Second)) {
+		t.Errorf("timestamps were not preserved: %v, %v", got[0].CreatedAt, got[1].CreatedAt)
+	}
+	if got[1].ToolCalls[0].Arguments != turns[1].ToolCalls[0].Arguments || got[1].Usage.InputTokens != 100 {
+		t.Errorf("unexpected assistant turn: %+v", got[1])
+	}
+	if metadata, _ := dst.GetMetadata(context.Background(), id); metadata["model"] != "gpt-4.1" {
+		t.Errorf("metadata was not imported: %v", metadata)
+	}
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// TitleUsageMetadataKey はタイトルの生成に使ったトークン使用量（JSON）を保存するセッション単位のメタデータのキー
+// 会話のターンとは別のモデルを使うため、アシスタントのターンの使用量には含めずに記録する
+const TitleUsageMetadataKey = "title_usage"
+
+// Usage はAPI呼び出しのトークン使用量と推定コストを表す
+type Usage struct {
+	Model           string  `json:"model,omitempty"`  // 使用したモデル（複数のモデルの使用量を合計した場合は空）
+	InputTokens     int64   `json:"input_tokens"`     // 入力トークン数（キャッシュ分を含む）
+	CachedTokens    int64   `json:"cached_tokens"`    // キャッシュから読み込まれた入力トークン数
+	OutputTokens    int64   `json:"output_tokens"`    // 出力トークン数（推論トークンを含む）
+	ReasoningTokens int64   `json:"reasoning_tokens"` // 推論トークン数
+	CostUSD         float64 `json:"cost_usd"`         // 推定コスト（USD）
+	Models          []Usage `json:"models,omitempty"` // モデルごとの内訳（複数のモデルの使用量を合計した場合のみ）
+}
+
+// TotalTokens は入力と出力の合計トークン数を返す
+func (u *Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// Add は使用量を加算する
+// 異なるモデルの使用量を加算した場合は Model を空にし、モデルごとの内訳を Models に記録する
+func (u *Usage) Add(other Usage) {
+	models := u.breakdown()
+	for _, o := range other.breakdown() {
+		i := slices.IndexFunc(models, func(m Usage) bool { return m.Model == o.Model })
+		if i < 0 {
+			models = append(models, o)
+			continue
+		}
+		models[i].addTokens(o)
+	}
+
+	u.addTokens(other)
+	u.Model, u.Models = "", nil
+	switch len(models) {
+	case 0:
+	case 1:
+		u.Model = models[0].Model
+	default:
+		u.Models = models
+	}
+}
+
+// addTokens はモデルを考慮せずにトークン数とコストを加算する
+func (u *Usage) addTokens(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.CachedTokens += other.CachedTokens
+	u.OutputTokens += other.OutputTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.CostUSD += other.CostUSD
+}
+
+// breakdown はモデルごとの使用量を返す（使用量がない場合は nil）
+// 返すスライスは u と共有しない
+func (u *Usage) breakdown() []Usage {
+	if len(u.Models) > 0 {
+		return slices.Clone(u.Models)
+	}
+	if u.Model == "" && u.TotalTokens() == 0 && u.CostUSD == 0 {
+		return nil
+	}
+	single := *u
+	single.Models = nil
+	return []Usage{single}
+}
+
+// SumUsage は会話履歴に記録された使用量を合計する
+func SumUsage(turns []*ConversationTurn) Usage {
+	var total Usage
+	for _, turn := range turns {
+		if turn.Usage == nil {
+			continue
+		}
+		total.Add(*turn.Usage)
+	}
+	return total
+}
+
+// TitleUsage はセッション単位のメタデータに記録したタイトルの生成に使ったトークン使用量を返す（記録がない場合は nil）
+func TitleUsage(metadata map[string]string) *Usage {
+	data := metadata[TitleUsageMetadataKey]
+	if data == "" {
+		return nil
+	}
+	var usage Usage
+	if err := json.Unmarshal([]byte(data), &usage); err != nil {
+		return nil
+	}
+	return &usage
+}
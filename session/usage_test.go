@@ -0,0 +1,35 @@
+package session_test
+
+import (
+	"testing"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+func TestUsage_Add(t *testing.T) {
+	var total session.Usage
+	total.Add(session.Usage{Model: "gpt-4.1", InputTokens: 100, OutputTokens: 10, CostUSD: 0.01})
+	total.Add(session.Usage{Model: "gpt-4.1", InputTokens: 50, OutputTokens: 5, CostUSD: 0.005})
+	if total.Model != "gpt-4.1" || total.Models != nil || total.InputTokens != 150 {
+		t.Fatalf("same model must be summed without a breakdown: %+v", total)
+	}
+
+	// 異なるモデルは Model を空にしてモデルごとに記録する
+	total.Add(session.Usage{Model: "gpt-4.1-nano", InputTokens: 20, OutputTokens: 2, CostUSD: 0.001})
+	if total.Model != "" || total.InputTokens != 170 || len(total.Models) != 2 ||
+		total.Models[0].Model != "gpt-4.1" || total.Models[0].InputTokens != 150 ||
+		total.Models[1].Model != "gpt-4.1-nano" || total.Models[1].InputTokens != 20 {
+		t.Fatalf("unexpected usage: %+v", total)
+	}
+
+	// 内訳を持つ使用量どうしもモデルごとに合計する
+	var sum session.Usage
+	sum.Add(total)
+	sum.Add(total)
+	if sum.InputTokens != 340 || len(sum.Models) != 2 || sum.Models[0].InputTokens != 300 || sum.Models[1].InputTokens != 40 {
+		t.Errorf("unexpected sum: %+v", sum)
+	}
+	if total.Models[0].InputTokens != 150 {
+		t.Errorf("adding must not modify the other usage: %+v", total)
+	}
+}
@@ -0,0 +1,96 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// セッションを作成したワークスペースを記録するセッション単位のメタデータのキー
+const (
+	WorkspaceMetadataKey = "workspace"  // ワークスペースの絶対パス
+	GitRemoteMetadataKey = "git_remote" // ワークスペースの git リポジトリの origin のURL
+)
+
+// Workspace はセッションを作成したワークスペース（プロジェクト）
+type Workspace struct {
+	Path      string // ワークスペースの絶対パス
+	GitRemote string // git リポジトリの origin のURL（git リポジトリでない場合は空）
+}
+
+// DetectWorkspace はディレクトリのワークスペースを調べる
+// git リポジトリの中の場合は、どのサブディレクトリから起動しても同じワークスペースになるようリポジトリのルートを使う。
+// git が使えない場合や git リポジトリでない場合はディレクトリをそのまま使い、GitRemote を空にする
+func DetectWorkspace(ctx context.Context, dir string) (Workspace, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return Workspace{}, fmt.Errorf("failed to resolve workspace path: %w", err)
+	}
+
+	ws := Workspace{Path: path}
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return ws, nil
+	}
+	if root := strings.TrimSpace(string(out)); root != "" {
+		ws.Path = filepath.Clean(root)
+	}
+
+	out, err = exec.CommandContext(ctx, "git", "-C", ws.Path, "config", "--get", "remote.origin.url").Output()
+	if err == nil {
+		ws.GitRemote = sanitizeRemote(strings.TrimSpace(string(out)))
+	}
+	return ws, nil
+}
+
+// sanitizeRemote はリモートのURLに含まれる認証情報を取り除く
+func sanitizeRemote(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.Scheme == "" || u.User == nil {
+		return remote
+	}
+	u.User = nil
+	return u.String()
+}
+
+// Metadata はワークスペースを記録するセッション単位のメタデータを返す
+func (w Workspace) Metadata() map[string]string {
+	return map[string]string{
+		WorkspaceMetadataKey: w.Path,
+		GitRemoteMetadataKey: w.GitRemote,
+	}
+}
+
+// Contains はセッション単位のメタデータが表すセッションがこのワークスペースのものかを返す
+// パスが一致するか、別の場所に clone した同じリポジトリ（origin が一致する）の場合に true を返す
+func (w Workspace) Contains(metadata map[string]string) bool {
+	if path := metadata[WorkspaceMetadataKey]; path != "" && path == w.Path {
+		return true
+	}
+	remote := metadata[GitRemoteMetadataKey]
+	return remote != "" && remote == w.GitRemote
+}
+
+// WorkspaceSessions はワークスペースのセッションの概要を更新日時の新しい順に返す
+// ワークスペースを記録していないセッション（記録を始める前に作成したセッション）は、どのワークスペースのものか分からないため含める
+func WorkspaceSessions(ctx context.Context, store Store, ws Workspace) ([]SessionInfo, error) {
+	sessions, err := store.Sessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []SessionInfo
+	for _, info := range sessions {
+		metadata, err := store.GetMetadata(ctx, info.ID)
+		if err != nil {
+			return nil, err
+		}
+		if metadata[WorkspaceMetadataKey] == "" || ws.Contains(metadata) {
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,223 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// commandHandler はスラッシュコマンドの処理関数
+// 終了が要求された場合は true を返す
+type commandHandler func(ctx context.Context, c *Conversation, args []string) (exit bool)
+
+// commands は利用可能なスラッシュコマンドの一覧
+var commands = map[string]commandHandler{
+	"/exit": func(_ context.Context, _ *Conversation, _ []string) bool {
+		return true
+	},
+	"/cost": func(ctx context.Context, c *Conversation, _ []string) bool {
+		c.printSessionUsage(ctx, "セッションの使用量", false)
+		return false
+	},
+	"/model": func(ctx context.Context, c *Conversation, args []string) bool {
+		switcher, ok := c.outputGenerator.(ModelSwitcher)
+		if !ok {
+			c.printer.PrintErrorMessage("モデルの切り替えに対応していません")
+			return false
+		}
+
+		var (
+			description string
+			err         error
+		)
+		if len(args) == 0 {
+			description, err = switcher.DescribeModel(ctx, c.currentSession)
+		} else {
+			description, err = switcher.SwitchModel(ctx, c.currentSession, args)
+		}
+		if err != nil {
+			c.printer.PrintErrorMessage(err.Error())
+			return false
+		}
+
+		c.printer.PrintSystemMessage("🤖 モデル: " + description)
+		return false
+	},
+	"/memory": func(_ context.Context, c *Conversation, _ []string) bool {
+		inspector, ok := c.outputGenerator.(PromptInspector)
+		if !ok {
+			c.printer.PrintErrorMessage("システムプロンプトの表示に対応していません")
+			return false
+		}
+
+		c.printer.PrintSystemMessage("📝 実効的なシステムプロンプト:")
+		c.printer.PrintSeparator()
+		fmt.Println(inspector.EffectivePrompt())
+		c.printer.PrintSeparator()
+		return false
+	},
+	"/fork": func(ctx context.Context, c *Conversation, args []string) bool {
+		forker, ok := c.outputGenerator.(SessionForker)
+		if !ok {
+			c.printer.PrintErrorMessage("セッションの分岐に対応していません")
+			return false
+		}
+
+		exchanges := 0
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				c.printer.PrintErrorMessage("ターン番号は1以上の整数で指定してください: /fork [ターン番号]")
+				return false
+			}
+			exchanges = n
+		}
+
+		forkID, err := forker.ForkSession(ctx, c.currentSession, exchanges)
+		if err != nil {
+			c.printer.PrintErrorMessage(err.Error())
+			return false
+		}
+
+		parentID := c.currentSession
+		c.currentSession = forkID
+		c.printer.PrintSystemMessage(fmt.Sprintf("🌿 セッションを分岐しました: %s (分岐元: %s)", forkID, parentID))
+		return false
+	},
+	"/sessions": func(ctx context.Context, c *Conversation, args []string) bool {
+		lister, ok := c.outputGenerator.(SessionLister)
+		if !ok {
+			c.printer.PrintErrorMessage("セッションの一覧表示に対応していません")
+			return false
+		}
+
+		all := false
+		for _, arg := range args {
+			if arg != "--all" {
+				c.printer.PrintErrorMessage("不明な引数です: /sessions [--all]")
+				return false
+			}
+			all = true
+		}
+
+		sessions, err := lister.ListSessions(ctx, all)
+		if err != nil {
+			c.printer.PrintErrorMessage(err.Error())
+			return false
+		}
+
+		c.printer.PrintSessions(sessions, c.currentSession)
+		return false
+	},
+	"/title": func(ctx context.Context, c *Conversation, args []string) bool {
+		titler, ok := c.outputGenerator.(SessionTitler)
+		if !ok {
+			c.printer.PrintErrorMessage("セッションのタイトルに対応していません")
+			return false
+		}
+
+		var (
+			title string
+			err   error
+		)
+		if len(args) == 0 {
+			title, err = titler.SessionTitle(ctx, c.currentSession)
+		} else {
+			title, err = titler.SetSessionTitle(ctx, c.currentSession, strings.Join(args, " "))
+		}
+		if err != nil {
+			c.printer.PrintErrorMessage(err.Error())
+			return false
+		}
+
+		if title == "" {
+			c.printer.PrintSystemMessage("🏷  タイトルは未設定です（最初の応答の後に自動で付けられます）")
+			return false
+		}
+		c.printer.PrintSystemMessage("🏷  タイトル: " + title)
+		return false
+	},
+	"/verbose": func(_ context.Context, c *Conversation, args []string) bool {
+		verbose := !c.printer.Verbose()
+		if len(args) > 0 {
+			switch args[0] {
+			case "on":
+				verbose = true
+			case "off":
+				verbose = false
+			default:
+				c.printer.PrintErrorMessage("使い方: /verbose [on|off]")
+				return false
+			}
+		}
+
+		c.printer.SetVerbose(verbose)
+		if verbose {
+			c.printer.PrintSystemMessage("🔧 ツールの実行状況を詳細に表示します")
+		} else {
+			c.printer.PrintSystemMessage("🔧 ツールの実行状況を簡潔に表示します")
+		}
+		return false
+	},
+	"/search": func(ctx context.Context, c *Conversation, args []string) bool {
+		searcher, ok := c.outputGenerator.(SessionSearcher)
+		if !ok {
+			c.printer.PrintErrorMessage("セッションの検索に対応していません")
+			return false
+		}
+		if len(args) == 0 {
+			c.printer.PrintErrorMessage("検索語を指定してください: /search <検索語>")
+			return false
+		}
+
+		results, err := searcher.SearchSessions(ctx, strings.Join(args, " "))
+		if err != nil {
+			c.printer.PrintErrorMessage(err.Error())
+			return false
+		}
+
+		c.printer.PrintSearchResults(results)
+		return false
+	},
+}
+
+// handleCommand は入力がスラッシュコマンドであれば処理する
+// コマンドとして処理した場合は handled=true、終了が要求された場合は exit=true を返す
+func (c *Conversation) handleCommand(ctx context.Context, userInput string) (handled bool, exit bool) {
+	fields := strings.Fields(userInput)
+	if len(fields) == 0 {
+		return false, false
+	}
+
+	handler, ok := commands[fields[0]]
+	if !ok {
+		return false, false
+	}
+
+	return true, handler(ctx, c, fields[1:])
+}
+
+// printSessionUsage は現在のセッションのトークン使用量を表示する
+// skipEmpty が true の場合、使用量がなければ何も表示しない
+func (c *Conversation) printSessionUsage(ctx context.Context, title string, skipEmpty bool) {
+	reporter, ok := c.outputGenerator.(UsageReporter)
+	if !ok {
+		if !skipEmpty {
+			c.printer.PrintErrorMessage("使用量の集計に対応していません")
+		}
+		return
+	}
+
+	usage, err := reporter.SessionUsage(ctx, c.currentSession)
+	if err != nil {
+		c.printer.PrintErrorMessage(err.Error())
+		return
+	}
+
+	if skipEmpty && usage.TotalTokens() == 0 {
+		return
+	}
+
+	c.printer.PrintUsage(title, usage)
+}
@@ -2,7 +2,9 @@ package ui
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/jinford/coding-agent-example/session"
@@ -13,14 +15,46 @@ type Conversation struct {
 	outputGenerator OutputGenerator
 	printer         *Printer
 	currentSession  session.SessionID
+	interrupts      <-chan os.Signal
 }
 
-func NewConversation(inputScanner InputScanner, outputGenerator OutputGenerator) *Conversation {
-	return &Conversation{
+type ConversationOption func(*Conversation)
+
+// WithSessionID は既存のセッションを再開する
+func WithSessionID(sessionID session.SessionID) ConversationOption {
+	return func(c *Conversation) {
+		c.currentSession = sessionID
+	}
+}
+
+// WithInterrupts は Ctrl-C（SIGINT）を受け取るチャンネルを指定する
+// 応答の生成中に受け取った場合はそのターンだけを中断し、入力待ちの間に続けて2回受け取った場合は終了する
+func WithInterrupts(interrupts <-chan os.Signal) ConversationOption {
+	return func(c *Conversation) {
+		c.interrupts = interrupts
+	}
+}
+
+// WithVerbose はツールの実行状況を詳細に表示する
+func WithVerbose(verbose bool) ConversationOption {
+	return func(c *Conversation) {
+		c.printer.SetVerbose(verbose)
+	}
+}
+
+func NewConversation(inputScanner InputScanner, outputGenerator OutputGenerator, opts ...ConversationOption) *Conversation {
+	c := &Conversation{
 		inputScanner:    inputScanner,
 		outputGenerator: outputGenerator,
 		printer:         NewPrinter(),
 	}
+	for _, f := range opts {
+		f(c)
+	}
+	if scanner, ok := inputScanner.(PromptedScanner); ok {
+		scanner.SetPrompt(c.printer.Prompt())
+	}
+	return c
 }
 
 func (c *Conversation) Run(ctx context.Context) {
@@ -31,43 +65,94 @@ func (c *Conversation) Run(ctx context.Context) {
 	if c.currentSession.IsEmpty() {
 		c.currentSession = session.NewSessionID()
 	}
+	c.printer.PrintSystemMessage("🗂  セッションID: " + c.currentSession.String())
+
+	// 応答の生成中はツールの実行状況を表示
+	if subscriber, ok := c.outputGenerator.(ToolEventSubscriber); ok {
+		unsubscribe := subscriber.SubscribeToolEvents(c.printer.PrintToolEvent)
+		defer unsubscribe()
+	}
+
+	// 終了時にセッションの使用量を表示（Ctrl-C で終了した場合も表示できるようキャンセルを引き継がない）
+	defer c.printSessionUsage(context.WithoutCancel(ctx), "今回のセッションの使用量", true)
 
 	// ユーザー入力用のチャンネル
-	inputChan := make(chan string)
+	inputChan := make(chan scanResult)
+	// 入力の読み込みを要求するチャンネル（応答の表示中に端末を入力用の状態にしないよう、プロンプトの表示後に読み込む）
+	next := make(chan struct{})
 
 	// コンテキストがキャンセルされたら処理を抜けられるようにユーザーの入力をチャネルで処理
 	go func() {
 		defer close(inputChan)
 		for {
-			// ユーザー入力を取得
-			if !c.inputScanner.Scan() {
+			select {
+			case <-next:
+			case <-ctx.Done():
+				return
+			}
+
+			// ユーザー入力を取得（入力中の Ctrl-C は終了ではなく中断として扱う）
+			var result scanResult
+			if c.inputScanner.Scan() {
+				result.text = strings.TrimSpace(c.inputScanner.Text())
+			} else if c.scanInterrupted() {
+				result.interrupted = true
+			} else {
 				return
 			}
-			userInput := strings.TrimSpace(c.inputScanner.Text())
 
 			select {
-			case inputChan <- userInput:
+			case inputChan <- result:
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 
+	waiting := false     // 入力の読み込みを要求済みか
+	interrupted := false // 入力待ちの間に Ctrl-C を押したか（続けてもう一度押すと終了する）
 	for {
-		// プロンプト表示
-		c.printer.PrintPrompt()
+		if !waiting {
+			// プロンプト表示（プロンプトを自分で表示する入力は空行だけ）
+			if _, ok := c.inputScanner.(PromptedScanner); ok {
+				fmt.Println()
+			} else {
+				c.printer.PrintPrompt()
+			}
 
-		// ユーザー入力またはコンテキストキャンセルを待つ
-		select {
-		case userInput, ok := <-inputChan:
-			if !ok {
+			select {
+			case next <- struct{}{}:
+				waiting = true
+			case <-ctx.Done():
 				return
 			}
+		}
 
-			// 終了コマンドかチェック
-			if userInput == "/exit" {
+		// ユーザー入力、Ctrl-C またはコンテキストキャンセルを待つ
+		select {
+		case in, ok := <-inputChan:
+			waiting = false
+			if !ok {
 				return
 			}
+			if in.interrupted {
+				if interrupted {
+					return
+				}
+				interrupted = true
+				c.printer.PrintSystemMessage("もう一度 Ctrl-C を押すと終了します")
+				continue
+			}
+			interrupted = false
+			userInput := in.text
+
+			// スラッシュコマンドかチェック
+			if handled, exit := c.handleCommand(ctx, userInput); handled {
+				if exit {
+					return
+				}
+				continue
+			}
 
 			if userInput == "" {
 				continue
@@ -77,9 +162,15 @@ func (c *Conversation) Run(ctx context.Context) {
 			stopThinking := c.printer.StartThinking()
 
 			// 応答を生成
-			out, err := c.outputGenerator.GenerateResponse(ctx, userInput, c.currentSession)
+			out, err := c.generateResponse(ctx, userInput)
 			stopThinking()
 
+			// 中断した場合はプロンプトに戻る
+			if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+				c.printer.PrintSystemMessage("⏹  応答を中断しました（途中までの内容はセッションに保存されています）")
+				continue
+			}
+
 			// エラーがあれば表示して次の入力へ
 			if err != nil {
 				c.printer.PrintErrorMessage(err.Error())
@@ -92,8 +183,49 @@ func (c *Conversation) Run(ctx context.Context) {
 			// 応答後に改行
 			fmt.Println()
 
+		case <-c.interrupts:
+			// 行単位で入力を読み込んでいる間の Ctrl-C（入力の読み込みは続けたままにする）
+			if interrupted {
+				return
+			}
+			interrupted = true
+			fmt.Println()
+			c.printer.PrintSystemMessage("もう一度 Ctrl-C を押すと終了します")
+			c.printer.PrintPrompt()
+
 		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+// scanResult は入力の読み込みの結果
+type scanResult struct {
+	text        string
+	interrupted bool // Ctrl-C で入力を中断した
+}
+
+// scanInterrupted は入力の読み込みが Ctrl-C で中断されたかを返す
+func (c *Conversation) scanInterrupted() bool {
+	scanner, ok := c.inputScanner.(interface{ Err() error })
+	return ok && errors.Is(scanner.Err(), ErrInterrupted)
+}
+
+// generateResponse は応答を生成する
+// 生成中に Ctrl-C を受け取った場合はこのターンのコンテキストだけをキャンセルする
+func (c *Conversation) generateResponse(ctx context.Context, userInput string) (string, error) {
+	turnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.interrupts:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return c.outputGenerator.GenerateResponse(turnCtx, userInput, c.currentSession)
+}
@@ -0,0 +1,75 @@
+package ui_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+	"github.com/jinford/coding-agent-example/ui"
+)
+
+// blockingGenerator は ctx がキャンセルされるまで応答を返さない OutputGenerator
+type blockingGenerator struct {
+	started  chan string
+	canceled chan string
+}
+
+func (g *blockingGenerator) GenerateResponse(ctx context.Context, userInput string, _ session.SessionID) (string, error) {
+	g.started <- userInput
+	<-ctx.Done()
+	g.canceled <- userInput
+	return "", fmt.Errorf("failed to call response API: %w", ctx.Err())
+}
+
+func TestConversation_InterruptCancelsTurn(t *testing.T) {
+	generator := &blockingGenerator{started: make(chan string, 1), canceled: make(chan string, 1)}
+	interrupts := make(chan os.Signal)
+	in, keys := io.Pipe()
+	defer keys.Close()
+	editor := ui.NewLineEditor(in, io.Discard)
+	conversation := ui.NewConversation(editor, generator, ui.WithInterrupts(interrupts))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conversation.Run(context.Background())
+	}()
+
+	go io.WriteString(keys, "slow question\r")
+	select {
+	case <-generator.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("response generation did not start")
+	}
+
+	// 応答の生成中の Ctrl-C はターンだけを中断する
+	interrupts <- os.Interrupt
+	select {
+	case got := <-generator.canceled:
+		if got != "slow question" {
+			t.Errorf("canceled %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn was not canceled")
+	}
+
+	// 入力待ちの間の1回目の Ctrl-C では終了しない
+	io.WriteString(keys, "\x03")
+	select {
+	case <-done:
+		t.Fatal("conversation exited after a single Ctrl-C")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 続けてもう一度 Ctrl-C を押すと終了する
+	go io.WriteString(keys, "\x03")
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("conversation did not exit after double Ctrl-C")
+	}
+}
@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistorySize は入力履歴を保存する件数の既定値
+const DefaultHistorySize = 1000
+
+// maxHistoryEntryBytes は履歴に保存する入力の最大バイト数
+// 大きなファイルの貼り付けなどで履歴のファイルが肥大化しないよう、これを超える入力は保存しない
+const maxHistoryEntryBytes = 64 * 1024
+
+// maxHistoryLineBytes は読み込む履歴のファイルの1行の最大バイト数
+// JSONの文字列にすると制御文字は6バイトになるため、maxHistoryEntryBytes より大きくとる。これを超える行は読み飛ばす
+const maxHistoryLineBytes = 1024 * 1024
+
+// History は入力履歴
+// ファイルには1行に1件ずつJSONの文字列として追記するため、複数行の入力もそのまま保存できる
+type History struct {
+	path    string
+	size    int
+	entries []string
+}
+
+// LoadHistory はファイルから入力履歴を読み込む
+// path が空の場合はファイルに保存しない。size 件を超える古い履歴は読み込み時に削除する
+func LoadHistory(path string, size int) (*History, error) {
+	h := &History{path: path, size: size}
+	if path == "" {
+		return h, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	lines := 0
+	for {
+		line, ok, err := readHistoryLine(r)
+		if len(line) > 0 || !ok {
+			lines++
+		}
+		var entry string
+		// 壊れた行や長すぎる行は読み飛ばす
+		if ok && json.Unmarshal(bytes.TrimSpace(line), &entry) == nil && entry != "" {
+			h.entries = append(h.entries, entry)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history file: %w", err)
+		}
+	}
+
+	if len(h.entries) > size {
+		h.entries = h.entries[len(h.entries)-size:]
+	}
+	if lines > len(h.entries) {
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// readHistoryLine は履歴のファイルから1行を読み込む
+// maxHistoryLineBytes を超える行は最後まで読み捨てて ok に false を返す
+func readHistoryLine(r *bufio.Reader) (line []byte, ok bool, err error) {
+	ok = true
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if ok && len(line)+len(chunk) <= maxHistoryLineBytes {
+			line = append(line, chunk...)
+		} else {
+			line, ok = nil, false
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, ok, err
+		}
+	}
+}
+
+// Entries は古い順の入力履歴を返す
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add は入力を履歴に追加してファイルに追記する
+// 空の入力、maxHistoryEntryBytes を超える入力と直前と同じ入力は追加しない
+func (h *History) Add(entry string) error {
+	if strings.TrimSpace(entry) == "" || len(entry) > maxHistoryEntryBytes || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create history dir: %w", err)
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	line, _ := json.Marshal(entry)
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return nil
+}
+
+// rewrite は保持している履歴でファイルを置き換える
+func (h *History) rewrite() error {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		line, _ := json.Marshal(entry)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("failed to replace history file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,817 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// ErrInterrupted は入力が空の状態で Ctrl-C を押した場合に LineEditor.Err が返すエラー
+var ErrInterrupted = errors.New("interrupted")
+
+// PromptedScanner はプロンプトを自分で表示する InputScanner が実装する
+type PromptedScanner interface {
+	InputScanner
+	SetPrompt(prompt string)
+}
+
+// defaultTerminalWidth は端末の幅を取得できない場合の幅
+const defaultTerminalWidth = 80
+
+// tabWidth はタブを表示する幅
+const tabWidth = 4
+
+// LineEditor は端末で入力を編集する InputScanner
+//
+// 主なキー操作:
+//   - Enter で送信。行末の \ の後の Enter、Alt-Enter、Ctrl-J で改行を挿入する
+//   - 貼り付け（ブラケットペーストに対応した端末）は改行を含めてそのまま挿入する
+//   - ←→ / Ctrl-B Ctrl-F でカーソル移動、Alt-B Alt-F / Ctrl-←→ で単語単位の移動、Ctrl-A Ctrl-E で行頭・行末
+//   - ↑↓ / Ctrl-P Ctrl-N で複数行の入力内の移動と履歴の切り替え、Ctrl-R で履歴の逆方向検索
+//   - Ctrl-W Ctrl-U Ctrl-K で単語・行頭まで・行末までを削除、Ctrl-L で画面を消去
+//   - Ctrl-C で入力を破棄（入力が空の場合は ErrInterrupted で終了）、入力が空の状態の Ctrl-D で終了
+type LineEditor struct {
+	in      *bufio.Reader
+	runes   chan rune // in から読み込んだ文字（readRune で受け取る）
+	readErr error     // in の読み込みのエラー（runes を閉じた後に参照する）
+	reading sync.Once
+	out     io.Writer
+	fd      int // 端末のファイルディスクリプタ（端末でない場合は -1）
+	history *History
+
+	prompt             string
+	continuationPrompt string
+
+	text string
+	err  error
+
+	// 編集中の状態
+	buf       []rune
+	cursor    int
+	rows      int // 前回の描画でカーソルがあった行（プロンプトの行からの相対位置）
+	pasting   bool
+	skipLF    bool
+	histIndex int    // 表示中の履歴の位置（len(entries) は編集中の入力）
+	draft     []rune // 履歴を表示する前に編集していた入力
+
+	// 履歴の検索
+	searching   bool
+	searchQuery []rune
+	searchIndex int // 一致した履歴の位置（一致しない場合は -1）
+	searchOK    bool
+
+	mu      sync.Mutex
+	restore func()
+}
+
+// LineEditorOption は LineEditor のオプション
+type LineEditorOption func(*LineEditor)
+
+// WithTerminal は入力を端末として扱い、入力中は raw モードにする
+func WithTerminal(fd int) LineEditorOption {
+	return func(e *LineEditor) {
+		e.fd = fd
+	}
+}
+
+// WithHistory は入力履歴を指定する
+func WithHistory(history *History) LineEditorOption {
+	return func(e *LineEditor) {
+		e.history = history
+	}
+}
+
+// NewLineEditor は in から入力を読み、out に入力中の内容を表示する LineEditor を作成する
+func NewLineEditor(in io.Reader, out io.Writer, opts ...LineEditorOption) *LineEditor {
+	e := &LineEditor{
+		in:                 bufio.NewReader(in),
+		runes:              make(chan rune),
+		out:                out,
+		fd:                 -1,
+		prompt:             "> ",
+		continuationPrompt: "  ",
+	}
+	for _, f := range opts {
+		f(e)
+	}
+	if e.history == nil {
+		e.history, _ = LoadHistory("", DefaultHistorySize)
+	}
+	return e
+}
+
+// SetPrompt implements PromptedScanner.
+func (e *LineEditor) SetPrompt(prompt string) {
+	e.prompt = prompt
+}
+
+// Text は最後に送信した入力を返す
+func (e *LineEditor) Text() string {
+	return e.text
+}
+
+// Err は Scan が false を返した理由を返す（入力の終わりの場合は nil）
+func (e *LineEditor) Err() error {
+	return e.err
+}
+
+// Close は端末を raw モードから元に戻す
+func (e *LineEditor) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.restore != nil {
+		e.restore()
+		e.restore = nil
+	}
+	return nil
+}
+
+// Scan はプロンプトを表示して入力を1件読み込む
+// 入力の終わりに達した場合や Ctrl-C で中断した場合は false を返す
+func (e *LineEditor) Scan() bool {
+	e.text, e.err = "", nil
+	if err := e.enterRawMode(); err != nil {
+		e.err = err
+		return false
+	}
+	defer e.Close()
+
+	e.buf, e.cursor, e.rows = nil, 0, 0
+	e.pasting, e.skipLF, e.searching = false, false, false
+	e.histIndex, e.draft = len(e.history.Entries()), nil
+	e.render()
+
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			// 改行のない最後の入力は送信する
+			if errors.Is(err, io.EOF) && len(e.buf) > 0 {
+				return e.submit()
+			}
+			e.finishLine("")
+			if !errors.Is(err, io.EOF) {
+				e.err = fmt.Errorf("failed to read input: %w", err)
+			}
+			return false
+		}
+
+		if done, ok := e.handleKey(k); done {
+			return ok
+		}
+	}
+}
+
+// enterRawMode は端末を raw モードにしてブラケットペーストを有効にする
+func (e *LineEditor) enterRawMode() error {
+	if e.fd < 0 {
+		return nil
+	}
+	state, err := term.MakeRaw(e.fd)
+	if err != nil {
+		return fmt.Errorf("failed to enable raw mode: %w", err)
+	}
+	io.WriteString(e.out, "\x1b[?2004h")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.restore = func() {
+		io.WriteString(e.out, "\x1b[?2004l")
+		term.Restore(e.fd, state)
+	}
+	return nil
+}
+
+// handleKey はキー入力を処理する
+// 入力を送信・中断した場合は done=true を返し、ok は Scan の戻り値になる
+func (e *LineEditor) handleKey(k key) (done bool, ok bool) {
+	if e.pasting {
+		e.handlePasteKey(k)
+		return false, false
+	}
+	if e.searching && e.handleSearchKey(k) {
+		return false, false
+	}
+
+	switch k.code {
+	case keyRune:
+		e.insert(k.r)
+	case keyEnter:
+		// 行末の \ は改行の入力として扱う
+		if e.cursor > 0 && e.buf[e.cursor-1] == '\\' && (e.cursor == len(e.buf) || e.buf[e.cursor] == '\n') {
+			e.buf[e.cursor-1] = '\n'
+			break
+		}
+		return true, e.submit()
+	case keyNewline:
+		e.insert('\n')
+	case keyPasteStart:
+		e.pasting = true
+		return false, false
+	case keyBackspace:
+		if e.cursor > 0 {
+			e.buf = append(e.buf[:e.cursor-1], e.buf[e.cursor:]...)
+			e.cursor--
+		}
+	case keyDelete:
+		if e.cursor < len(e.buf) {
+			e.buf = append(e.buf[:e.cursor], e.buf[e.cursor+1:]...)
+		}
+	case keyEOF:
+		if len(e.buf) == 0 {
+			e.finishLine("")
+			return true, false
+		}
+		if e.cursor < len(e.buf) {
+			e.buf = append(e.buf[:e.cursor], e.buf[e.cursor+1:]...)
+		}
+	case keyInterrupt:
+		if len(e.buf) == 0 {
+			e.finishLine("^C")
+			e.err = ErrInterrupted
+			return true, false
+		}
+		// 入力中の内容を破棄して新しいプロンプトを表示する
+		e.finishLine("^C")
+		e.buf, e.cursor, e.rows = nil, 0, 0
+		e.histIndex = len(e.history.Entries())
+	case keyLeft:
+		e.cursor = max(e.cursor-1, 0)
+	case keyRight:
+		e.cursor = min(e.cursor+1, len(e.buf))
+	case keyWordLeft:
+		e.cursor = e.wordStart(e.cursor)
+	case keyWordRight:
+		e.cursor = e.wordEnd(e.cursor)
+	case keyHome:
+		e.cursor = e.lineStart(e.cursor)
+	case keyEnd:
+		e.cursor = e.lineEnd(e.cursor)
+	case keyUp:
+		if start := e.lineStart(e.cursor); start > 0 {
+			e.cursor = e.moveToLine(e.lineStart(start-1), e.cursor-start)
+		} else {
+			e.showHistory(e.histIndex - 1)
+		}
+	case keyDown:
+		if end := e.lineEnd(e.cursor); end < len(e.buf) {
+			e.cursor = e.moveToLine(end+1, e.cursor-e.lineStart(e.cursor))
+		} else {
+			e.showHistory(e.histIndex + 1)
+		}
+	case keyDeleteWord:
+		start := e.wordStart(e.cursor)
+		e.buf = append(e.buf[:start], e.buf[e.cursor:]...)
+		e.cursor = start
+	case keyKillLineStart:
+		start := e.lineStart(e.cursor)
+		e.buf = append(e.buf[:start], e.buf[e.cursor:]...)
+		e.cursor = start
+	case keyKillLine:
+		e.buf = append(e.buf[:e.cursor], e.buf[e.lineEnd(e.cursor):]...)
+	case keyClearScreen:
+		io.WriteString(e.out, "\x1b[H\x1b[2J")
+		e.rows = 0
+	case keySearch:
+		e.searching = true
+		e.searchQuery = nil
+		e.searchIndex = -1
+		e.searchOK = true
+	default:
+		return false, false
+	}
+
+	e.render()
+	return false, false
+}
+
+// handlePasteKey は貼り付け中のキー入力を処理する（改行も含めてそのまま挿入する）
+func (e *LineEditor) handlePasteKey(k key) {
+	switch k.code {
+	case keyPasteEnd:
+		e.pasting = false
+		e.render()
+		return
+	case keyEnter:
+		e.insert('\n')
+		e.skipLF = true
+		return
+	case keyNewline:
+		// CRLF の LF は CR で改行済み
+		if !e.skipLF {
+			e.insert('\n')
+		}
+	case keyRune:
+		e.insert(k.r)
+	}
+	e.skipLF = false
+}
+
+// handleSearchKey は履歴の検索中のキー入力を処理する
+// 検索を終えてキーを通常の編集として処理する場合は false を返す
+func (e *LineEditor) handleSearchKey(k key) bool {
+	entries := e.history.Entries()
+	switch k.code {
+	case keyRune:
+		e.searchQuery = append(e.searchQuery, k.r)
+		start := len(entries) - 1
+		if e.searchIndex >= 0 {
+			start = e.searchIndex
+		}
+		e.search(start, "")
+	case keyBackspace:
+		if len(e.searchQuery) > 0 {
+			e.searchQuery = e.searchQuery[:len(e.searchQuery)-1]
+		}
+		e.search(len(entries)-1, "")
+	case keySearch:
+		// さらに古い履歴を検索する（表示中と同じ内容の履歴は飛ばす）
+		if e.searchIndex > 0 {
+			e.search(e.searchIndex-1, entries[e.searchIndex])
+		}
+	case keyCancel, keyInterrupt:
+		e.searching = false
+	default:
+		// 一致した履歴を入力に設定し、キーは通常どおり処理する
+		e.searching = false
+		if e.searchIndex >= 0 {
+			e.setBuffer([]rune(entries[e.searchIndex]))
+			e.histIndex = e.searchIndex
+		}
+		return false
+	}
+	e.render()
+	return true
+}
+
+// search は start から古い方へ検索語を含む履歴を探す（skip と同じ内容の履歴は除く）
+// 見つからない場合は直前に一致した履歴を表示したままにする
+func (e *LineEditor) search(start int, skip string) {
+	entries := e.history.Entries()
+	query := string(e.searchQuery)
+	if query == "" {
+		e.searchIndex, e.searchOK = -1, true
+		return
+	}
+	for i := min(start, len(entries)-1); i >= 0; i-- {
+		if entries[i] != skip && strings.Contains(entries[i], query) {
+			e.searchIndex, e.searchOK = i, true
+			return
+		}
+	}
+	e.searchOK = false
+}
+
+// showHistory は index の位置の履歴を入力に設定する
+func (e *LineEditor) showHistory(index int) {
+	entries := e.history.Entries()
+	if index < 0 || index > len(entries) || index == e.histIndex {
+		return
+	}
+	if e.histIndex == len(entries) {
+		e.draft = append([]rune(nil), e.buf...)
+	}
+	e.histIndex = index
+	if index == len(entries) {
+		e.setBuffer(e.draft)
+		return
+	}
+	e.setBuffer([]rune(entries[index]))
+}
+
+func (e *LineEditor) setBuffer(buf []rune) {
+	e.buf = append([]rune(nil), buf...)
+	e.cursor = len(e.buf)
+}
+
+func (e *LineEditor) insert(r rune) {
+	e.buf = append(e.buf[:e.cursor], append([]rune{r}, e.buf[e.cursor:]...)...)
+	e.cursor++
+}
+
+// submit は入力を確定して履歴に追加する
+func (e *LineEditor) submit() bool {
+	e.cursor = len(e.buf)
+	e.render()
+	e.finishLine("")
+	e.text = string(e.buf)
+	if err := e.history.Add(e.text); err != nil {
+		// 履歴を保存できなくても入力は続けられる
+		fmt.Fprintf(e.out, "warning: %v\r\n", err)
+	}
+	return true
+}
+
+// finishLine は入力の末尾にカーソルを移して suffix と改行を出力する
+func (e *LineEditor) finishLine(suffix string) {
+	l := e.layout(e.currentPrompt(), e.displayBuffer(), e.cursor)
+	if down := l.end.row - e.rows; down > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dB", down)
+	}
+	io.WriteString(e.out, suffix+"\r\n")
+	e.rows = 0
+}
+
+// lineStart は pos を含む行の先頭の位置を返す
+func (e *LineEditor) lineStart(pos int) int {
+	for pos > 0 && e.buf[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+// lineEnd は pos を含む行の末尾（改行の位置）を返す
+func (e *LineEditor) lineEnd(pos int) int {
+	for pos < len(e.buf) && e.buf[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+// moveToLine は start から始まる行の column 文字目（行の長さを超える場合は行末）の位置を返す
+func (e *LineEditor) moveToLine(start, column int) int {
+	return min(start+column, e.lineEnd(start))
+}
+
+// wordStart は pos より前にある単語の先頭の位置を返す
+func (e *LineEditor) wordStart(pos int) int {
+	for pos > 0 && isSpace(e.buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !isSpace(e.buf[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// wordEnd は pos より後にある単語の末尾の位置を返す
+func (e *LineEditor) wordEnd(pos int) int {
+	for pos < len(e.buf) && isSpace(e.buf[pos]) {
+		pos++
+	}
+	for pos < len(e.buf) && !isSpace(e.buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
+}
+
+// currentPrompt は表示するプロンプトを返す（履歴の検索中は検索語を表示する）
+func (e *LineEditor) currentPrompt() string {
+	if !e.searching {
+		return e.prompt
+	}
+	label := "reverse-i-search"
+	if !e.searchOK {
+		label = "failed " + label
+	}
+	return fmt.Sprintf("(%s)`%s': ", label, string(e.searchQuery))
+}
+
+// displayBuffer は表示する入力を返す（履歴の検索中は一致した履歴を表示する）
+func (e *LineEditor) displayBuffer() []rune {
+	if e.searching && e.searchIndex >= 0 {
+		return []rune(e.history.Entries()[e.searchIndex])
+	}
+	return e.buf
+}
+
+// render は入力中の内容を描画し直す
+func (e *LineEditor) render() {
+	prompt, buf, cursor := e.currentPrompt(), e.displayBuffer(), e.cursor
+	if e.searching {
+		cursor = len(buf)
+		if e.searchIndex >= 0 {
+			if i := strings.Index(string(buf), string(e.searchQuery)); i >= 0 {
+				cursor = len([]rune(string(buf)[:i]))
+			}
+		}
+	}
+
+	var b strings.Builder
+	// 前回描画した先頭の行に戻って消去する
+	if e.rows > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", e.rows)
+	}
+	b.WriteString("\r\x1b[J")
+
+	b.WriteString(prompt)
+	for _, r := range buf {
+		switch r {
+		case '\n':
+			b.WriteString("\r\n" + e.continuationPrompt)
+		case '\t':
+			b.WriteString(strings.Repeat(" ", tabWidth))
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	l := e.layout(prompt, buf, cursor)
+	// 端末の右端で止まったカーソルを次の行に送る
+	if l.wrapEnd {
+		b.WriteString(" \r")
+	}
+	if up := l.end.row - l.cursor.row; up > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", up)
+	}
+	b.WriteString("\r")
+	if l.cursor.col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", l.cursor.col)
+	}
+
+	e.rows = l.cursor.row
+	io.WriteString(e.out, b.String())
+}
+
+// position は画面上の位置（プロンプトの行からの相対位置）
+type position struct {
+	row, col int
+}
+
+// screenLayout は入力を端末の幅で折り返したときの位置
+type screenLayout struct {
+	cursor  position // カーソルの位置
+	end     position // 入力の末尾の位置
+	wrapEnd bool     // 入力の末尾が端末の右端に達していて次の行に送る必要があるか
+}
+
+// layout は入力を端末の幅で折り返したときのカーソルと末尾の位置を計算する
+// 端末は右端まで書き込んでも次の文字を書くまで折り返さないため、col == width を折り返し待ちの状態として扱う
+func (e *LineEditor) layout(prompt string, buf []rune, cursor int) screenLayout {
+	width := terminalWidth(e.fd)
+	var row, col int
+	advance := func(w int) {
+		for w > 0 {
+			if col >= width {
+				row++
+				col = 0
+			}
+			n := min(w, width-col)
+			col += n
+			w -= n
+		}
+	}
+	// 折り返し待ちの位置は次の行の先頭として扱う
+	settle := func(next rune) position {
+		if col >= width && next != '\n' {
+			return position{row + 1, 0}
+		}
+		return position{row, min(col, width-1)}
+	}
+
+	advance(displayWidth(prompt))
+	var l screenLayout
+	for i, r := range buf {
+		if i == cursor {
+			l.cursor = settle(r)
+		}
+		switch r {
+		case '\n':
+			row++
+			col = 0
+			advance(displayWidth(e.continuationPrompt))
+		case '\t':
+			advance(tabWidth)
+		default:
+			w := runewidth.RuneWidth(r)
+			// 全角文字が右端に収まらない場合は次の行に送られる
+			if col+w > width {
+				row++
+				col = 0
+			}
+			advance(w)
+		}
+	}
+	l.wrapEnd = col >= width
+	l.end = settle(0)
+	if cursor >= len(buf) {
+		l.cursor = l.end
+	}
+	return l
+}
+
+// ansiEscape は文字色などのエスケープシーケンス
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// displayWidth はエスケープシーケンスを除いた表示幅を返す
+func displayWidth(s string) int {
+	return runewidth.StringWidth(ansiEscape.ReplaceAllString(s, ""))
+}
+
+// keyCode はキー入力の種類
+type keyCode int
+
+const (
+	keyUnknown       keyCode = iota
+	keyRune                  // 文字の入力
+	keyEnter                 // Enter
+	keyNewline               // 改行の挿入（Alt-Enter, Ctrl-J）
+	keyBackspace             // Backspace, Ctrl-H
+	keyDelete                // Delete
+	keyLeft                  // ←, Ctrl-B
+	keyRight                 // →, Ctrl-F
+	keyUp                    // ↑, Ctrl-P
+	keyDown                  // ↓, Ctrl-N
+	keyHome                  // Home, Ctrl-A
+	keyEnd                   // End, Ctrl-E
+	keyWordLeft              // Alt-B, Ctrl-←
+	keyWordRight             // Alt-F, Ctrl-→
+	keyDeleteWord            // Ctrl-W
+	keyKillLineStart         // Ctrl-U
+	keyKillLine              // Ctrl-K
+	keyClearScreen           // Ctrl-L
+	keyInterrupt             // Ctrl-C
+	keyEOF                   // Ctrl-D
+	keySearch                // Ctrl-R
+	keyCancel                // Ctrl-G
+	keyPasteStart            // ブラケットペーストの開始
+	keyPasteEnd              // ブラケットペーストの終了
+)
+
+// key はキー入力
+type key struct {
+	code keyCode
+	r    rune // keyRune の場合の文字
+}
+
+// controlKeys は制御文字とキーの対応
+var controlKeys = map[rune]keyCode{
+	'\r':   keyEnter,
+	'\n':   keyNewline,
+	0x7f:   keyBackspace,
+	'\b':   keyBackspace,
+	0x01:   keyHome,
+	0x02:   keyLeft,
+	0x03:   keyInterrupt,
+	0x04:   keyEOF,
+	0x05:   keyEnd,
+	0x06:   keyRight,
+	0x07:   keyCancel,
+	0x0b:   keyKillLine,
+	0x0c:   keyClearScreen,
+	0x0e:   keyDown,
+	0x10:   keyUp,
+	0x12:   keySearch,
+	0x15:   keyKillLineStart,
+	0x17:   keyDeleteWord,
+	'\t':   keyRune,
+	'\x1b': keyUnknown, // readEscape で処理する
+}
+
+// escapeTimeout は ESC の後に続くエスケープシーケンスを待つ時間
+// これを過ぎても続きがない場合は ESC キーを単独で押したものとして扱う
+const escapeTimeout = 50 * time.Millisecond
+
+// startReading は入力を読み込む goroutine を開始する
+// ESC の後の入力をタイムアウト付きで待てるよう、入力は別の goroutine で読み込んで runes に送る
+func (e *LineEditor) startReading() {
+	e.reading.Do(func() {
+		go func() {
+			defer close(e.runes)
+			for {
+				r, _, err := e.in.ReadRune()
+				if err != nil {
+					e.readErr = err
+					return
+				}
+				e.runes <- r
+			}
+		}()
+	})
+}
+
+// readRune は入力から1文字を読み込む
+func (e *LineEditor) readRune() (rune, error) {
+	e.startReading()
+	r, ok := <-e.runes
+	if !ok {
+		return 0, e.readErr
+	}
+	return r, nil
+}
+
+// readRuneTimeout は readRune と同じだが、timeout までに入力がない場合は ok に false を返す
+func (e *LineEditor) readRuneTimeout(timeout time.Duration) (r rune, ok bool, err error) {
+	e.startReading()
+	select {
+	case r, ok := <-e.runes:
+		if !ok {
+			return 0, false, e.readErr
+		}
+		return r, true, nil
+	case <-time.After(timeout):
+		return 0, false, nil
+	}
+}
+
+// readKey はキー入力を1つ読み込む
+func (e *LineEditor) readKey() (key, error) {
+	r, err := e.readRune()
+	if err != nil {
+		return key{}, err
+	}
+	if r == '\x1b' {
+		return e.readEscape()
+	}
+	if code, ok := controlKeys[r]; ok {
+		return key{code: code, r: r}, nil
+	}
+	if r < 0x20 {
+		return key{code: keyUnknown}, nil
+	}
+	return key{code: keyRune, r: r}, nil
+}
+
+// readEscape はエスケープシーケンスを読み込む
+// ESC を単独で押した場合は次のキーを取り込まないよう、escapeTimeout までに続きがなければ何もしないキーとして扱う
+func (e *LineEditor) readEscape() (key, error) {
+	r, ok, err := e.readRuneTimeout(escapeTimeout)
+	if err != nil {
+		return key{}, err
+	}
+	if !ok {
+		return key{code: keyUnknown}, nil
+	}
+	switch r {
+	case '\r', '\n':
+		return key{code: keyNewline}, nil
+	case 'b':
+		return key{code: keyWordLeft}, nil
+	case 'f':
+		return key{code: keyWordRight}, nil
+	case 'O':
+		r, err := e.readRune()
+		if err != nil {
+			return key{}, err
+		}
+		return key{code: cursorKeys[r]}, nil
+	case '[':
+	default:
+		return key{code: keyUnknown}, nil
+	}
+
+	// CSI: 引数に続いて 0x40〜0x7e の終端文字が来る
+	var params strings.Builder
+	for {
+		r, err := e.readRune()
+		if err != nil {
+			return key{}, err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			return csiKey(params.String(), r), nil
+		}
+		params.WriteRune(r)
+	}
+}
+
+// cursorKeys はカーソルキーの終端文字とキーの対応
+var cursorKeys = map[rune]keyCode{
+	'A': keyUp,
+	'B': keyDown,
+	'C': keyRight,
+	'D': keyLeft,
+	'H': keyHome,
+	'F': keyEnd,
+}
+
+// csiKey はCSIシーケンスをキーに変換する
+func csiKey(params string, final rune) key {
+	if final == '~' {
+		switch params {
+		case "1", "7":
+			return key{code: keyHome}
+		case "4", "8":
+			return key{code: keyEnd}
+		case "3":
+			return key{code: keyDelete}
+		case "200":
+			return key{code: keyPasteStart}
+		case "201":
+			return key{code: keyPasteEnd}
+		}
+		return key{code: keyUnknown}
+	}
+
+	code := cursorKeys[final]
+	// Ctrl・Alt を押しながらの ←→ は単語単位で移動する
+	if params == "1;5" || params == "1;3" {
+		switch code {
+		case keyLeft:
+			code = keyWordLeft
+		case keyRight:
+			code = keyWordRight
+		}
+	}
+	return key{code: code}
+}
@@ -0,0 +1,175 @@
+package ui_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinford/coding-agent-example/ui"
+)
+
+// scanAll は入力を全て読み込み、送信された入力と最後のエラーを返す
+func scanAll(t *testing.T, input string, opts ...ui.LineEditorOption) ([]string, error) {
+	t.Helper()
+	editor := ui.NewLineEditor(strings.NewReader(input), io.Discard, opts...)
+	var got []string
+	for editor.Scan() {
+		got = append(got, editor.Text())
+	}
+	return got, editor.Err()
+}
+
+func TestLineEditor_Editing(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"enter submits", "hello\rworld\r", []string{"hello", "world"}},
+		{"cursor movement", "helo\x1b[Dl\x01>\r", []string{">hello"}},
+		{"backspace and delete word", "foo bar\x7f\x7fz baz\x17qux\r", []string{"foo bz qux"}},
+		{"kill line", "abc def\x01\x1bf\x0b!\r", []string{"abc!"}},
+		{"trailing backslash continues", "first \\\rsecond\r", []string{"first \nsecond"}},
+		{"alt-enter inserts newline", "a\x1b\rb\r", []string{"a\nb"}},
+		{"bracketed paste keeps newlines", "\x1b[200~line1\r\nline2\rline3\x1b[201~\r", []string{"line1\nline2\nline3"}},
+		{"up moves within multi-line input", "ab\ncd\x1b[A\x05!\r", []string{"ab!\ncd"}},
+		{"wide characters", "日本\x1b[D語\r", []string{"日語本"}},
+		{"ctrl-c discards input", "draft\x03next\r", []string{"next"}},
+		{"eof submits pending input", "last", []string{"last"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanAll(t, tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineEditor_LoneEscape(t *testing.T) {
+	in, keys := io.Pipe()
+	defer keys.Close()
+	editor := ui.NewLineEditor(in, io.Discard)
+
+	done := make(chan bool)
+	go func() { done <- editor.Scan() }()
+
+	// ESC を単独で押した後のキーはエスケープシーケンスとして取り込まない
+	io.WriteString(keys, "\x1b")
+	time.Sleep(200 * time.Millisecond)
+	io.WriteString(keys, "b\r")
+
+	select {
+	case ok := <-done:
+		if !ok || editor.Text() != "b" {
+			t.Errorf("got %q, %v", editor.Text(), ok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scan did not return")
+	}
+}
+
+func TestLineEditor_Exit(t *testing.T) {
+	// 入力が空の状態の Ctrl-D は入力の終わり
+	got, err := scanAll(t, "a\r\x04ignored\r")
+	if err != nil || !slices.Equal(got, []string{"a"}) {
+		t.Errorf("ctrl-d: got %q, %v", got, err)
+	}
+
+	// 入力が空の状態の Ctrl-C は中断
+	got, err = scanAll(t, "\x03ignored\r")
+	if !errors.Is(err, ui.ErrInterrupted) || len(got) != 0 {
+		t.Errorf("ctrl-c: got %q, %v", got, err)
+	}
+}
+
+func TestLineEditor_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history")
+	history, err := ui.LoadHistory(path, ui.DefaultHistorySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ↑で前の入力を呼び出し、↓で編集中の入力に戻る
+	got, err := scanAll(t, "one\rtwo\r\x1b[A\x1b[A!\rdraft\x1b[A\x1b[B\r", ui.WithHistory(history))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "two", "one!", "draft"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// 履歴はファイルに保存され、次に起動したときに使える
+	reloaded, err := ui.LoadHistory(path, ui.DefaultHistorySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "two", "one!", "draft"}; !slices.Equal(reloaded.Entries(), want) {
+		t.Errorf("reloaded entries = %q, want %q", reloaded.Entries(), want)
+	}
+
+	// Ctrl-R で履歴を検索し、もう一度 Ctrl-R で古い方へ進む
+	got, err = scanAll(t, "\x12one\r\x12on\x12\x05?\r", ui.WithHistory(reloaded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one!", "one?"}; !slices.Equal(got, want) {
+		t.Errorf("search: got %q, want %q", got, want)
+	}
+}
+
+func TestLoadHistory_SkipsOversizeLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	huge := `"` + strings.Repeat("x", 2*1024*1024) + `"`
+	if err := os.WriteFile(path, []byte(`"before"`+"\n"+huge+"\n"+`"after"`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 長すぎる行があっても履歴を読み込めること
+	history, err := ui.LoadHistory(path, 10)
+	if err != nil {
+		t.Fatalf("LoadHistory returned error: %v", err)
+	}
+	if want := []string{"before", "after"}; !slices.Equal(history.Entries(), want) {
+		t.Errorf("entries = %q, want %q", history.Entries(), want)
+	}
+
+	// 大きすぎる入力は履歴に保存しない
+	if err := history.Add(strings.Repeat("y", 1024*1024)); err != nil {
+		t.Fatal(err)
+	}
+	if got := history.Entries(); len(got) != 2 {
+		t.Errorf("oversize entry was added: %d entries", len(got))
+	}
+}
+
+func TestLoadHistory_Compacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	history, err := ui.LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{"a", "b", "b", "", "c\nd", "e"} {
+		if err := history.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 空の入力と直前と同じ入力は追加せず、古い履歴から削除する
+	reloaded, err := ui.LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b", "c\nd", "e"}; !slices.Equal(reloaded.Entries(), want) {
+		t.Errorf("entries = %q, want %q", reloaded.Entries(), want)
+	}
+}
@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// markdownRenderer はアシスタントの応答の Markdown を端末向けに整形する
+// 見出し・リスト・表を整形し、コードブロックは言語に応じて色付けして、端末の幅で折り返す
+type markdownRenderer struct {
+	fd       int    // 出力先の端末のファイルディスクリプタ
+	style    string // glamour のスタイル名、またはスタイルを定義した JSON ファイルのパス
+	width    int    // renderer を作成したときの端末の幅
+	renderer *glamour.TermRenderer
+}
+
+// newMarkdownRenderer は端末に出力する markdownRenderer を作成する
+func newMarkdownRenderer(fd int) *markdownRenderer {
+	return &markdownRenderer{fd: fd, style: markdownStyle(fd)}
+}
+
+// markdownStyle は Markdown を整形するスタイルを決める
+// GLAMOUR_STYLE の指定があればそれを使い、なければ端末の背景色に合わせて dark か light を選ぶ。
+// 背景色の問い合わせは端末の応答を待つ（応答しない端末では数秒かかる）ため、作成時に1回だけ行う
+func markdownStyle(fd int) string {
+	if style := os.Getenv("GLAMOUR_STYLE"); style != "" {
+		return style
+	}
+	if fd < 0 || !term.IsTerminal(fd) {
+		return styles.NoTTYStyle
+	}
+	if termenv.HasDarkBackground() {
+		return styles.DarkStyle
+	}
+	return styles.LightStyle
+}
+
+// Render は Markdown を整形する
+func (r *markdownRenderer) Render(markdown string) (string, error) {
+	// 端末の幅が変わった場合は折り返す幅を変えて作り直す
+	width := terminalWidth(r.fd)
+	if r.renderer == nil || width != r.width {
+		renderer, err := glamour.NewTermRenderer(
+			glamour.WithStylePath(r.style),
+			glamour.WithWordWrap(width),
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to create markdown renderer: %w", err)
+		}
+		r.renderer, r.width = renderer, width
+	}
+
+	out, err := r.renderer.Render(markdown)
+	if err != nil {
+		return "", fmt.Errorf("failed to render markdown: %w", err)
+	}
+	return wrapOverflow(out, width), nil
+}
+
+// wrapOverflow は端末の幅を超える行を折り返す
+// glamour は空白でしか折り返さないため、空白を含まない日本語の文章は字下げを保ったまま文字単位で折り返す
+func wrapOverflow(s string, width int) string {
+	var b strings.Builder
+	for line := range strings.Lines(s) {
+		body, newline := strings.CutSuffix(line, "\n")
+		if ansi.StringWidth(body) <= width {
+			b.WriteString(line)
+			continue
+		}
+
+		plain := ansi.Strip(body)
+		indent := len(plain) - len(strings.TrimLeft(plain, " "))
+		if indent >= width/2 {
+			indent = 0
+		}
+		wrapped := ansi.Wrap(ansi.TruncateLeft(body, indent, ""), width-indent, "")
+		for i, l := range strings.Split(wrapped, "\n") {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(strings.Repeat(" ", indent) + l)
+		}
+		if newline {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// terminalWidth は端末の幅を返す（取得できない場合は defaultTerminalWidth）
+func terminalWidth(fd int) int {
+	if fd >= 0 {
+		if width, _, err := term.GetSize(fd); err == nil && width > 0 {
+			return width
+		}
+	}
+	return defaultTerminalWidth
+}
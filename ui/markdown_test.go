@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestMarkdownRenderer_Render(t *testing.T) {
+	markdown := "# 見出し\n\n" + strings.Repeat("とても長い説明の文章です。", 20) + "\n\n" +
+		"| 名前 | 値 |\n| --- | --- |\n| a | 1 |\n\n```go\nfunc main() {}\n```\n"
+
+	out, err := newMarkdownRenderer(-1).Render(markdown)
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+
+	// コードブロックの囲みや表の区切りの記法はそのまま表示しない
+	plain := ansi.Strip(out)
+	if strings.Contains(plain, "```") || strings.Contains(plain, "| --- |") {
+		t.Errorf("markdown syntax was not rendered:\n%s", plain)
+	}
+	// 空白を含まない日本語の文章も端末の幅で折り返す
+	for line := range strings.Lines(out) {
+		if w := ansi.StringWidth(strings.TrimSuffix(line, "\n")); w > defaultTerminalWidth {
+			t.Errorf("line is wider than the terminal (%d): %q", w, line)
+		}
+	}
+}
+
+func TestMarkdownStyle(t *testing.T) {
+	t.Setenv("GLAMOUR_STYLE", "")
+	if got := markdownStyle(-1); got != "notty" {
+		t.Errorf("markdownStyle without a terminal = %q, want notty", got)
+	}
+
+	// GLAMOUR_STYLE の指定を端末の背景色より優先する
+	t.Setenv("GLAMOUR_STYLE", "ascii")
+	if got := markdownStyle(-1); got != "ascii" {
+		t.Errorf("markdownStyle = %q, want ascii", got)
+	}
+}
+
+func TestWrapOverflow(t *testing.T) {
+	in := "  \x1b[32m" + strings.Repeat("あ", 10) + "\x1b[0m\nshort\n"
+	got := wrapOverflow(in, 12)
+
+	// 字下げを保ち、エスケープシーケンスを数えずに折り返す
+	want := []string{"  あああああ", "  あああああ", "short"}
+	lines := strings.Split(strings.TrimSuffix(ansi.Strip(got), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %q, want %q", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
@@ -8,10 +8,58 @@ import (
 	"github.com/jinford/coding-agent-example/session"
 )
 
+// OutputGenerator はユーザーの入力に対する応答を生成する
+// ctx がキャンセルされた場合（Ctrl-C でターンを中断した場合）は途中までの内容をセッションに保存し、
+// context.Canceled をラップしたエラーを返す
 type OutputGenerator interface {
 	GenerateResponse(ctx context.Context, userInput string, sessionID session.SessionID) (response string, err error)
 }
 
+// UsageReporter はセッションのトークン使用量を集計できる OutputGenerator が実装する
+type UsageReporter interface {
+	SessionUsage(ctx context.Context, sessionID session.SessionID) (*session.Usage, error)
+}
+
+// ModelSwitcher はセッションごとにモデル設定を切り替えられる OutputGenerator が実装する
+type ModelSwitcher interface {
+	DescribeModel(ctx context.Context, sessionID session.SessionID) (string, error)
+	SwitchModel(ctx context.Context, sessionID session.SessionID, args []string) (string, error)
+}
+
+// PromptInspector は実効的なシステムプロンプトを返せる OutputGenerator が実装する
+type PromptInspector interface {
+	EffectivePrompt() string
+}
+
+// SessionSearcher は過去のセッションを全文検索できる OutputGenerator が実装する
+type SessionSearcher interface {
+	SearchSessions(ctx context.Context, query string) ([]session.SearchResult, error)
+}
+
+// SessionLister はセッションの一覧を返せる OutputGenerator が実装する
+// all が false の場合は現在のワークスペースのセッションだけを返す
+type SessionLister interface {
+	ListSessions(ctx context.Context, all bool) ([]session.SessionInfo, error)
+}
+
+// SessionTitler はセッションのタイトルを表示・変更できる OutputGenerator が実装する
+type SessionTitler interface {
+	SessionTitle(ctx context.Context, sessionID session.SessionID) (string, error)
+	SetSessionTitle(ctx context.Context, sessionID session.SessionID, title string) (string, error)
+}
+
+// SessionForker はセッションを分岐できる OutputGenerator が実装する
+// exchanges は分岐元からコピーする往復（ユーザーの発言とアシスタントの応答）の数
+type SessionForker interface {
+	ForkSession(ctx context.Context, sessionID session.SessionID, exchanges int) (session.SessionID, error)
+}
+
+// ToolEventSubscriber は応答の生成中のツールの実行状況を通知できる OutputGenerator が実装する
+// handler は GenerateResponse の実行中に呼び出される。unsubscribe で購読をやめる
+type ToolEventSubscriber interface {
+	SubscribeToolEvents(handler func(session.ToolEvent)) (unsubscribe func())
+}
+
 type DummyOutputGenerator struct{}
 
 func NewDummyOutputGenerator() *DummyOutputGenerator {
@@ -2,10 +2,15 @@ package ui
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
+	"github.com/jinford/coding-agent-example/session"
+	"golang.org/x/term"
 )
 
 type Printer struct {
@@ -16,12 +21,15 @@ type Printer struct {
 	promptColor    *color.Color
 	separatorColor *color.Color
 	headerColor    *color.Color
+	toolColor      *color.Color
 
-	spinner *spinner.Spinner
+	spinner  *spinner.Spinner
+	verbose  bool              // ツールの実行状況を詳細に表示するか
+	markdown *markdownRenderer // 応答の Markdown を整形する（端末に出力しない場合は nil）
 }
 
 func NewPrinter() *Printer {
-	return &Printer{
+	p := &Printer{
 		userColor:      color.New(color.FgCyan, color.Bold),
 		assistantColor: color.New(color.FgGreen),
 		systemColor:    color.New(color.FgYellow),
@@ -29,8 +37,14 @@ func NewPrinter() *Printer {
 		promptColor:    color.New(color.FgCyan, color.Bold),
 		separatorColor: color.New(color.FgHiBlack),
 		headerColor:    color.New(color.FgHiCyan, color.Bold),
+		toolColor:      color.New(color.FgHiBlack),
 		spinner:        spinner.New(spinner.CharSets[14], 100*time.Millisecond),
 	}
+	// 端末に出力する場合だけ Markdown を整形する（パイプやファイルへの出力、NO_COLOR の指定時はそのまま出力する）
+	if fd := int(os.Stdout.Fd()); term.IsTerminal(fd) && !color.NoColor {
+		p.markdown = newMarkdownRenderer(fd)
+	}
+	return p
 }
 
 // ウェルカムメッセージを表示
@@ -42,6 +56,15 @@ func (p *Printer) PrintWelcome() {
 	fmt.Println()
 	p.systemColor.Println("💡 使い方:")
 	fmt.Println("  • 質問や指示を入力してEnterキーを押してください")
+	fmt.Println("  • 行末の '\\' または Alt-Enter で改行し、↑↓ で入力履歴を、Ctrl-R で履歴の検索を行います")
+	fmt.Println("  • '/model [モデル名] [effort=...] [temperature=...] [max_tokens=...]' でモデル設定を表示・変更します")
+	fmt.Println("  • '/cost' でトークン使用量と推定コストを表示します")
+	fmt.Println("  • '/fork [ターン番号]' で指定したターンまでの会話を新しいセッションに分岐します")
+	fmt.Println("  • '/sessions [--all]' でこのワークスペースの（--all で全ての）セッションを一覧表示します")
+	fmt.Println("  • '/title [タイトル]' でセッションのタイトルを表示・変更します")
+	fmt.Println("  • '/search <検索語>' で過去のセッションを検索します")
+	fmt.Println("  • '/verbose [on|off]' でツールの実行状況の詳細表示を切り替えます")
+	fmt.Println("  • '/memory' で AGENTS.md を含む実効的なシステムプロンプトを表示します")
 	fmt.Println("  • '/exit' で終了します")
 	fmt.Println()
 	p.separatorColor.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -50,7 +73,12 @@ func (p *Printer) PrintWelcome() {
 // ユーザー入力プロンプトを表示
 func (p *Printer) PrintPrompt() {
 	fmt.Println()
-	p.promptColor.Print("❯ ")
+	fmt.Print(p.Prompt())
+}
+
+// Prompt はユーザー入力プロンプトの文字列を返す
+func (p *Printer) Prompt() string {
+	return p.promptColor.Sprint("❯ ")
 }
 
 // 考え中メッセージを表示
@@ -69,9 +97,20 @@ func (p *Printer) ClearLine() {
 
 // アシスタントのメッセージを表示
 func (p *Printer) PrintAssistantMessage(message string) {
+	if p.markdown != nil {
+		if rendered, err := p.markdown.Render(message); err == nil {
+			fmt.Print(rendered)
+			return
+		}
+	}
 	p.assistantColor.Println(message)
 }
 
+// システムメッセージを表示
+func (p *Printer) PrintSystemMessage(message string) {
+	p.systemColor.Println(message)
+}
+
 // エラーメッセージを表示
 func (p *Printer) PrintErrorMessage(message string) {
 	p.errorColor.Printf("✗ エラー: %v\n", message)
@@ -81,3 +120,103 @@ func (p *Printer) PrintErrorMessage(message string) {
 func (p *Printer) PrintSeparator() {
 	p.separatorColor.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 }
+
+// PrintUsage トークン使用量と推定コストを表示
+func (p *Printer) PrintUsage(title string, usage *session.Usage) {
+	p.systemColor.Printf("📊 %s", title)
+	if usage.Model != "" {
+		p.systemColor.Printf(" (%s)", usage.Model)
+	}
+	fmt.Println()
+	fmt.Printf("  入力トークン: %s (キャッシュ: %s)\n", formatCount(usage.InputTokens), formatCount(usage.CachedTokens))
+	fmt.Printf("  出力トークン: %s (推論: %s)\n", formatCount(usage.OutputTokens), formatCount(usage.ReasoningTokens))
+	fmt.Printf("  推定コスト:   $%.4f\n", usage.CostUSD)
+	// 複数のモデルを使った場合（タイトルの生成に別のモデルを使った場合など）はモデルごとの内訳を表示する
+	for _, m := range usage.Models {
+		model := m.Model
+		if model == "" {
+			model = "不明なモデル"
+		}
+		fmt.Printf("    %s: 入力 %s / 出力 %s / $%.4f\n", model, formatCount(m.InputTokens), formatCount(m.OutputTokens), m.CostUSD)
+	}
+}
+
+// PrintSessions はセッションの一覧を表示する
+func (p *Printer) PrintSessions(sessions []session.SessionInfo, current session.SessionID) {
+	if len(sessions) == 0 {
+		p.systemColor.Println("🗂  セッションはありません")
+		return
+	}
+
+	p.systemColor.Printf("🗂  %d件のセッション\n", len(sessions))
+	for _, info := range sessions {
+		fmt.Println()
+		marker := "  "
+		if info.ID == current {
+			marker = "* "
+		}
+		p.headerColor.Print(marker + info.ID.String())
+		p.separatorColor.Printf("  %s  %dターン\n", info.UpdatedAt.Local().Format("2006-01-02 15:04"), info.TurnCount)
+		if info.Title != "" {
+			fmt.Println("    " + info.Title)
+		} else if preview := strings.Join(strings.Fields(info.Preview), " "); preview != "" {
+			fmt.Println("    " + session.TruncateRunes(preview, 60))
+		}
+	}
+	fmt.Println()
+	p.separatorColor.Println("  再開するには: coding-agent --resume <セッションID>")
+}
+
+// PrintSearchResults はセッションの検索結果を表示する
+func (p *Printer) PrintSearchResults(results []session.SearchResult) {
+	if len(results) == 0 {
+		p.systemColor.Println("🔍 一致するセッションはありません")
+		return
+	}
+
+	p.systemColor.Printf("🔍 %d件のターンが一致しました\n", len(results))
+	for _, result := range results {
+		fmt.Println()
+		p.headerColor.Print("  " + result.SessionID.String())
+		if result.Title != "" {
+			p.headerColor.Print("  " + result.Title)
+		}
+		p.separatorColor.Printf("  %s  %s\n", result.CreatedAt.Local().Format("2006-01-02 15:04"), result.Role)
+		fmt.Println("    " + p.highlightSnippet(result.Snippet))
+	}
+	fmt.Println()
+	p.separatorColor.Println("  再開するには: coding-agent --resume <セッションID>")
+}
+
+// highlightSnippet はスニペット中の検索語を強調表示する
+func (p *Printer) highlightSnippet(snippet string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(snippet, session.SnippetMatchStart)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(snippet[start:], session.SnippetMatchEnd)
+		if end < 0 {
+			break
+		}
+		end += start
+		b.WriteString(snippet[:start])
+		b.WriteString(p.userColor.Sprint(snippet[start+len(session.SnippetMatchStart) : end]))
+		snippet = snippet[end+len(session.SnippetMatchEnd):]
+	}
+	b.WriteString(snippet)
+	return b.String()
+}
+
+// formatCount は数値を3桁区切りの文字列に変換する
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinford/coding-agent-example/session"
+)
+
+// summaryKeys はツールの引数の要約に使う引数名（表示順）
+var summaryKeys = []string{"path", "keyword", "pattern"}
+
+const (
+	maxSummaryRunes  = 60  // 要約する引数の値の最大文字数
+	maxArgumentRunes = 80  // 詳細表示で表示する引数の値の最大文字数
+	maxPreviewLines  = 5   // 詳細表示で表示する実行結果の最大行数
+	maxPreviewRunes  = 120 // 詳細表示で表示する実行結果の1行の最大文字数
+)
+
+// SetVerbose はツールの実行状況を詳細に表示するかを設定する
+func (p *Printer) SetVerbose(verbose bool) {
+	p.verbose = verbose
+}
+
+// Verbose はツールの実行状況を詳細に表示するかを返す
+func (p *Printer) Verbose() bool {
+	return p.verbose
+}
+
+// PrintToolEvent はツールの実行状況を表示する
+// 通常は実行中のツールをスピナーに表示し、終わったツールを1行ずつ表示する。
+// 詳細表示では開始時の引数と実行結果の先頭も表示する
+func (p *Printer) PrintToolEvent(event session.ToolEvent) {
+	// スピナーの表示中は止めてから出力する
+	if p.spinner.Active() {
+		p.spinner.Stop()
+		p.ClearLine()
+		defer p.spinner.Start()
+	}
+
+	call := event.Call
+	label := call.Name
+	if summary := summarizeArguments(call.Arguments); summary != "" {
+		label += " " + summary
+	}
+
+	switch event.Type {
+	case session.ToolStarted:
+		p.spinner.Suffix = " " + label
+		if p.verbose {
+			p.toolColor.Printf("  ▶ %s %s\n", call.Name, verboseArguments(call.Arguments))
+		}
+
+	case session.ToolFinished:
+		p.spinner.Suffix = ""
+		if call.IsError {
+			p.errorColor.Printf("  ✗ %s (%s)", label, formatDuration(call.Duration))
+			fmt.Printf(": %s\n", firstLine(strings.TrimPrefix(call.Result, "Error: ")))
+		} else {
+			p.toolColor.Printf("  ✓ %s (%s)\n", label, formatDuration(call.Duration))
+		}
+		if p.verbose && !call.IsError {
+			for _, line := range resultPreview(call.Result) {
+				p.toolColor.Printf("    │ %s\n", line)
+			}
+			p.toolColor.Printf("    └ %s bytes\n", formatCount(int64(call.Bytes)))
+		}
+	}
+}
+
+// summarizeArguments はツールの引数からパスや検索語などの主な値を取り出して1行にまとめる
+func summarizeArguments(arguments string) string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, key := range summaryKeys {
+		value, ok := args[key].(string)
+		if !ok || value == "" {
+			continue
+		}
+		value = session.TruncateRunes(firstLine(value), maxSummaryRunes)
+		if key != "path" {
+			value = fmt.Sprintf("%q", value)
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// verboseArguments は長い文字列を切り詰めたツールの引数のJSONを返す
+func verboseArguments(arguments string) string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return session.TruncateRunes(arguments, maxArgumentRunes)
+	}
+	for key, value := range args {
+		if s, ok := value.(string); ok {
+			args[key] = session.TruncateRunes(s, maxArgumentRunes)
+		}
+	}
+	out, err := json.Marshal(args)
+	if err != nil {
+		return session.TruncateRunes(arguments, maxArgumentRunes)
+	}
+	return string(out)
+}
+
+// resultPreview はツールの実行結果の先頭の数行を返す
+func resultPreview(result string) []string {
+	var lines []string
+	for line := range strings.Lines(result) {
+		if len(lines) == maxPreviewLines {
+			lines = append(lines, "…")
+			break
+		}
+		lines = append(lines, session.TruncateRunes(strings.TrimRight(line, "\r\n"), maxPreviewRunes))
+	}
+	return lines
+}
+
+// firstLine は文字列の最初の行を返す
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// formatDuration はツールの実行時間を表示用に整形する
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
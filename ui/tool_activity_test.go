@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeArguments(t *testing.T) {
+	tests := []struct {
+		arguments string
+		want      string
+	}{
+		{`{"path":"ai/openai_client.go"}`, "ai/openai_client.go"},
+		{`{"path":"ai","keyword":"TODO","case_sensitive":true}`, `ai "TODO"`},
+		{`{"path":"a.md","content":"# Hello\n"}`, "a.md"},
+		{`{"keyword":"` + strings.Repeat("x", 100) + `"}`, `"` + strings.Repeat("x", maxSummaryRunes) + `…"`},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		if got := summarizeArguments(tt.arguments); got != tt.want {
+			t.Errorf("summarizeArguments(%s) = %q, want %q", tt.arguments, got, tt.want)
+		}
+	}
+}
+
+func TestVerboseArguments(t *testing.T) {
+	got := verboseArguments(`{"path":"a.md","content":"` + strings.Repeat("あ", 100) + `"}`)
+	want := `{"content":"` + strings.Repeat("あ", maxArgumentRunes) + `…","path":"a.md"}`
+	if got != want {
+		t.Errorf("verboseArguments() = %s, want %s", got, want)
+	}
+}
+
+func TestResultPreview(t *testing.T) {
+	got := resultPreview("1\n2\n3\n4\n5\n6\n7\n")
+	if want := []string{"1", "2", "3", "4", "5", "…"}; !slices.Equal(got, want) {
+		t.Errorf("resultPreview() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		1500 * time.Microsecond: "1ms",
+		2340 * time.Millisecond: "2.3s",
+	} {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}